@@ -21,6 +21,8 @@ import (
 	"archive/tar"
 	"compress/bzip2"
 	"compress/gzip"
+	"crypto/sha512"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -182,6 +184,32 @@ func (d *ClickDeb) member(arMember, tarMember string) (content []byte, err error
 	return content, nil
 }
 
+// DataSha512 returns the sha512 hexdigest of the (compressed) data.tar
+// ar member, this is the "archive-sha512" of the meta/hashes.yaml file
+func (d *ClickDeb) DataSha512() (string, error) {
+	if _, err := d.file.Seek(0, 0); err != nil {
+		return "", err
+	}
+
+	arReader := ar.NewReader(d.file)
+	for {
+		header, err := arReader.Next()
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(header.Name, "data.tar") {
+			break
+		}
+	}
+
+	h := sha512.New()
+	if _, err := io.Copy(h, arReader); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 // Unpack unpacks the data.tar.{gz,bz2,xz} into the given target directory
 // with click specific verification, i.e. no files will be extracted outside
 // of the targetdir (no ".." inside the data.tar is allowed)
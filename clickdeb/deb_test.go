@@ -126,6 +126,27 @@ func (s *ClickDebTestSuite) TestSnapDebMetaMember(c *C) {
 	c.Assert(string(yaml), Equals, "name: foo")
 }
 
+func (s *ClickDebTestSuite) TestSnapDebDataSha512(c *C) {
+	builddir := makeTestDebDir(c)
+	path := filepath.Join(c.MkDir(), "foo_1.0_all.deb")
+	d, err := Create(path)
+	c.Assert(err, IsNil)
+
+	var expected string
+	err = d.Build(builddir, func(dataName string) error {
+		expected, err = helpers.Sha512sum(dataName)
+		return err
+	})
+	c.Assert(err, IsNil)
+
+	d, err = Open(path)
+	c.Assert(err, IsNil)
+	defer d.Close()
+	hexdigest, err := d.DataSha512()
+	c.Assert(err, IsNil)
+	c.Assert(hexdigest, Equals, expected)
+}
+
 func (s *ClickDebTestSuite) TestSnapDebUnpack(c *C) {
 	targetDir := c.MkDir()
 
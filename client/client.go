@@ -0,0 +1,307 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package client talks to the snappy daemon (snappyd) over its unix
+// socket, see docs/rest.md for the API.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+
+	"launchpad.net/snappy/snappy"
+)
+
+// DefaultSocket is the unix socket snappyd listens on
+const DefaultSocket = "/run/snappy.socket"
+
+// APIVersion is the prefix of all the paths of the API
+const APIVersion = "/1.0"
+
+// the types of the responses of the daemon
+const (
+	ResponseTypeSync  = "sync"
+	ResponseTypeAsync = "async"
+	ResponseTypeError = "error"
+)
+
+// Response is the envelope of every response of the daemon, the
+// result is an Operation for async responses and an Error for error
+// responses
+type Response struct {
+	Type       string          `json:"type"`
+	StatusCode int             `json:"status-code"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// Error is the result of an error response
+type Error struct {
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrUnexpectedResponse is returned for responses of a type the request
+// does not expect
+var ErrUnexpectedResponse = errors.New("unexpected response from the snappy daemon")
+
+// the actions that can be done with a package
+const (
+	ActionInstall  = "install"
+	ActionUpdate   = "update"
+	ActionRollback = "rollback"
+	ActionRemove   = "remove"
+)
+
+// Action is the body of a request that changes a package
+type Action struct {
+	Action string `json:"action"`
+	// Version is the version to roll back to (the previous one if
+	// it is empty)
+	Version string `json:"version,omitempty"`
+	// AllowUnauthenticated installs packages that can not be
+	// authenticated
+	AllowUnauthenticated bool `json:"allow-unauthenticated,omitempty"`
+	// NoGC does not clean up old versions of the package
+	NoGC bool `json:"no-gc,omitempty"`
+	// LicenseAgreed agrees to the license of the package, if it has
+	// one that needs to be agreed to
+	LicenseAgreed bool `json:"license-agreed,omitempty"`
+	// Refresh does not use the cached store data to find the updates
+	// of all packages
+	Refresh bool `json:"refresh,omitempty"`
+	// Jobs is the number of concurrent downloads of the updates of all
+	// packages
+	Jobs int `json:"jobs,omitempty"`
+}
+
+// HardwareAction is the body of a request that assigns hardware to a
+// package
+type HardwareAction struct {
+	Device string `json:"device"`
+}
+
+// ConfigAction is the body of a request that configures a package
+type ConfigAction struct {
+	Config string `json:"config"`
+}
+
+// Client talks to the snappy daemon
+type Client struct {
+	http *http.Client
+}
+
+// New returns a client for the daemon listening on the given socket,
+// DefaultSocket if it is empty
+func New(socket string) *Client {
+	if socket == "" {
+		socket = DefaultSocket
+	}
+
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				Dial: func(_, _ string) (net.Conn, error) {
+					return net.Dial("unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// do sends the request with the given body (encoded as json unless nil)
+// and decodes the response
+func (client *Client) do(method, urlPath string, query url.Values, body interface{}) (*Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := url.URL{
+		Scheme:   "http",
+		Host:     "localhost",
+		Path:     path.Join(APIVersion, urlPath),
+		RawQuery: query.Encode(),
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	rsp, err := client.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot talk to the snappy daemon: %s", err)
+	}
+	defer rsp.Body.Close()
+
+	var r Response
+	if err := json.NewDecoder(rsp.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+
+	if r.Type == ResponseTypeError {
+		var e Error
+		if err := json.Unmarshal(r.Result, &e); err != nil {
+			return nil, err
+		}
+		return nil, &e
+	}
+
+	return &r, nil
+}
+
+// doSync sends a request that is answered synchronously and decodes
+// the result into v
+func (client *Client) doSync(method, urlPath string, query url.Values, body, v interface{}) error {
+	r, err := client.do(method, urlPath, query, body)
+	if err != nil {
+		return err
+	}
+	if r.Type != ResponseTypeSync {
+		return ErrUnexpectedResponse
+	}
+	if v == nil {
+		return nil
+	}
+
+	return json.Unmarshal(r.Result, v)
+}
+
+// doAsync sends a request that starts an operation and returns the
+// operation
+func (client *Client) doAsync(method, urlPath string, query url.Values, body interface{}) (*Operation, error) {
+	r, err := client.do(method, urlPath, query, body)
+	if err != nil {
+		return nil, err
+	}
+	if r.Type != ResponseTypeAsync {
+		return nil, ErrUnexpectedResponse
+	}
+
+	var op Operation
+	if err := json.Unmarshal(r.Result, &op); err != nil {
+		return nil, err
+	}
+
+	return &op, nil
+}
+
+// Packages returns all the installed versions of all packages
+func (client *Client) Packages() ([]snappy.PartInfo, error) {
+	var parts []snappy.PartInfo
+	if err := client.doSync("GET", "/packages", nil, nil, &parts); err != nil {
+		return nil, err
+	}
+
+	return parts, nil
+}
+
+// Package returns the active version of the given package
+func (client *Client) Package(name string) (*snappy.PartInfo, error) {
+	var part snappy.PartInfo
+	if err := client.doSync("GET", path.Join("/packages", name), nil, nil, &part); err != nil {
+		return nil, err
+	}
+
+	return &part, nil
+}
+
+// PackageAction starts the given action (install, update, rollback or
+// remove) of the given package
+func (client *Client) PackageAction(name string, action *Action) (*Operation, error) {
+	return client.doAsync("POST", path.Join("/packages", name), nil, action)
+}
+
+// PackagesAction starts the given action with all packages, only update
+// is supported
+func (client *Client) PackagesAction(action *Action) (*Operation, error) {
+	return client.doAsync("POST", "/packages", nil, action)
+}
+
+// Config returns the configuration of the given package
+func (client *Client) Config(name string) (string, error) {
+	var config ConfigAction
+	if err := client.doSync("GET", path.Join("/packages", name, "config"), nil, nil, &config); err != nil {
+		return "", err
+	}
+
+	return config.Config, nil
+}
+
+// SetConfig starts to configure the given package, the result of the
+// operation is the new configuration
+func (client *Client) SetConfig(name, config string) (*Operation, error) {
+	return client.doAsync("PUT", path.Join("/packages", name, "config"), nil, &ConfigAction{Config: config})
+}
+
+// Hardware returns the devices the given package can access
+func (client *Client) Hardware(name string) ([]string, error) {
+	var devices []string
+	if err := client.doSync("GET", path.Join("/packages", name, "hardware"), nil, nil, &devices); err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// AssignHardware starts to allow the given package to access the given
+// device
+func (client *Client) AssignHardware(name, device string) (*Operation, error) {
+	return client.doAsync("POST", path.Join("/packages", name, "hardware"), nil, &HardwareAction{Device: device})
+}
+
+// UnassignHardware starts to deny the given package to access the given
+// device
+func (client *Client) UnassignHardware(name, device string) (*Operation, error) {
+	return client.doAsync("DELETE", path.Join("/packages", name, "hardware"), url.Values{"device": {device}}, nil)
+}
+
+// Operations returns the operations the daemon knows about
+func (client *Client) Operations() ([]*Operation, error) {
+	var ops []*Operation
+	if err := client.doSync("GET", "/operations", nil, nil, &ops); err != nil {
+		return nil, err
+	}
+
+	return ops, nil
+}
+
+// Operation returns the operation with the given id
+func (client *Client) Operation(id string) (*Operation, error) {
+	var op Operation
+	if err := client.doSync("GET", path.Join("/operations", id), nil, nil, &op); err != nil {
+		return nil, err
+	}
+
+	return &op, nil
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	. "launchpad.net/gocheck"
+)
+
+// Hook up gocheck into the "go test" runner
+func Test(t *testing.T) { TestingT(t) }
+
+type ClientTestSuite struct {
+	listener net.Listener
+	client   *Client
+	requests []*http.Request
+	rsp      []string
+}
+
+var _ = Suite(&ClientTestSuite{})
+
+func (s *ClientTestSuite) SetUpTest(c *C) {
+	socket := filepath.Join(c.MkDir(), "snappy.socket")
+	listener, err := net.Listen("unix", socket)
+	c.Assert(err, IsNil)
+	s.listener = listener
+	s.client = New(socket)
+	s.requests = nil
+	s.rsp = nil
+
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests = append(s.requests, r)
+		rsp := s.rsp[0]
+		if len(s.rsp) > 1 {
+			s.rsp = s.rsp[1:]
+		}
+		io.WriteString(w, rsp)
+	}))
+
+	pollInterval = 0
+}
+
+func (s *ClientTestSuite) TearDownTest(c *C) {
+	s.listener.Close()
+}
+
+func (s *ClientTestSuite) TestPackage(c *C) {
+	s.rsp = []string{`{"type": "sync", "status-code": 200, "result": {"name": "hello-world", "version": "1.0", "active": true}}`}
+
+	part, err := s.client.Package("hello-world")
+	c.Assert(err, IsNil)
+	c.Check(part.Name, Equals, "hello-world")
+	c.Check(part.Version, Equals, "1.0")
+	c.Check(part.Active, Equals, true)
+	c.Check(s.requests[0].URL.Path, Equals, "/1.0/packages/hello-world")
+}
+
+func (s *ClientTestSuite) TestError(c *C) {
+	s.rsp = []string{`{"type": "error", "status-code": 404, "result": {"message": "no package \"foo\" installed"}}`}
+
+	_, err := s.client.Package("foo")
+	c.Check(err, ErrorMatches, `no package "foo" installed`)
+}
+
+func (s *ClientTestSuite) TestUnexpectedResponse(c *C) {
+	s.rsp = []string{`{"type": "sync", "status-code": 200, "result": {}}`}
+
+	_, err := s.client.PackageAction("foo", &Action{Action: ActionInstall})
+	c.Check(err, Equals, ErrUnexpectedResponse)
+}
+
+func (s *ClientTestSuite) TestWait(c *C) {
+	s.rsp = []string{
+		`{"type": "sync", "status-code": 200, "result": {"id": "42", "status": "running", "progress": {"current": 1, "total": 2}}}`,
+		`{"type": "sync", "status-code": 200, "result": {"id": "42", "status": "failed", "err": "boom"}}`,
+	}
+
+	var seen []string
+	op, err := s.client.Wait("42", func(op *Operation) {
+		seen = append(seen, op.Status)
+	})
+	c.Check(err, ErrorMatches, "boom")
+	c.Check(op.Status, Equals, StatusFailed)
+	c.Check(seen, DeepEquals, []string{StatusRunning, StatusFailed})
+	c.Check(s.requests[0].URL.Path, Equals, "/1.0/operations/42")
+}
+
+func (s *ClientTestSuite) TestEvents(c *C) {
+	s.rsp = []string{"event: start\ndata: {\"operation\": \"42\", \"type\": \"start\", \"total\": 10}\n\n" +
+		"event: set\ndata: {\"operation\": \"42\", \"type\": \"set\", \"current\": 5, \"total\": 10}\n\n" +
+		"event: status\ndata: {\"operation\": \"42\", \"type\": \"status\", \"status\": \"succeeded\"}\n\n" +
+		"event: spin\ndata: {\"operation\": \"42\", \"type\": \"spin\"}\n\n"}
+
+	var types []string
+	err := s.client.Events("42", func(ev *Event) bool {
+		types = append(types, ev.Type)
+		return true
+	})
+	c.Assert(err, IsNil)
+	c.Check(types, DeepEquals, []string{EventStart, EventSet, EventStatus})
+	c.Check(s.requests[0].URL.Path, Equals, "/1.0/operations/42/events")
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// the types of the progress events of an operation, they follow the
+// calls of the progress.Meter of the operation, and a status event is
+// sent when the status of the operation changes
+const (
+	EventStart    = "start"
+	EventSet      = "set"
+	EventTotal    = "total"
+	EventSpin     = "spin"
+	EventNotify   = "notify"
+	EventFinished = "finished"
+	EventStatus   = "status"
+)
+
+// Event is a progress event of an operation
+type Event struct {
+	Operation string    `json:"operation"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	// Current and Total are set for start, set, total and finished
+	// events
+	Current float64 `json:"current,omitempty"`
+	Total   float64 `json:"total,omitempty"`
+	// Message is set for spin and notify events
+	Message string `json:"message,omitempty"`
+	// Status is set for status events
+	Status string `json:"status,omitempty"`
+	// Err is set for status events of failed operations
+	Err string `json:"err,omitempty"`
+}
+
+// Done returns true if this is the last event of the operation
+func (ev *Event) Done() bool {
+	return ev.Type == EventStatus && (ev.Status == StatusSucceeded || ev.Status == StatusFailed)
+}
+
+// Events calls the given function with each event of the operation with
+// the given id (or of all operations if the id is empty), as they
+// happen. For an operation it returns once the operation is done, for
+// all operations once the function returns false.
+func (client *Client) Events(id string, f func(ev *Event) bool) error {
+	urlPath := path.Join(APIVersion, "events")
+	if id != "" {
+		urlPath = path.Join(APIVersion, "operations", id, "events")
+	}
+	u := url.URL{Scheme: "http", Host: "localhost", Path: urlPath}
+
+	rsp, err := client.http.Get(u.String())
+	if err != nil {
+		return fmt.Errorf("cannot talk to the snappy daemon: %s", err)
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		var r Response
+		if err := json.NewDecoder(rsp.Body).Decode(&r); err != nil {
+			return err
+		}
+		var e Error
+		if err := json.Unmarshal(r.Result, &e); err != nil {
+			return err
+		}
+		return &e
+	}
+
+	// the events are sent as server-sent events, one "data:" line each
+	scanner := bufio.NewScanner(rsp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		var ev Event
+		if err := json.Unmarshal([]byte(strings.TrimSpace(line[len("data:"):])), &ev); err != nil {
+			return err
+		}
+		if !f(&ev) {
+			return nil
+		}
+		if id != "" && ev.Done() {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// the states of an operation
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Progress is the progress of an operation
+type Progress struct {
+	Current float64 `json:"current"`
+	Total   float64 `json:"total"`
+	// Message is the last message of the operation (e.g. what the
+	// spinner shows)
+	Message string `json:"message,omitempty"`
+}
+
+// LogEntry is a message of an operation
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Operation is a change of the system that the daemon does in the
+// background, the operations are done one after the other
+type Operation struct {
+	ID       string   `json:"id"`
+	Kind     string   `json:"kind"`
+	Package  string   `json:"package,omitempty"`
+	Status   string   `json:"status"`
+	Progress Progress `json:"progress"`
+	// Created is when the operation was queued, Started and Finished
+	// are not set until it was started or is done
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// Log are the messages of the operation (notifications and what
+	// the spinner showed)
+	Log []LogEntry `json:"log,omitempty"`
+	// Result is what the operation returned if it succeeded, its
+	// content depends on the kind of operation
+	Result json.RawMessage `json:"result,omitempty"`
+	// Err is the error of a failed operation
+	Err string `json:"err,omitempty"`
+}
+
+// Done returns true if the operation succeeded or failed
+func (op Operation) Done() bool {
+	return op.Status == StatusSucceeded || op.Status == StatusFailed
+}
+
+// pollInterval is how often Wait asks for the state of the operation
+var pollInterval = 250 * time.Millisecond
+
+// Wait waits for the operation with the given id to be done, the given
+// function (if any) is called with each state of the operation. A failed
+// operation is returned with its error as an *Error.
+func (client *Client) Wait(id string, update func(op *Operation)) (*Operation, error) {
+	for {
+		op, err := client.Operation(id)
+		if err != nil {
+			return nil, err
+		}
+		if update != nil {
+			update(op)
+		}
+
+		switch op.Status {
+		case StatusSucceeded:
+			return op, nil
+		case StatusFailed:
+			return op, &Error{Message: op.Err}
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
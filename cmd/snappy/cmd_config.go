@@ -18,13 +18,17 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 
+	"launchpad.net/snappy/client"
 	"launchpad.net/snappy/logger"
 	"launchpad.net/snappy/snappy"
+
+	"gopkg.in/yaml.v2"
 )
 
 type cmdConfig struct {
@@ -61,7 +65,12 @@ func (x *cmdConfig) Execute(args []string) (err error) {
 		return errors.New("package name is required")
 	}
 
-	newConfig, err := configurePackage(pkgName, configFile)
+	var newConfig string
+	if optionsData.UseDaemon {
+		newConfig, err = configurePackageViaDaemon(pkgName, configFile)
+	} else {
+		newConfig, err = configurePackage(pkgName, configFile)
+	}
 	if err == snappy.ErrPackageNotFound {
 		return fmt.Errorf("No snap: '%s' found", pkgName)
 	} else if err != nil {
@@ -69,6 +78,13 @@ func (x *cmdConfig) Execute(args []string) (err error) {
 	}
 
 	// output the new configuration
+	if structuredOutput() {
+		var config interface{}
+		if err := yaml.Unmarshal([]byte(newConfig), &config); err != nil {
+			return err
+		}
+		return printStructured(config)
+	}
 	fmt.Println(newConfig)
 
 	return nil
@@ -88,6 +104,34 @@ func configurePackage(pkgName, configFile string) (string, error) {
 	return snap.Config(config)
 }
 
+// configurePackageViaDaemon is configurePackage through the daemon
+func configurePackageViaDaemon(pkgName, configFile string) (string, error) {
+	config, err := readConfiguration(configFile)
+	if err != nil {
+		return "", err
+	}
+
+	c := client.New("")
+	if config == nil {
+		return c.Config(pkgName)
+	}
+
+	op, err := c.SetConfig(pkgName, string(config))
+	if err != nil {
+		return "", err
+	}
+	if op, err = waitOperation(c, op); err != nil {
+		return "", err
+	}
+
+	var result client.ConfigAction
+	if err := json.Unmarshal(op.Result, &result); err != nil {
+		return "", err
+	}
+
+	return result.Config, nil
+}
+
 func readConfiguration(configInput string) (config []byte, err error) {
 	switch configInput {
 	case "-":
@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"launchpad.net/snappy/priv"
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/snappy"
+)
+
+type cmdGC struct {
+	DryRun bool `long:"dry-run" description:"Only show what would be removed"`
+}
+
+const shortGCHelp = "Remove old versions of packages"
+
+const longGCHelp = `Removes the old versions of the given packages (or all packages) that their retention policy does not keep, and purges the data of versions that were removed before.
+
+The policy keeps two versions by default. It is set for all packages with the "gc" settings of "snappy config ubuntu-core" (keep-revisions, keep-days and max-disk-usage) and for a single package with "snappy set".
+`
+
+func init() {
+	_, err := parser.AddCommand("gc", shortGCHelp, longGCHelp, &cmdGC{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (x *cmdGC) Execute(args []string) (err error) {
+	if !x.DryRun {
+		privMutex := priv.New()
+		if err := privMutex.TryLock(); err != nil {
+			return err
+		}
+		defer privMutex.Unlock()
+	}
+
+	if len(args) == 0 {
+		args, err = gcPackageNames()
+		if err != nil {
+			return err
+		}
+	}
+
+	total := int64(0)
+	for _, name := range args {
+		plan, err := snappy.PlanGarbageCollection(name)
+		if err != nil {
+			return err
+		}
+
+		remove, purge := "Removing", "Purging"
+		if x.DryRun {
+			remove, purge = "Would remove", "Would purge"
+		}
+		for _, part := range plan.Parts {
+			fmt.Printf("%s %s %s\n", remove, snappy.Dirname(part), part.Version())
+		}
+		for _, dir := range plan.DataDirs {
+			fmt.Printf("%s %s\n", purge, dir)
+		}
+		total += plan.Size
+
+		if x.DryRun {
+			continue
+		}
+		if err := plan.Run(progress.MakeProgressBar(name)); err != nil {
+			return err
+		}
+	}
+
+	if x.DryRun {
+		fmt.Printf("Would reclaim %d bytes\n", total)
+	} else {
+		fmt.Printf("Reclaimed %d bytes\n", total)
+	}
+
+	return nil
+}
+
+// gcPackageNames returns the names of the installed packages that can
+// be garbage collected
+func gcPackageNames() ([]string, error) {
+	installed, err := snappy.NewMetaRepository().Installed()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, part := range installed {
+		if part.Type() == snappy.SnapTypeCore || seen[part.Name()] {
+			continue
+		}
+		seen[part.Name()] = true
+		names = append(names, part.Name())
+	}
+
+	return names, nil
+}
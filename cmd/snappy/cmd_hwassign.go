@@ -20,6 +20,7 @@ package main
 import (
 	"fmt"
 
+	"launchpad.net/snappy/client"
 	"launchpad.net/snappy/priv"
 	"launchpad.net/snappy/snappy"
 )
@@ -44,6 +45,19 @@ func init() {
 }
 
 func (x *cmdHWAssign) Execute(args []string) (err error) {
+	if optionsData.UseDaemon {
+		c := client.New("")
+		op, err := c.AssignHardware(x.Positional.PackageName, x.Positional.DevicePath)
+		if err != nil {
+			return err
+		}
+		if _, err := waitOperation(c, op); err != nil {
+			return err
+		}
+		fmt.Printf("'%s' is now allowed to access '%s'\n", x.Positional.PackageName, x.Positional.DevicePath)
+		return nil
+	}
+
 	privMutex := priv.New()
 	if err := privMutex.TryLock(); err != nil {
 		return err
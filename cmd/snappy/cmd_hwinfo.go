@@ -43,6 +43,12 @@ func init() {
 		&cmdHWInfoData)
 }
 
+// hwAccess is the structured output of "snappy hw-info" for a package
+type hwAccess struct {
+	Name     string   `json:"name" yaml:"name"`
+	Hardware []string `json:"hardware" yaml:"hardware"`
+}
+
 func outputHWAccessForPkgname(pkgname string, writePaths []string) {
 	if len(writePaths) == 0 {
 		fmt.Printf("'%s:' is not allowed to access additional hardware\n", pkgname)
@@ -57,13 +63,23 @@ func outputHWAccessForAll() error {
 		return err
 	}
 
+	access := []hwAccess{}
 	for _, snap := range installed {
 		writePaths, err := snappy.ListHWAccess(snap.Name())
-		if err == nil && len(writePaths) > 0 {
+		if err != nil || len(writePaths) == 0 {
+			continue
+		}
+		if structuredOutput() {
+			access = append(access, hwAccess{Name: snap.Name(), Hardware: writePaths})
+		} else {
 			outputHWAccessForPkgname(snap.Name(), writePaths)
 		}
 	}
 
+	if structuredOutput() {
+		return printStructured(access)
+	}
+
 	return nil
 }
 
@@ -81,6 +97,9 @@ func (x *cmdHWInfo) Execute(args []string) (err error) {
 		if err != nil {
 			return err
 		}
+		if structuredOutput() {
+			return printStructured([]hwAccess{{Name: pkgname, Hardware: append([]string{}, writePaths...)}})
+		}
 		outputHWAccessForPkgname(pkgname, writePaths)
 		return nil
 	}
@@ -65,6 +65,10 @@ func snapInfo(pkgname string, verbose bool) error {
 		return fmt.Errorf("No snap '%s' found", pkgname)
 	}
 
+	if structuredOutput() {
+		return printStructured(snappy.NewPartInfo(snap))
+	}
+
 	fmt.Printf("channel: %s\n", snap.Channel())
 	fmt.Printf("version: %s\n", snap.Version())
 	fmt.Printf("updated: %s\n", snap.Date())
@@ -87,11 +91,28 @@ func ubuntuCoreChannel() string {
 	return "unknown"
 }
 
+// systemInfo is the structured output of "snappy info"
+type systemInfo struct {
+	Release      string   `json:"release" yaml:"release"`
+	Architecture string   `json:"architecture" yaml:"architecture"`
+	Frameworks   []string `json:"frameworks" yaml:"frameworks"`
+	Apps         []string `json:"apps" yaml:"apps"`
+}
+
 func info() error {
 	release := ubuntuCoreChannel()
 	frameworks, _ := snappy.ActiveSnapNamesByType(snappy.SnapTypeFramework)
 	apps, _ := snappy.ActiveSnapNamesByType(snappy.SnapTypeApp)
 
+	if structuredOutput() {
+		return printStructured(systemInfo{
+			Release:      release,
+			Architecture: string(snappy.Architecture()),
+			Frameworks:   append([]string{}, frameworks...),
+			Apps:         append([]string{}, apps...),
+		})
+	}
+
 	fmt.Printf("release: %s\n", release)
 	fmt.Printf("architecture: %s\n", snappy.Architecture())
 	fmt.Printf("frameworks: %s\n", strings.Join(frameworks, ", "))
@@ -18,10 +18,12 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 
+	"launchpad.net/snappy/client"
 	"launchpad.net/snappy/priv"
 	"launchpad.net/snappy/progress"
 	"launchpad.net/snappy/snappy"
@@ -53,6 +55,10 @@ func (x *cmdInstall) Execute(args []string) (err error) {
 		return errors.New("package name is required")
 	}
 
+	if optionsData.UseDaemon {
+		return x.installViaDaemon(pkgName, configFile)
+	}
+
 	privMutex := priv.New()
 	if err := privMutex.TryLock(); err != nil {
 		return err
@@ -90,3 +96,40 @@ func (x *cmdInstall) Execute(args []string) (err error) {
 
 	return nil
 }
+
+func (x *cmdInstall) installViaDaemon(pkgName, configFile string) error {
+	fmt.Printf("Installing %s\n", pkgName)
+
+	op, err := daemonPackageAction(pkgName, &client.Action{
+		Action:               client.ActionInstall,
+		AllowUnauthenticated: x.AllowUnauthenticated,
+		NoGC:                 x.DisableGC,
+	})
+	if err != nil {
+		return err
+	}
+
+	if configFile != "" {
+		var result struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(op.Result, &result); err != nil {
+			return err
+		}
+		config, err := readConfiguration(configFile)
+		if err != nil {
+			return err
+		}
+
+		c := client.New("")
+		op, err := c.SetConfig(result.Name, string(config))
+		if err != nil {
+			return err
+		}
+		if _, err := waitOperation(c, op); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
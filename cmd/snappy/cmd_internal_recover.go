@@ -0,0 +1,46 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"launchpad.net/snappy/priv"
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/snappy"
+)
+
+type cmdInternalRecover struct {
+}
+
+func init() {
+	var cmdInternalRecover cmdInternalRecover
+	if _, err := parser.AddCommand("internal-recover", "internal", "internal", &cmdInternalRecover); err != nil {
+		// panic here as something must be terribly wrong if there is an
+		// error here
+		panic(err)
+	}
+}
+
+func (x *cmdInternalRecover) Execute(args []string) (err error) {
+	privMutex := priv.New()
+	if err := privMutex.TryLock(); err != nil {
+		return err
+	}
+	defer privMutex.Unlock()
+
+	return snappy.Recover(progress.MakeProgressBar("recovery"))
+}
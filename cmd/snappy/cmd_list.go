@@ -31,17 +31,18 @@ import (
 type cmdList struct {
 	Updates bool `short:"u" long:"updates" description:"Show available updates (requires network)"`
 	Verbose bool `short:"v" long:"verbose" description:"Show channel information and expand all fields"`
+	Refresh bool `long:"refresh" description:"Do not use the cached store data when looking for updates"`
 }
 
 const shortListHelp = `List active components installed on a snappy system`
 
 const longListHelp = `Provides a list of all active components installed on a snappy system
 
-If requested, the command will find out if there are updates for any of the components and indicate that by appending a * to the date. This will be slower as it requires a round trip to the app store on the network.
+If requested, the command will find out if there are updates for any of the components and indicate that by appending a * to the date. Held components (see "snappy set") are not updated and shown as held. This will be slower as it requires a round trip to the app store on the network.
 
 The developer information refers to non-mainline versions of a package (much like PPAs in deb-based Ubuntu). If the package is the primary version of that package in Ubuntu then the developer info is not shown. This allows one to identify packages which have custom, non-standard versions installed. As a special case, the “sideload” developer refers to packages installed manually on the system.
 
-When a verbose listing is requested, information about the channel used is displayed; which is one of alpha, beta, rc or stable, and all fields are fully expanded too. In some cases, older (inactive) versions of snappy packages will be installed, these will be shown in the verbose output and the active version indicated with a * appended to the name of the component.`
+When a verbose listing is requested, information about the channel used is displayed; which is one of stable, candidate, beta or edge (see "snappy set"), and all fields are fully expanded too. In some cases, older (inactive) versions of snappy packages will be installed, these will be shown in the verbose output and the active version indicated with a * appended to the name of the component.`
 
 func init() {
 	var cmdListData cmdList
@@ -66,11 +67,20 @@ func (x cmdList) list() error {
 	}
 
 	if x.Updates {
+		snappy.SetMetadataRefresh(x.Refresh)
 		updates, err := snappy.ListUpdates()
 		if err != nil {
 			return err
 		}
+		if structuredOutput() {
+			return printStructured(updatesList(installed, updates))
+		}
 		showUpdatesList(installed, updates, os.Stdout)
+	} else if structuredOutput() {
+		if !x.Verbose {
+			installed = activeParts(installed)
+		}
+		return printStructured(snappy.NewPartInfos(installed))
 	} else if x.Verbose {
 		showVerboseList(installed, os.Stdout)
 	} else {
@@ -80,6 +90,50 @@ func (x cmdList) list() error {
 	return err
 }
 
+// updateInfo is an installed part in the structured output of
+// "snappy list -u"
+type updateInfo struct {
+	snappy.PartInfo `yaml:",inline"`
+	// UpdateVersion is the version the part is updated to, if there
+	// is an update
+	UpdateVersion string `json:"update-version,omitempty" yaml:"update-version,omitempty"`
+	// Held is true if the part is not updated (see "snappy set"), until
+	// HeldUntil if that is set
+	Held      bool       `json:"held" yaml:"held"`
+	HeldUntil *time.Time `json:"held-until,omitempty" yaml:"held-until,omitempty"`
+}
+
+func updatesList(installed []snappy.Part, updates []snappy.Part) []updateInfo {
+	infos := []updateInfo{}
+	for _, part := range activeParts(installed) {
+		info := updateInfo{PartInfo: snappy.NewPartInfo(part)}
+		if held, until := snappy.HeldUntil(part.Name()); held {
+			info.Held = true
+			if !until.IsZero() {
+				info.HeldUntil = &until
+			}
+		}
+		if update := snappy.FindSnapsByName(part.Name(), updates); len(update) == 1 {
+			info.UpdateVersion = update[0].Version()
+		}
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+// activeParts returns the active parts of the given parts
+func activeParts(parts []snappy.Part) []snappy.Part {
+	var active []snappy.Part
+	for _, part := range parts {
+		if part.IsActive() {
+			active = append(active, part)
+		}
+	}
+
+	return active
+}
+
 func formatDate(t time.Time) string {
 	return fmt.Sprintf("%v-%02d-%02d", t.Year(), int(t.Month()), t.Day())
 }
@@ -101,7 +155,7 @@ func showInstalledList(installed []snappy.Part, o io.Writer) {
 func showVerboseList(installed []snappy.Part, o io.Writer) {
 	w := tabwriter.NewWriter(o, 5, 3, 1, ' ', 0)
 
-	fmt.Fprintln(w, "Name\tDate\tVersion\tDeveloper\t")
+	fmt.Fprintln(w, "Name\tDate\tVersion\tDeveloper\tChannel\t")
 	for _, part := range installed {
 		active := ""
 		if part.IsActive() {
@@ -113,7 +167,7 @@ func showVerboseList(installed []snappy.Part, o io.Writer) {
 			active = "!"
 		}
 
-		fmt.Fprintln(w, fmt.Sprintf("%s%s\t%s\t%s\t%s%s\t", part.Name(), needsReboot, formatDate(part.Date()), part.Version(), part.Namespace(), active))
+		fmt.Fprintln(w, fmt.Sprintf("%s%s\t%s\t%s\t%s%s\t%s\t", part.Name(), needsReboot, formatDate(part.Date()), part.Version(), part.Namespace(), active, part.Channel()))
 	}
 	w.Flush()
 
@@ -164,11 +218,18 @@ func showUpdatesList(installed []snappy.Part, updates []snappy.Part, o io.Writer
 	w := tabwriter.NewWriter(o, 5, 3, 1, ' ', 0)
 	defer w.Flush()
 
-	fmt.Fprintln(w, "Name\tDate\tVersion\t")
+	fmt.Fprintln(w, "Name\tDate\tVersion\tHold\t")
 	for _, part := range installed {
 		if !part.IsActive() {
 			continue
 		}
+		hold := ""
+		if held, until := snappy.HeldUntil(part.Name()); held {
+			hold = "held"
+			if !until.IsZero() {
+				hold = "held until " + formatDate(until)
+			}
+		}
 		hasUpdate := ""
 		ver := part.Version()
 		date := part.Date()
@@ -178,6 +239,6 @@ func showUpdatesList(installed []snappy.Part, updates []snappy.Part, o io.Writer
 			ver = update[0].Version()
 			date = update[0].Date()
 		}
-		fmt.Fprintln(w, fmt.Sprintf("%s%s\t%v\t%s\t", part.Name(), hasUpdate, formatDate(date), ver))
+		fmt.Fprintln(w, fmt.Sprintf("%s%s\t%v\t%s\t%s\t", part.Name(), hasUpdate, formatDate(date), ver, hold))
 	}
 }
@@ -0,0 +1,64 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"launchpad.net/snappy/snappy"
+	"launchpad.net/snappy/systemd"
+)
+
+type cmdLogs struct {
+	Lines      int    `short:"n" long:"lines" description:"Show the given number of the most recent messages, all if 0" default:"10"`
+	Follow     bool   `short:"f" long:"follow" description:"Keep showing new messages as they are logged"`
+	Since      string `long:"since" description:"Only show the messages since the given time (e.g. \"2015-06-01 12:00\" or \"yesterday\")"`
+	Positional struct {
+		Spec string `positional-arg-name:"package[/service]" description:"The package, or a single service of it"`
+	} `required:"true" positional-args:"yes"`
+}
+
+const shortLogsHelp = `Show the logs of the services of a package`
+
+const longLogsHelp = `This command shows the messages in the journal of the services of a
+package, each one with the service that logged it.`
+
+func init() {
+	var cmdLogsData cmdLogs
+	_, _ = parser.AddCommand("logs",
+		shortLogsHelp,
+		longLogsHelp,
+		&cmdLogsData)
+}
+
+// logTimeFormat is how the time of a message is shown, like journalctl
+// does
+const logTimeFormat = "Jan 02 15:04:05"
+
+func (x *cmdLogs) Execute(args []string) error {
+	opts := &systemd.LogOptions{
+		Lines:  x.Lines,
+		Follow: x.Follow,
+		Since:  x.Since,
+	}
+
+	return snappy.ServiceLogs(x.Positional.Spec, opts, func(log *snappy.ServiceLog) {
+		fmt.Printf("%s %s: %s\n", log.Time.Format(logTimeFormat), log.Service, strings.TrimRight(log.Message, "\n"))
+	})
+}
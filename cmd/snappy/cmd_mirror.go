@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/release"
+	"launchpad.net/snappy/snappy"
+)
+
+type cmdMirror struct {
+	Architecture string `long:"architecture" description:"Mirror the snaps for the given architecture instead of the one of this system"`
+	Release      string `long:"release" description:"Mirror the snaps for the given release (e.g. 15.04-core) instead of the one of this system"`
+	Frameworks   bool   `long:"with-frameworks" description:"Also mirror the frameworks the snaps need"`
+	Positional   struct {
+		Dir string `positional-arg-name:"dir" description:"The directory of the offline repository"`
+	} `positional-args:"yes"`
+}
+
+const longMirrorHelp = `Downloads snaps from the store into a directory that can be used as an
+offline repository (see /etc/snappy/sources.d). Snaps that are already in
+the directory are only downloaded again if there is a new version, if no
+package names are given all the snaps in the directory are refreshed.`
+
+func init() {
+	var cmdMirrorData cmdMirror
+	_, _ = parser.AddCommand("mirror",
+		"Mirror snaps into an offline repository",
+		longMirrorHelp,
+		&cmdMirrorData)
+}
+
+func (x *cmdMirror) Execute(args []string) (err error) {
+	dir := x.Positional.Dir
+
+	// FIXME patch goflags to allow for specific n required positional arguments
+	if dir == "" {
+		return errors.New("directory is required")
+	}
+
+	if x.Architecture != "" {
+		snappy.SetArchitecture(snappy.ArchitectureType(x.Architecture))
+	}
+	if x.Release != "" {
+		rel, err := parseRelease(x.Release)
+		if err != nil {
+			return err
+		}
+		release.Override(rel)
+	}
+
+	return mirror(dir, args, x.Frameworks)
+}
+
+// parseRelease parses a release string like 15.04-core
+func parseRelease(s string) (release.Release, error) {
+	l := strings.SplitN(s, "-", 2)
+	if len(l) != 2 || l[0] == "" || l[1] == "" {
+		return release.Release{}, fmt.Errorf("invalid release %q, expected e.g. 15.04-core", s)
+	}
+
+	return release.Release{Series: l[0], Flavor: l[1]}, nil
+}
+
+func mirror(dir string, names []string, withFrameworks bool) error {
+	m, err := snappy.NewMirror(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(names) == 0 {
+		names = m.Names()
+	}
+
+	var mirrored []snappy.Part
+	seen := make(map[string]bool)
+	for i := 0; i < len(names); i++ {
+		name := names[i]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		fmt.Printf("Mirroring %s\n", name)
+		part, frameworks, err := m.Add(name, progress.MakeProgressBar(name))
+		if err != nil {
+			// keep what we got so far
+			m.Save()
+			return err
+		}
+		mirrored = append(mirrored, part)
+
+		if withFrameworks {
+			names = append(names, frameworks...)
+		}
+	}
+
+	if err := m.Save(); err != nil {
+		return err
+	}
+
+	if len(mirrored) > 0 {
+		showVerboseList(mirrored, os.Stdout)
+	}
+
+	return nil
+}
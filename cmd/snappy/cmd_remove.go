@@ -20,6 +20,7 @@ package main
 import (
 	"fmt"
 
+	"launchpad.net/snappy/client"
 	"launchpad.net/snappy/priv"
 	"launchpad.net/snappy/progress"
 	"launchpad.net/snappy/snappy"
@@ -38,6 +39,17 @@ func init() {
 }
 
 func (x *cmdRemove) Execute(args []string) (err error) {
+	if optionsData.UseDaemon {
+		for _, part := range args {
+			fmt.Printf("Removing %s\n", part)
+
+			if _, err := daemonPackageAction(part, &client.Action{Action: client.ActionRemove, NoGC: x.DisableGC}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
 	privMutex := priv.New()
 	if err := privMutex.TryLock(); err != nil {
 		return err
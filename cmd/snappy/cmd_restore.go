@@ -0,0 +1,70 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package main
+
+import (
+	"fmt"
+
+	"launchpad.net/snappy/priv"
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/snappy"
+)
+
+type cmdRestore struct {
+	Positional struct {
+		PackageName string `positional-arg-name:"package name" description:"The package to restore the data of"`
+		SnapshotID  string `positional-arg-name:"snapshot id" description:"The snapshot to restore (see snappy snapshot --list)"`
+	} `positional-args:"yes"`
+}
+
+const shortRestoreHelp = "Restore the data of a package from a snapshot"
+
+const longRestoreHelp = `Replaces the data of a package with the data saved by "snappy snapshot". The data of the version the snapshot was taken of is replaced, the package is stopped while its data is restored.
+`
+
+func init() {
+	var cmdRestoreData cmdRestore
+	_, _ = parser.AddCommand("restore",
+		shortRestoreHelp,
+		longRestoreHelp,
+		&cmdRestoreData)
+}
+
+func (x *cmdRestore) Execute(args []string) (err error) {
+	pkg := x.Positional.PackageName
+	id := x.Positional.SnapshotID
+	if pkg == "" {
+		return errNeedPackageName
+	}
+	if id == "" {
+		return errNeedSnapshotID
+	}
+
+	privMutex := priv.New()
+	if err := privMutex.TryLock(); err != nil {
+		return err
+	}
+	defer privMutex.Unlock()
+
+	snapshot, err := snappy.RestoreSnapshot(pkg, id, progress.MakeProgressBar(pkg))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored the data of %s %s from snapshot %d\n", snapshot.Dirname(), snapshot.Version, snapshot.ID)
+
+	return nil
+}
@@ -18,9 +18,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 
+	"launchpad.net/snappy/client"
 	"launchpad.net/snappy/priv"
+	"launchpad.net/snappy/progress"
 	"launchpad.net/snappy/snappy"
 )
 
@@ -45,6 +48,10 @@ func init() {
 }
 
 func (x *cmdRollback) Execute(args []string) (err error) {
+	if optionsData.UseDaemon {
+		return x.rollbackViaDaemon()
+	}
+
 	privMutex := priv.New()
 	if err := privMutex.TryLock(); err != nil {
 		return err
@@ -57,7 +64,7 @@ func (x *cmdRollback) Execute(args []string) (err error) {
 		return errNeedPackageName
 	}
 
-	nowVersion, err := snappy.Rollback(pkg, version)
+	nowVersion, err := snappy.Rollback(pkg, version, progress.MakeProgressBar(pkg))
 	if err != nil {
 		return err
 	}
@@ -65,3 +72,25 @@ func (x *cmdRollback) Execute(args []string) (err error) {
 
 	return nil
 }
+
+func (x *cmdRollback) rollbackViaDaemon() error {
+	pkg := x.Positional.PackageName
+	if pkg == "" {
+		return errNeedPackageName
+	}
+
+	op, err := daemonPackageAction(pkg, &client.Action{Action: client.ActionRollback, Version: x.Positional.Version})
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(op.Result, &result); err != nil {
+		return err
+	}
+	fmt.Printf("Setting %s to version %s\n", pkg, result.Version)
+
+	return nil
+}
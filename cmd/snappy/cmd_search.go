@@ -20,6 +20,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"sort"
 	"text/tabwriter"
 
 	"launchpad.net/snappy/snappy"
@@ -44,11 +45,34 @@ func (x *cmdSearch) Execute(args []string) (err error) {
 }
 
 func search(args []string, allVariants bool) error {
+	// show what was found even if some of the sources failed
 	results, err := snappy.Search(args)
-	if err != nil {
+	if _, ok := err.(*snappy.ErrSearchFailed); ok && len(results) > 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", err)
+	} else if err != nil {
 		return err
 	}
 
+	if structuredOutput() {
+		// sort the names so that the output is stable
+		names := make([]string, 0, len(results))
+		for name := range results {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var parts []snappy.Part
+		for _, name := range names {
+			sharedName := results[name]
+			if part := sharedName.Alias; !allVariants && part != nil {
+				parts = append(parts, part)
+			} else {
+				parts = append(parts, sharedName.Parts...)
+			}
+		}
+		return printStructured(snappy.NewPartInfos(parts))
+	}
+
 	w := tabwriter.NewWriter(os.Stdout, 5, 3, 1, ' ', 0)
 	defer w.Flush()
 
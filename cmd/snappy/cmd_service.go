@@ -0,0 +1,143 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"launchpad.net/snappy/priv"
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/snappy"
+)
+
+type cmdService struct{}
+
+// serviceSpec is the positional argument of the service commands
+type serviceSpec struct {
+	Spec string `positional-arg-name:"package[/service]" description:"The package, or a single service of it"`
+}
+
+type cmdServiceStatus struct {
+	Positional serviceSpec `positional-args:"yes"`
+}
+
+// cmdServiceAction is one of the service commands that change the
+// services
+type cmdServiceAction struct {
+	Positional serviceSpec `required:"true" positional-args:"yes"`
+
+	action    string
+	shortHelp string
+	do        func(spec string, meter progress.Meter) error
+	done      string
+}
+
+const shortServiceHelp = `Query and modify the services of the installed packages`
+
+const longServiceHelp = `This command shows the state of the services of the installed packages,
+and starts, stops, restarts, enables or disables them.
+
+Disabled services are not started on boot, and stay disabled when the
+package is updated.`
+
+func init() {
+	var cmdServiceData cmdService
+	cmd, _ := parser.AddCommand("service",
+		shortServiceHelp,
+		longServiceHelp,
+		&cmdServiceData)
+
+	var cmdServiceStatusData cmdServiceStatus
+	cmd.AddCommand("status",
+		"Show the state of the services",
+		"Shows the state of the services of a package, or of all packages.",
+		&cmdServiceStatusData)
+
+	for _, action := range []*cmdServiceAction{
+		{action: "start", shortHelp: "Start the services", do: snappy.StartServices, done: "Started"},
+		{action: "stop", shortHelp: "Stop the services", do: snappy.StopServices, done: "Stopped"},
+		{action: "restart", shortHelp: "Restart the services", do: snappy.RestartServices, done: "Restarted"},
+		{action: "enable", shortHelp: "Start the services on boot", do: snappy.EnableServices, done: "Enabled"},
+		{action: "disable", shortHelp: "Do not start the services on boot", do: snappy.DisableServices, done: "Disabled"},
+	} {
+		cmd.AddCommand(action.action,
+			action.shortHelp,
+			fmt.Sprintf("This command runs %q for the services of a package.", action.action),
+			action)
+	}
+}
+
+func (x *cmdServiceStatus) Execute(args []string) error {
+	statuses, err := snappy.ServicesStatus(x.Positional.Spec)
+	if err != nil {
+		return err
+	}
+
+	if structuredOutput() {
+		return printStructured(statuses)
+	}
+	showServicesStatus(statuses, os.Stdout)
+
+	return nil
+}
+
+// formatUptime returns how long a service is active, rounded to seconds
+func formatUptime(since time.Time) string {
+	if since.IsZero() {
+		return "-"
+	}
+
+	return (time.Since(since) / time.Second * time.Second).String()
+}
+
+func showServicesStatus(statuses []*snappy.ServiceStatus, o io.Writer) {
+	w := tabwriter.NewWriter(o, 5, 3, 1, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "Package\tService\tEnabled\tState\tPID\tUptime\t")
+	for _, st := range statuses {
+		enabled := "no"
+		if st.Enabled {
+			enabled = "yes"
+		}
+		pid := "-"
+		if st.PID != 0 {
+			pid = fmt.Sprint(st.PID)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s (%s)\t%s\t%s\t\n", st.Package, st.Service, enabled, st.ActiveState, st.SubState, pid, formatUptime(st.Since))
+	}
+}
+
+func (x *cmdServiceAction) Execute(args []string) error {
+	privMutex := priv.New()
+	if err := privMutex.TryLock(); err != nil {
+		return err
+	}
+	defer privMutex.Unlock()
+
+	if err := x.do(x.Positional.Spec, progress.MakeProgressBar(x.Positional.Spec)); err != nil {
+		return err
+	}
+	fmt.Printf("%s %s\n", x.done, x.Positional.Spec)
+
+	return nil
+}
@@ -21,19 +21,35 @@ import (
 	"fmt"
 	"strings"
 
+	"launchpad.net/snappy/priv"
+	"launchpad.net/snappy/progress"
 	"launchpad.net/snappy/snappy"
 )
 
 type cmdSet struct {
+	Refresh bool `long:"refresh" description:"Update the package right away after changing its channel."`
 }
 
 const setHelp = `Set properties of system or package
 
 Supported properties are:
   active=VERSION
+  channel=CHANNEL (one of stable, candidate, beta or edge)
+  hold=true|false|DATE (keep the package at its version, if DATE is given as YYYY-MM-DD it is updated again from that day on)
+  keep-revisions=N (the number of versions "snappy gc" keeps)
+  keep-days=N (keep the versions that are younger than N days)
+  max-disk-usage=SIZE (remove old versions if the package uses more than SIZE, e.g. 500M)
+  memory-limit=SIZE (the memory each service and binary may use, e.g. 64M)
+  cpu-quota=PERCENT (the share of the time of one CPU each service and binary may use)
+  tasks-max=N (the number of processes and threads each service may have)
+  io-weight=N (the weight of the disk IO of each service and binary, 10 to 1000)
 
 Example:
   set hello-world active=1.0
+  set hello-world channel=stable
+  set hello-world hold=2015-12-31
+  set hello-world keep-revisions=3
+  set hello-world memory-limit=128M
 `
 
 func init() {
@@ -45,16 +61,53 @@ func init() {
 }
 
 func (x *cmdSet) Execute(args []string) (err error) {
-	return set(args)
+	if x.Refresh {
+		privMutex := priv.New()
+		if err := privMutex.TryLock(); err != nil {
+			return err
+		}
+		defer privMutex.Unlock()
+	}
+
+	return set(args, x.Refresh)
 }
 
-func set(args []string) (err error) {
+func set(args []string, refresh bool) (err error) {
 	pkgname, args, err := parseSetPropertyCmdline(args...)
 	if err != nil {
 		return err
 	}
 
-	return snappy.SetProperty(pkgname, args...)
+	if err := snappy.SetProperty(pkgname, args...); err != nil {
+		return err
+	}
+
+	if !refresh || !setsChannel(args) {
+		return nil
+	}
+
+	part, err := snappy.UpdateSnap(pkgname, snappy.DoInstallGC, progress.MakeProgressBar(pkgname))
+	if err != nil {
+		return err
+	}
+	if part == nil {
+		fmt.Printf("%s is up to date\n", pkgname)
+		return nil
+	}
+	fmt.Printf("%s is now at version %s\n", pkgname, part.Version())
+
+	return nil
+}
+
+// setsChannel returns true if one of the given properties is the channel
+func setsChannel(args []string) bool {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "channel=") {
+			return true
+		}
+	}
+
+	return false
 }
 
 func parseSetPropertyCmdline(args ...string) (pkgname string, out []string, err error) {
@@ -0,0 +1,108 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"launchpad.net/snappy/priv"
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/snappy"
+)
+
+type cmdSnapshot struct {
+	List   bool   `long:"list" description:"List the snapshots of the package"`
+	Forget string `long:"forget" description:"Remove the snapshot with the given id" value-name:"ID"`
+	Keep   int    `long:"keep" description:"Only keep the given number of snapshots, the oldest ones are removed" value-name:"N"`
+
+	Positional struct {
+		PackageName string `positional-arg-name:"package name" description:"The package (name[.developer][=version]) to snapshot"`
+	} `positional-args:"yes"`
+}
+
+const shortSnapshotHelp = "Save the data of a package"
+
+const longSnapshotHelp = `Saves the data of a package (the system data and the data in the homes of the users) in a compressed archive that "snappy restore" can bring back, e.g. after a bad data migration. The data of the active version is saved unless a version is given as name=version. The package is stopped while its data is saved.
+`
+
+func init() {
+	var cmdSnapshotData cmdSnapshot
+	_, _ = parser.AddCommand("snapshot",
+		shortSnapshotHelp,
+		longSnapshotHelp,
+		&cmdSnapshotData)
+}
+
+func (x *cmdSnapshot) Execute(args []string) (err error) {
+	pkg := x.Positional.PackageName
+	if pkg == "" {
+		return errNeedPackageName
+	}
+
+	if x.List {
+		snapshots, err := snappy.Snapshots(pkg)
+		if err != nil {
+			return err
+		}
+		showSnapshots(snapshots)
+		return nil
+	}
+
+	privMutex := priv.New()
+	if err := privMutex.TryLock(); err != nil {
+		return err
+	}
+	defer privMutex.Unlock()
+
+	if x.Forget != "" {
+		if err := snappy.ForgetSnapshot(pkg, x.Forget); err != nil {
+			return err
+		}
+		fmt.Printf("Removed snapshot %s of %s\n", x.Forget, pkg)
+		return nil
+	}
+
+	snapshot, err := snappy.NewSnapshot(pkg, progress.MakeProgressBar(pkg))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Saved the data of %s %s as snapshot %d\n", snapshot.Dirname(), snapshot.Version, snapshot.ID)
+
+	if x.Keep > 0 {
+		pruned, err := snappy.PruneSnapshots(snapshot.Dirname(), x.Keep)
+		if err != nil {
+			return err
+		}
+		for _, old := range pruned {
+			fmt.Printf("Removed snapshot %d of %s\n", old.ID, old.Dirname())
+		}
+	}
+
+	return nil
+}
+
+func showSnapshots(snapshots []*snappy.Snapshot) {
+	w := tabwriter.NewWriter(os.Stdout, 5, 3, 1, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "Id\tName\tVersion\tDate\tSize\t")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t\n", snapshot.ID, snapshot.Dirname(), snapshot.Version, snapshot.Created.Format("2006-01-02 15:04"), snapshot.Size)
+	}
+}
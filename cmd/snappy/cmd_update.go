@@ -18,11 +18,13 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"strings"
 
+	"launchpad.net/snappy/client"
 	"launchpad.net/snappy/priv"
 	"launchpad.net/snappy/progress"
 	"launchpad.net/snappy/snappy"
@@ -31,6 +33,8 @@ import (
 type cmdUpdate struct {
 	DisableGC  bool `long:"no-gc" description:"Do not clean up old versions of the package."`
 	AutoReboot bool `long:"automatic-reboot" description:"Reboot if necessary to be on the latest running system."`
+	Refresh    bool `long:"refresh" description:"Do not use the cached store data when looking for updates."`
+	Jobs       int  `long:"jobs" short:"j" description:"Number of concurrent downloads." default:"3"`
 }
 
 func init() {
@@ -49,6 +53,10 @@ const (
 )
 
 func (x *cmdUpdate) Execute(args []string) (err error) {
+	if optionsData.UseDaemon {
+		return x.updateViaDaemon()
+	}
+
 	privMutex := priv.New()
 	if err := privMutex.TryLock(); err != nil {
 		return err
@@ -61,19 +69,16 @@ func (x *cmdUpdate) Execute(args []string) (err error) {
 		flags = 0
 	}
 
+	snappy.SetMetadataRefresh(x.Refresh)
 	updates, err := snappy.ListUpdates()
 	if err != nil {
 		return err
 	}
 
-	for _, part := range updates {
-		fmt.Printf("Installing %s (%s)\n", part.Name(), part.Version())
-		if _, err := part.Install(progress.MakeProgressBar(part.Name()), flags); err != nil {
-			return err
-		}
-		if err := snappy.GarbageCollect(part.Name(), flags); err != nil {
-			return err
-		}
+	// download (and verify) everything, then install everything or
+	// nothing
+	if err := snappy.UpdateParts(updates, x.Jobs, flags, progress.MakeProgressBar(fmt.Sprintf("%d updates", len(updates)))); err != nil {
+		return err
 	}
 
 	if len(updates) > 0 {
@@ -81,24 +86,72 @@ func (x *cmdUpdate) Execute(args []string) (err error) {
 	}
 
 	if x.AutoReboot {
+		return rebootIfNeeded()
+	}
+
+	return nil
+}
+
+// updateViaDaemon updates all parts through the daemon, which does
+// it like a local update
+func (x *cmdUpdate) updateViaDaemon() error {
+	c := client.New("")
+	op, err := c.PackagesAction(&client.Action{
+		Action:  client.ActionUpdate,
+		NoGC:    x.DisableGC,
+		Refresh: x.Refresh,
+		Jobs:    x.Jobs,
+	})
+	if err != nil {
+		return err
+	}
+	if op, err = waitOperation(c, op); err != nil {
+		return err
+	}
+
+	var infos []snappy.PartInfo
+	if err := json.Unmarshal(op.Result, &infos); err != nil {
+		return err
+	}
+	if len(infos) > 0 {
 		installed, err := snappy.ListInstalled()
 		if err != nil {
 			return err
 		}
+		var updated []snappy.Part
+		for _, info := range infos {
+			updated = append(updated, snappy.FindSnapsByNameAndVersion(info.Name, info.Version, installed)...)
+		}
+		showVerboseList(updated, os.Stdout)
+	}
+
+	if x.AutoReboot {
+		return rebootIfNeeded()
+	}
 
-		var rebootTriggers []string
-		for _, part := range installed {
-			if part.NeedsReboot() {
-				rebootTriggers = append(rebootTriggers, part.Name())
-			}
+	return nil
+}
+
+// rebootIfNeeded schedules a reboot if one of the installed parts needs
+// one to be up to date
+func rebootIfNeeded() error {
+	installed, err := snappy.ListInstalled()
+	if err != nil {
+		return err
+	}
+
+	var rebootTriggers []string
+	for _, part := range installed {
+		if part.NeedsReboot() {
+			rebootTriggers = append(rebootTriggers, part.Name())
 		}
+	}
 
-		if len(rebootTriggers) != 0 {
-			fmt.Println("Rebooting to satisfy updates for", strings.Join(rebootTriggers, ", "))
-			cmd := exec.Command(shutdownCmd, shutdownTimeout, "-r", shutdownMsg)
-			if out, err := cmd.CombinedOutput(); err != nil {
-				return fmt.Errorf("failed to auto reboot: %s", out)
-			}
+	if len(rebootTriggers) != 0 {
+		fmt.Println("Rebooting to satisfy updates for", strings.Join(rebootTriggers, ", "))
+		cmd := exec.Command(shutdownCmd, shutdownTimeout, "-r", shutdownMsg)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to auto reboot: %s", out)
 		}
 	}
 
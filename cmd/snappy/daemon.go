@@ -0,0 +1,81 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"launchpad.net/snappy/client"
+	"launchpad.net/snappy/progress"
+)
+
+// waitOperation waits for the given operation of the daemon and shows
+// its progress events
+func waitOperation(c *client.Client, op *client.Operation) (*client.Operation, error) {
+	pbar := progress.MakeProgressBar(op.Package)
+	started := false
+
+	err := c.Events(op.ID, func(ev *client.Event) bool {
+		switch ev.Type {
+		case client.EventStart:
+			pbar.Start(ev.Total)
+			started = true
+		case client.EventSet, client.EventTotal:
+			// the stream may start in the middle of a download
+			if !started {
+				pbar.Start(ev.Total)
+				started = true
+			}
+			pbar.SetTotal(ev.Total)
+			pbar.Set(ev.Current)
+		case client.EventFinished:
+			if started {
+				pbar.Finished()
+				started = false
+			}
+		case client.EventSpin:
+			pbar.Spin(ev.Message)
+		case client.EventNotify:
+			pbar.Notify(ev.Message)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	op, err = c.Operation(op.ID)
+	if err != nil {
+		return nil, err
+	}
+	if op.Status == client.StatusFailed {
+		return op, &client.Error{Message: op.Err}
+	}
+
+	return op, nil
+}
+
+// daemonPackageAction does the given action with the given package
+// through the daemon
+func daemonPackageAction(name string, action *client.Action) (*client.Operation, error) {
+	c := client.New("")
+	op, err := c.PackageAction(name, action)
+	if err != nil {
+		return nil, err
+	}
+
+	return waitOperation(c, op)
+}
@@ -21,4 +21,5 @@ import "errors"
 
 var (
 	errNeedPackageName = errors.New("need package name argument")
+	errNeedSnapshotID  = errors.New("need snapshot id argument")
 )
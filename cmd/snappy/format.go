@@ -0,0 +1,88 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v2"
+)
+
+// the values of the global --format option
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+// structuredOutput returns true if the output should be json or yaml
+// instead of text
+func structuredOutput() bool {
+	return optionsData.Format == formatJSON || optionsData.Format == formatYAML
+}
+
+// printStructured writes v to stdout in the format given with --format
+func printStructured(v interface{}) error {
+	return writeStructured(os.Stdout, optionsData.Format, v)
+}
+
+// writeStructured writes v to w as json or yaml
+func writeStructured(w io.Writer, format string, v interface{}) error {
+	switch format {
+	case formatJSON:
+		data, err := json.MarshalIndent(jsonCompatible(v), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case formatYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// jsonCompatible converts the maps with interface{} keys that yaml
+// unmarshals into maps with string keys that can be marshalled as json
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = jsonCompatible(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, val := range v {
+			l[i] = jsonCompatible(val)
+		}
+		return l
+	}
+
+	return v
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v2"
+
+	. "launchpad.net/gocheck"
+)
+
+func (s *CmdTestSuite) TestWriteStructured(c *C) {
+	info := systemInfo{
+		Release:      "15.04/edge",
+		Architecture: "amd64",
+		Frameworks:   []string{},
+		Apps:         []string{"hello-world"},
+	}
+
+	var buf bytes.Buffer
+	c.Assert(writeStructured(&buf, formatJSON, info), IsNil)
+	c.Check(buf.String(), Equals, `{
+  "release": "15.04/edge",
+  "architecture": "amd64",
+  "frameworks": [],
+  "apps": [
+    "hello-world"
+  ]
+}
+`)
+
+	buf.Reset()
+	c.Assert(writeStructured(&buf, formatYAML, info), IsNil)
+	c.Check(buf.String(), Equals, `release: 15.04/edge
+architecture: amd64
+frameworks: []
+apps:
+- hello-world
+`)
+
+	c.Check(writeStructured(&buf, formatText, info), NotNil)
+}
+
+func (s *CmdTestSuite) TestWriteStructuredConfig(c *C) {
+	var config interface{}
+	c.Assert(yaml.Unmarshal([]byte("config:\n  hello-world:\n    greeting: hi\n"), &config), IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(writeStructured(&buf, formatJSON, config), IsNil)
+	c.Check(buf.String(), Equals, `{
+  "config": {
+    "hello-world": {
+      "greeting": "hi"
+    }
+  }
+}
+`)
+}
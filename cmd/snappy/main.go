@@ -23,6 +23,7 @@ import (
 	"os"
 
 	"launchpad.net/snappy/priv"
+	"launchpad.net/snappy/progress"
 	"launchpad.net/snappy/snappy"
 
 	"launchpad.net/snappy/logger"
@@ -34,7 +35,10 @@ import (
 var ErrRequiresRoot = errors.New("command requires sudo (root)")
 
 type options struct {
-	// No global options yet
+	UseDaemon  bool           `long:"use-daemon" description:"Install, update, remove, roll back and configure packages and assign hardware through the snappy daemon (snappyd)"`
+	Format     string         `long:"format" description:"Output format of list, info, hw-info, search, config and service status (see docs/output-formats.md)" choice:"text" choice:"json" choice:"yaml" default:"text"`
+	Progress   progressFormat `long:"progress" description:"How to show the progress, json writes newline-delimited JSON events (see docs/progress.md)" choice:"text" choice:"json" default:"text"`
+	ProgressFD progressFD     `long:"progress-fd" description:"The file descriptor the JSON progress events are written to, stderr by default" default:"2"`
 }
 
 var optionsData options
@@ -48,7 +52,28 @@ func init() {
 	}
 }
 
+// recoverInterrupted finishes or undoes installs and updates that were
+// interrupted, this needs root and is skipped if another snappy holds
+// the lock (it may be the one doing the install)
+func recoverInterrupted() {
+	if os.Getuid() != 0 || !snappy.NeedsRecovery() {
+		return
+	}
+
+	privMutex := priv.New()
+	if err := privMutex.TryLock(); err != nil {
+		return
+	}
+	defer privMutex.Unlock()
+
+	if err := snappy.Recover(progress.MakeProgressBar("recovery")); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: failed to recover interrupted install: %s\n", err)
+	}
+}
+
 func main() {
+	recoverInterrupted()
+
 	if _, err := parser.Parse(); err != nil {
 		if err == priv.ErrNeedRoot {
 			// make the generic root error more specific for
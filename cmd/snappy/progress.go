@@ -0,0 +1,71 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"syscall"
+
+	"launchpad.net/snappy/progress"
+)
+
+const progressJSON = "json"
+
+// progressFormat is the --progress option, the progress meters are
+// chosen as soon as it is parsed as the commands make them themselves
+type progressFormat string
+
+// UnmarshalFlag sets the progress format
+func (p *progressFormat) UnmarshalFlag(value string) error {
+	*p = progressFormat(value)
+	useProgressOptions()
+
+	return nil
+}
+
+// progressFD is the --progress-fd option
+type progressFD int
+
+// UnmarshalFlag sets the file descriptor for the progress events
+func (p *progressFD) UnmarshalFlag(value string) error {
+	fd, err := strconv.Atoi(value)
+	if err != nil || fd < 0 {
+		return fmt.Errorf("invalid file descriptor %q", value)
+	}
+	*p = progressFD(fd)
+	useProgressOptions()
+
+	return nil
+}
+
+// Write writes to the file descriptor
+func (p progressFD) Write(b []byte) (int, error) {
+	return syscall.Write(int(p), b)
+}
+
+// useProgressOptions makes the progress meters follow the --progress and
+// --progress-fd options
+func useProgressOptions() {
+	if optionsData.Progress != progressJSON {
+		progress.UseJSON(nil)
+		return
+	}
+
+	progress.UseJSON(optionsData.ProgressFD)
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package main
+
+import (
+	"launchpad.net/snappy/progress"
+
+	. "launchpad.net/gocheck"
+)
+
+func (s *CmdTestSuite) TestProgressOptions(c *C) {
+	defer func() {
+		optionsData.Progress = ""
+		optionsData.ProgressFD = 0
+		progress.UseJSON(nil)
+	}()
+
+	// the events are not mixed with the output on stdout
+	c.Check(parser.FindOptionByLongName("progress-fd").Default, DeepEquals, []string{"2"})
+
+	c.Assert(optionsData.ProgressFD.UnmarshalFlag("3"), IsNil)
+	c.Check(optionsData.ProgressFD, Equals, progressFD(3))
+	c.Check(optionsData.ProgressFD.UnmarshalFlag("three"), ErrorMatches, `invalid file descriptor "three"`)
+
+	c.Assert(optionsData.Progress.UnmarshalFlag("json"), IsNil)
+	c.Check(progress.MakeProgressBar("foo"), FitsTypeOf, &progress.JSONProgress{})
+
+	c.Assert(optionsData.Progress.UnmarshalFlag("text"), IsNil)
+	c.Check(progress.MakeProgressBar("foo"), Not(FitsTypeOf), &progress.JSONProgress{})
+}
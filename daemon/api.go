@@ -0,0 +1,356 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"launchpad.net/snappy/client"
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/snappy"
+)
+
+// the snappy functions the api uses, useful to override for testing
+var (
+	snappyListInstalled   = snappy.ListInstalled
+	snappyActiveSnap      = snappy.ActiveSnapByName
+	snappyInstall         = snappy.Install
+	snappyUpdate          = updatePackage
+	snappyUpdateAll       = updateAll
+	snappyRollback        = snappy.Rollback
+	snappyRemove          = snappy.Remove
+	snappyListHWAccess    = snappy.ListHWAccess
+	snappyAddHWAccess     = snappy.AddHWAccess
+	snappyRemoveHWAccess  = snappy.RemoveHWAccess
+	snappyConfigureActive = func(name string, config []byte) (string, error) {
+		snap := snappy.ActiveSnapByName(name)
+		if snap == nil {
+			return "", snappy.ErrPackageNotFound
+		}
+		return snap.Config(config)
+	}
+)
+
+// updatePackage updates the given package to the version of its
+// channel, ubuntu-core is updated with system-image
+func updatePackage(name string, flags snappy.InstallFlags, meter progress.Meter) (snappy.Part, error) {
+	if part := snappy.ActiveSnapByName(name); part == nil || part.Type() != snappy.SnapTypeCore {
+		return snappy.UpdateSnap(name, flags, meter)
+	}
+
+	updates, err := snappy.ListUpdates()
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range updates {
+		if part.Type() == snappy.SnapTypeCore {
+			_, err := part.Install(meter, flags)
+			return part, err
+		}
+	}
+
+	return nil, nil
+}
+
+// defaultUpdateJobs is the number of concurrent downloads of updateAll
+// if the action does not say, like "snappy update"
+const defaultUpdateJobs = 3
+
+// updateAll updates all packages like "snappy update": the updates are
+// all downloaded first and then installed all or nothing. It returns
+// the updates.
+func updateAll(flags snappy.InstallFlags, jobs int, refresh bool, meter progress.Meter) ([]snappy.Part, error) {
+	snappy.SetMetadataRefresh(refresh)
+	defer snappy.SetMetadataRefresh(false)
+
+	updates, err := snappy.ListUpdates()
+	if err != nil {
+		return nil, err
+	}
+
+	return updates, snappy.UpdateParts(updates, jobs, flags, meter)
+}
+
+// decodeBody decodes the json body of the request into v
+func decodeBody(r *http.Request, v interface{}) *response {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest("cannot decode the request body: %s", err)
+	}
+
+	return nil
+}
+
+// startOperation queues the given operation and answers with it
+func (d *Daemon) startOperation(kind, pkg string, licenseAgreed bool, do operationFunc) *response {
+	op, err := d.queue.add(kind, pkg, licenseAgreed, do)
+	if err != nil {
+		return errorResponse(http.StatusServiceUnavailable, "%s", err)
+	}
+
+	return asyncResponse(op.state())
+}
+
+// apiRoot is "/1.0"
+func apiRoot(d *Daemon, r *http.Request) *response {
+	return syncResponse(map[string]string{"api": client.APIVersion[1:]})
+}
+
+// getPackages is "GET /1.0/packages", all installed versions of all
+// packages
+func getPackages(d *Daemon, r *http.Request) *response {
+	installed, err := snappyListInstalled()
+	if err != nil {
+		return internalError(err)
+	}
+
+	return syncResponse(snappy.NewPartInfos(installed))
+}
+
+// postPackages is "POST /1.0/packages", it starts to update all
+// packages
+func postPackages(d *Daemon, r *http.Request) *response {
+	var action client.Action
+	if rsp := decodeBody(r, &action); rsp != nil {
+		return rsp
+	}
+	if action.Action != client.ActionUpdate {
+		return badRequest("unknown action %q", action.Action)
+	}
+
+	flags := snappy.DoInstallGC
+	if action.NoGC {
+		flags = 0
+	}
+	jobs := action.Jobs
+	if jobs == 0 {
+		jobs = defaultUpdateJobs
+	}
+
+	return d.startOperation(action.Action, "", action.LicenseAgreed, func(meter progress.Meter) (interface{}, error) {
+		updates, err := snappyUpdateAll(flags, jobs, action.Refresh, meter)
+		if err != nil {
+			return nil, err
+		}
+		return snappy.NewPartInfos(updates), nil
+	})
+}
+
+// getPackage is "GET /1.0/packages/NAME", the active version of the
+// package
+func getPackage(d *Daemon, r *http.Request, name string) *response {
+	part := snappyActiveSnap(name)
+	if part == nil {
+		return notFound("no package %q installed", name)
+	}
+
+	return syncResponse(snappy.NewPartInfo(part))
+}
+
+// postPackage is "POST /1.0/packages/NAME", it starts to install,
+// update, roll back or remove the package
+func postPackage(d *Daemon, r *http.Request, name string) *response {
+	var action client.Action
+	if rsp := decodeBody(r, &action); rsp != nil {
+		return rsp
+	}
+
+	var do operationFunc
+	switch action.Action {
+	case client.ActionInstall:
+		flags := snappy.DoInstallGC
+		if action.NoGC {
+			flags = 0
+		}
+		if action.AllowUnauthenticated {
+			flags |= snappy.AllowUnauthenticated
+		}
+		do = func(meter progress.Meter) (interface{}, error) {
+			installed, err := snappyInstall(name, flags, meter)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"name": installed}, nil
+		}
+	case client.ActionUpdate:
+		flags := snappy.DoInstallGC
+		if action.NoGC {
+			flags = 0
+		}
+		do = func(meter progress.Meter) (interface{}, error) {
+			part, err := snappyUpdate(name, flags, meter)
+			if err != nil || part == nil {
+				return nil, err
+			}
+			return snappy.NewPartInfo(part), nil
+		}
+	case client.ActionRollback:
+		do = func(meter progress.Meter) (interface{}, error) {
+			version, err := snappyRollback(name, action.Version, meter)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]string{"version": version}, nil
+		}
+	case client.ActionRemove:
+		flags := snappy.DoRemoveGC
+		if action.NoGC {
+			flags = 0
+		}
+		do = func(meter progress.Meter) (interface{}, error) {
+			return nil, snappyRemove(name, flags, meter)
+		}
+	default:
+		return badRequest("unknown action %q", action.Action)
+	}
+
+	return d.startOperation(action.Action, name, action.LicenseAgreed, do)
+}
+
+// getConfig is "GET /1.0/packages/NAME/config", it needs root as it
+// runs the config hook of the package
+func getConfig(d *Daemon, r *http.Request, name string) *response {
+	if !isRoot(r) {
+		return errorResponse(http.StatusForbidden, "access denied, administrator privileges required")
+	}
+
+	config, err := snappyConfigureActive(name, nil)
+	if err == snappy.ErrPackageNotFound {
+		return notFound("no package %q installed", name)
+	}
+	if err != nil {
+		return internalError(err)
+	}
+
+	return syncResponse(&client.ConfigAction{Config: config})
+}
+
+// putConfig is "PUT /1.0/packages/NAME/config", it starts to configure
+// the package
+func putConfig(d *Daemon, r *http.Request, name string) *response {
+	var action client.ConfigAction
+	if rsp := decodeBody(r, &action); rsp != nil {
+		return rsp
+	}
+
+	return d.startOperation("config", name, false, func(meter progress.Meter) (interface{}, error) {
+		config, err := snappyConfigureActive(name, []byte(action.Config))
+		if err != nil {
+			return nil, err
+		}
+		return &client.ConfigAction{Config: config}, nil
+	})
+}
+
+// getHardware is "GET /1.0/packages/NAME/hardware", the devices the
+// package can access
+func getHardware(d *Daemon, r *http.Request, name string) *response {
+	devices, err := snappyListHWAccess(name)
+	if err != nil {
+		return internalError(err)
+	}
+	if devices == nil {
+		devices = []string{}
+	}
+
+	return syncResponse(devices)
+}
+
+// postHardware is "POST /1.0/packages/NAME/hardware", it starts to allow
+// the package to access a device
+func postHardware(d *Daemon, r *http.Request, name string) *response {
+	var action client.HardwareAction
+	if rsp := decodeBody(r, &action); rsp != nil {
+		return rsp
+	}
+	if action.Device == "" {
+		return badRequest("no device given")
+	}
+
+	return d.startOperation("hw-assign", name, false, func(meter progress.Meter) (interface{}, error) {
+		err := snappyAddHWAccess(name, action.Device)
+		if err == snappy.ErrHWAccessAlreadyAdded {
+			err = nil
+		}
+		return nil, err
+	})
+}
+
+// deleteHardware is "DELETE /1.0/packages/NAME/hardware?device=DEVICE",
+// it starts to deny the package to access a device
+func deleteHardware(d *Daemon, r *http.Request, name string) *response {
+	device := r.URL.Query().Get("device")
+	if device == "" {
+		return badRequest("no device given")
+	}
+
+	return d.startOperation("hw-unassign", name, false, func(meter progress.Meter) (interface{}, error) {
+		return nil, snappyRemoveHWAccess(name, device)
+	})
+}
+
+// getOperations is "GET /1.0/operations", it needs root as the
+// operations may contain the configuration of packages
+func getOperations(d *Daemon, r *http.Request) *response {
+	if !isRoot(r) {
+		return errorResponse(http.StatusForbidden, "access denied, administrator privileges required")
+	}
+
+	return syncResponse(d.queue.list())
+}
+
+// getOperation is "GET /1.0/operations/ID", it needs root like
+// getOperations
+func getOperation(d *Daemon, r *http.Request, id string) *response {
+	if !isRoot(r) {
+		return errorResponse(http.StatusForbidden, "access denied, administrator privileges required")
+	}
+
+	op := d.queue.get(id)
+	if op == nil {
+		return notFound("no operation %q", id)
+	}
+
+	return syncResponse(op.state())
+}
+
+// getOperationEvents is "GET /1.0/operations/ID/events", it streams the
+// events of the operation until it is done, it needs root like
+// getOperations
+func getOperationEvents(d *Daemon, r *http.Request, id string) http.Handler {
+	if !isRoot(r) {
+		return errorResponse(http.StatusForbidden, "access denied, administrator privileges required")
+	}
+
+	op := d.queue.get(id)
+	if op == nil {
+		return notFound("no operation %q", id)
+	}
+
+	return &eventStream{hub: d.queue.events, op: op}
+}
+
+// getEvents is "GET /1.0/events", it streams the events of all
+// operations, it needs root like getOperations
+func getEvents(d *Daemon, r *http.Request) http.Handler {
+	if !isRoot(r) {
+		return errorResponse(http.StatusForbidden, "access denied, administrator privileges required")
+	}
+
+	return &eventStream{hub: d.queue.events}
+}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package daemon implements snappyd, which serves the snappy operations
+// as a JSON/HTTP API on a unix socket (see docs/rest.md).
+package daemon
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"launchpad.net/snappy/client"
+)
+
+// Daemon serves the API, the operations that change the system are
+// done one after the other
+type Daemon struct {
+	listener net.Listener
+	queue    *operationQueue
+
+	mu       sync.Mutex
+	stopping bool
+}
+
+// New returns a new daemon
+func New() *Daemon {
+	return &Daemon{
+		queue: newOperationQueue(),
+	}
+}
+
+// Init creates the unix socket the daemon listens on, everyone can
+// connect to it but only root may change the system
+func (d *Daemon) Init(socket string) error {
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(socket, 0666); err != nil {
+		listener.Close()
+		return err
+	}
+	d.listener = &ucredListener{Listener: listener}
+
+	return nil
+}
+
+// Run serves the API until the daemon is stopped, it returns once the
+// queued operations are done
+func (d *Daemon) Run() error {
+	go d.queue.run()
+
+	err := http.Serve(d.listener, d)
+
+	// snappyd must not exit in the middle of a change
+	d.queue.stop()
+	<-d.queue.done
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopping {
+		return nil
+	}
+
+	return err
+}
+
+// Stop stops serving the API, the queued operations are still done
+// before Run returns
+func (d *Daemon) Stop() error {
+	d.mu.Lock()
+	d.stopping = true
+	d.mu.Unlock()
+
+	d.queue.stop()
+
+	return d.listener.Close()
+}
+
+// isRoot returns true if the request comes from root, useful to
+// override for testing
+var isRoot = func(r *http.Request) bool {
+	uid, err := ucredFromRemoteAddr(r.RemoteAddr)
+	return err == nil && uid == 0
+}
+
+// ServeHTTP dispatches the requests to the handlers of the api
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && !isRoot(r) {
+		errorResponse(http.StatusForbidden, "access denied, administrator privileges required").ServeHTTP(w, r)
+		return
+	}
+
+	d.route(r).ServeHTTP(w, r)
+}
+
+// route calls the handler for the method and path of the request
+func (d *Daemon) route(r *http.Request) http.Handler {
+	if r.URL.Path != client.APIVersion && !strings.HasPrefix(r.URL.Path, client.APIVersion+"/") {
+		return notFound("not found")
+	}
+	elems := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, client.APIVersion), "/"), "/")
+	if elems[0] == "" {
+		elems = nil
+	}
+
+	methodNotAllowed := errorResponse(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+
+	switch {
+	case len(elems) == 0:
+		if r.Method == "GET" {
+			return apiRoot(d, r)
+		}
+	case elems[0] == "packages" && len(elems) == 1:
+		switch r.Method {
+		case "GET":
+			return getPackages(d, r)
+		case "POST":
+			return postPackages(d, r)
+		}
+	case elems[0] == "packages" && len(elems) == 2:
+		switch r.Method {
+		case "GET":
+			return getPackage(d, r, elems[1])
+		case "POST":
+			return postPackage(d, r, elems[1])
+		}
+	case elems[0] == "packages" && len(elems) == 3 && elems[2] == "config":
+		switch r.Method {
+		case "GET":
+			return getConfig(d, r, elems[1])
+		case "PUT":
+			return putConfig(d, r, elems[1])
+		}
+	case elems[0] == "packages" && len(elems) == 3 && elems[2] == "hardware":
+		switch r.Method {
+		case "GET":
+			return getHardware(d, r, elems[1])
+		case "POST":
+			return postHardware(d, r, elems[1])
+		case "DELETE":
+			return deleteHardware(d, r, elems[1])
+		}
+	case elems[0] == "operations" && len(elems) == 1:
+		if r.Method == "GET" {
+			return getOperations(d, r)
+		}
+	case elems[0] == "operations" && len(elems) == 2:
+		if r.Method == "GET" {
+			return getOperation(d, r, elems[1])
+		}
+	case elems[0] == "operations" && len(elems) == 3 && elems[2] == "events":
+		if r.Method == "GET" {
+			return getOperationEvents(d, r, elems[1])
+		}
+	case elems[0] == "events" && len(elems) == 1:
+		if r.Method == "GET" {
+			return getEvents(d, r)
+		}
+	default:
+		return notFound("not found")
+	}
+
+	return methodNotAllowed
+}
@@ -0,0 +1,295 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"launchpad.net/snappy/client"
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/snappy"
+
+	. "launchpad.net/gocheck"
+)
+
+// Hook up gocheck into the "go test" runner
+func Test(t *testing.T) { TestingT(t) }
+
+type DaemonTestSuite struct {
+	d      *Daemon
+	root   bool
+	locked int
+}
+
+var _ = Suite(&DaemonTestSuite{})
+
+func (s *DaemonTestSuite) SetUpTest(c *C) {
+	s.d = New()
+	s.root = true
+	s.locked = 0
+	isRoot = func(*http.Request) bool { return s.root }
+	lockSystem = func() (func(), error) {
+		s.locked++
+		return func() { s.locked-- }, nil
+	}
+	snappy.SetRootDir(c.MkDir())
+	timeNow = func() time.Time { return time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC) }
+}
+
+func (s *DaemonTestSuite) TearDownTest(c *C) {
+	s.d.queue.stop()
+	snappy.SetRootDir("/")
+	timeNow = time.Now
+	snappyInstall = snappy.Install
+	snappyUpdateAll = updateAll
+	snappyRemove = snappy.Remove
+}
+
+// request sends the given request to the daemon and decodes the response
+func (s *DaemonTestSuite) request(c *C, method, path, body string) (*httptest.ResponseRecorder, *client.Response) {
+	req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+	c.Assert(err, IsNil)
+
+	rec := httptest.NewRecorder()
+	s.d.ServeHTTP(rec, req)
+
+	var rsp client.Response
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), IsNil)
+	c.Check(rsp.StatusCode, Equals, rec.Code)
+
+	return rec, &rsp
+}
+
+// waitOperation runs the queue until the operation with the given id
+// is done
+func (s *DaemonTestSuite) waitOperation(c *C, id string) client.Operation {
+	go s.d.queue.run()
+	for i := 0; i < 100; i++ {
+		if op := s.d.queue.get(id).state(); op.Done() {
+			return op
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("operation %s not done", id)
+
+	return client.Operation{}
+}
+
+func (s *DaemonTestSuite) TestRoot(c *C) {
+	rec, rsp := s.request(c, "GET", "/1.0", "")
+	c.Check(rec.Code, Equals, http.StatusOK)
+	c.Check(rsp.Type, Equals, client.ResponseTypeSync)
+	c.Check(string(rsp.Result), Equals, `{"api":"1.0"}`)
+}
+
+func (s *DaemonTestSuite) TestNotFound(c *C) {
+	for _, path := range []string{"/", "/2.0/packages", "/1.0/frobs", "/1.0/packages/foo/bar"} {
+		rec, rsp := s.request(c, "GET", path, "")
+		c.Check(rec.Code, Equals, http.StatusNotFound, Commentf(path))
+		c.Check(rsp.Type, Equals, client.ResponseTypeError)
+	}
+
+	rec, _ := s.request(c, "PUT", "/1.0/packages", "")
+	c.Check(rec.Code, Equals, http.StatusMethodNotAllowed)
+}
+
+func (s *DaemonTestSuite) TestGetPackages(c *C) {
+	rec, rsp := s.request(c, "GET", "/1.0/packages", "")
+	c.Check(rec.Code, Equals, http.StatusOK)
+	c.Check(string(rsp.Result), Equals, "[]")
+
+	rec, _ = s.request(c, "GET", "/1.0/packages/hello-world", "")
+	c.Check(rec.Code, Equals, http.StatusNotFound)
+}
+
+func (s *DaemonTestSuite) TestInstall(c *C) {
+	var installedFlags snappy.InstallFlags
+	snappyInstall = func(name string, flags snappy.InstallFlags, meter progress.Meter) (string, error) {
+		c.Check(s.locked, Equals, 1)
+		installedFlags = flags
+		meter.Start(10)
+		meter.Set(5)
+		meter.Notify("half way")
+		return name, nil
+	}
+
+	rec, rsp := s.request(c, "POST", "/1.0/packages/hello-world", `{"action": "install", "no-gc": true}`)
+	c.Check(rec.Code, Equals, http.StatusAccepted)
+	c.Check(rsp.Type, Equals, client.ResponseTypeAsync)
+
+	var op client.Operation
+	c.Assert(json.Unmarshal(rsp.Result, &op), IsNil)
+	c.Check(op.Status, Equals, client.StatusQueued)
+	c.Check(op.Kind, Equals, client.ActionInstall)
+	c.Check(rec.Header().Get("Location"), Equals, "/1.0/operations/"+op.ID)
+
+	op = s.waitOperation(c, op.ID)
+	c.Check(op.Status, Equals, client.StatusSucceeded)
+	c.Check(string(op.Result), Equals, `{"name":"hello-world"}`)
+	c.Check(op.Progress, DeepEquals, client.Progress{Current: 5, Total: 10, Message: "half way"})
+	c.Check(installedFlags, Equals, snappy.InstallFlags(0))
+	c.Check(s.locked, Equals, 0)
+	c.Check(op.Started, NotNil)
+	c.Check(op.Finished, NotNil)
+	c.Check(op.Log, DeepEquals, []client.LogEntry{{Time: timeNow(), Message: "half way"}})
+
+	rec, rsp = s.request(c, "GET", "/1.0/operations/"+op.ID, "")
+	c.Check(rec.Code, Equals, http.StatusOK)
+	var got client.Operation
+	c.Assert(json.Unmarshal(rsp.Result, &got), IsNil)
+	c.Check(got, DeepEquals, op)
+
+	rec, _ = s.request(c, "GET", "/1.0/operations", "")
+	c.Check(rec.Code, Equals, http.StatusOK)
+}
+
+func (s *DaemonTestSuite) TestRemoveFails(c *C) {
+	snappyRemove = func(name string, flags snappy.RemoveFlags, meter progress.Meter) error {
+		return errors.New("no such package")
+	}
+
+	_, rsp := s.request(c, "POST", "/1.0/packages/hello-world", `{"action": "remove"}`)
+	var op client.Operation
+	c.Assert(json.Unmarshal(rsp.Result, &op), IsNil)
+
+	op = s.waitOperation(c, op.ID)
+	c.Check(op.Status, Equals, client.StatusFailed)
+	c.Check(op.Err, Equals, "no such package")
+}
+
+func (s *DaemonTestSuite) TestUpdateAll(c *C) {
+	var gotFlags snappy.InstallFlags
+	var gotJobs int
+	var gotRefresh bool
+	snappyUpdateAll = func(flags snappy.InstallFlags, jobs int, refresh bool, meter progress.Meter) ([]snappy.Part, error) {
+		c.Check(s.locked, Equals, 1)
+		gotFlags, gotJobs, gotRefresh = flags, jobs, refresh
+		return nil, nil
+	}
+
+	rec, rsp := s.request(c, "POST", "/1.0/packages", `{"action": "update", "refresh": true}`)
+	c.Check(rec.Code, Equals, http.StatusAccepted)
+	var op client.Operation
+	c.Assert(json.Unmarshal(rsp.Result, &op), IsNil)
+	c.Check(op.Kind, Equals, client.ActionUpdate)
+
+	op = s.waitOperation(c, op.ID)
+	c.Check(op.Status, Equals, client.StatusSucceeded)
+	c.Check(string(op.Result), Equals, `[]`)
+	c.Check(gotFlags, Equals, snappy.DoInstallGC)
+	c.Check(gotJobs, Equals, defaultUpdateJobs)
+	c.Check(gotRefresh, Equals, true)
+
+	rec, _ = s.request(c, "POST", "/1.0/packages", `{"action": "remove"}`)
+	c.Check(rec.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *DaemonTestSuite) TestBadRequests(c *C) {
+	rec, _ := s.request(c, "POST", "/1.0/packages/hello-world", `{"action": "frob"}`)
+	c.Check(rec.Code, Equals, http.StatusBadRequest)
+
+	rec, _ = s.request(c, "POST", "/1.0/packages/hello-world", `not json`)
+	c.Check(rec.Code, Equals, http.StatusBadRequest)
+
+	rec, _ = s.request(c, "DELETE", "/1.0/packages/hello-world/hardware", "")
+	c.Check(rec.Code, Equals, http.StatusBadRequest)
+}
+
+func (s *DaemonTestSuite) TestChangesNeedRoot(c *C) {
+	s.root = false
+
+	rec, _ := s.request(c, "POST", "/1.0/packages/hello-world", `{"action": "install"}`)
+	c.Check(rec.Code, Equals, http.StatusForbidden)
+
+	rec, _ = s.request(c, "GET", "/1.0/packages/hello-world/config", "")
+	c.Check(rec.Code, Equals, http.StatusForbidden)
+
+	rec, _ = s.request(c, "GET", "/1.0/packages", "")
+	c.Check(rec.Code, Equals, http.StatusOK)
+}
+
+func (s *DaemonTestSuite) TestOperationsNeedRoot(c *C) {
+	op, err := s.d.queue.add("config", "hello-world", false, nop)
+	c.Assert(err, IsNil)
+	s.root = false
+
+	for _, path := range []string{"/1.0/operations", "/1.0/operations/" + op.state().ID, "/1.0/operations/" + op.state().ID + "/events", "/1.0/events"} {
+		rec, _ := s.request(c, "GET", path, "")
+		c.Check(rec.Code, Equals, http.StatusForbidden, Commentf(path))
+	}
+}
+
+func (s *DaemonTestSuite) TestUcredFromRemoteAddr(c *C) {
+	uid, err := ucredFromRemoteAddr("pid=100;uid=1000;@")
+	c.Assert(err, IsNil)
+	c.Check(uid, Equals, uint32(1000))
+
+	_, err = ucredFromRemoteAddr("127.0.0.1:1234")
+	c.Check(err, Equals, errNoUcred)
+}
+
+func (s *DaemonTestSuite) TestServeOnSocket(c *C) {
+	socket := filepath.Join(c.MkDir(), "snappy.socket")
+	c.Assert(s.d.Init(socket), IsNil)
+
+	done := make(chan error)
+	go func() { done <- s.d.Run() }()
+
+	parts, err := client.New(socket).Packages()
+	c.Assert(err, IsNil)
+	c.Check(parts, HasLen, 0)
+
+	c.Assert(s.d.Stop(), IsNil)
+	c.Check(<-done, IsNil)
+}
+
+func (s *DaemonTestSuite) TestRunWaitsForOperations(c *C) {
+	c.Assert(s.d.Init(filepath.Join(c.MkDir(), "snappy.socket")), IsNil)
+
+	started := make(chan bool)
+	unblock := make(chan bool)
+	op, err := s.d.queue.add("test", "", false, func(meter progress.Meter) (interface{}, error) {
+		started <- true
+		<-unblock
+		return nil, nil
+	})
+	c.Assert(err, IsNil)
+
+	done := make(chan error)
+	go func() { done <- s.d.Run() }()
+	<-started
+	c.Assert(s.d.Stop(), IsNil)
+
+	// the operation is not cut short
+	select {
+	case <-done:
+		c.Fatalf("Run returned before the operation was done")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(unblock)
+	c.Check(<-done, IsNil)
+	c.Check(op.state().Status, Equals, client.StatusSucceeded)
+}
@@ -0,0 +1,222 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"launchpad.net/snappy/client"
+)
+
+// maxQueuedEvents is the number of events a subscriber may be behind,
+// further events are dropped for it (but for status events)
+const maxQueuedEvents = 256
+
+// eventSubscriber gets the events of one operation, or of all operations
+// if opID is empty
+type eventSubscriber struct {
+	opID   string
+	events chan client.Event
+
+	// the status events that did not fit into events are kept
+	// here, kept is signalled when there are some
+	mu       sync.Mutex
+	statuses []client.Event
+	kept     chan bool
+}
+
+// keepStatus keeps a status event that did not fit into events
+func (sub *eventSubscriber) keepStatus(ev client.Event) {
+	sub.mu.Lock()
+	sub.statuses = append(sub.statuses, ev)
+	sub.mu.Unlock()
+
+	select {
+	case sub.kept <- true:
+	default:
+	}
+}
+
+// next returns the events that are ready after a signal of kept: the
+// queued events, which came first, and then the kept status events
+func (sub *eventSubscriber) next() []client.Event {
+	// only the stream reads the events, this does not block
+	var evs []client.Event
+	for len(sub.events) > 0 {
+		evs = append(evs, <-sub.events)
+	}
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	evs = append(evs, sub.statuses...)
+	sub.statuses = nil
+
+	return evs
+}
+
+// eventHub sends the events of the operations to the subscribers
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[*eventSubscriber]bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subs: make(map[*eventSubscriber]bool),
+	}
+}
+
+// subscribe returns a subscriber for the events of the operation with
+// the given id, or of all operations if it is empty
+func (h *eventHub) subscribe(opID string) *eventSubscriber {
+	sub := &eventSubscriber{
+		opID:   opID,
+		events: make(chan client.Event, maxQueuedEvents),
+		kept:   make(chan bool, 1),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[sub] = true
+
+	return sub
+}
+
+// unsubscribe stops sending events to the given subscriber
+func (h *eventHub) unsubscribe(sub *eventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subs, sub)
+}
+
+// publish sends the event to its subscribers, it never blocks: events
+// are dropped for subscribers that are too far behind, but status events
+// are kept for them so they always learn when an operation is done
+func (h *eventHub) publish(ev client.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subs {
+		if sub.opID != "" && sub.opID != ev.Operation {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			if ev.Type == client.EventStatus {
+				sub.keepStatus(ev)
+			}
+		}
+	}
+}
+
+// eventStream streams events as server-sent events
+type eventStream struct {
+	hub *eventHub
+	// op is the operation whose events are streamed, nil for all
+	// operations
+	op *operation
+}
+
+func (s *eventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	opID := ""
+	if s.op != nil {
+		opID = s.op.state().ID
+	}
+	sub := s.hub.subscribe(opID)
+	defer s.hub.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	send := func(ev client.Event) bool {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	if s.op != nil {
+		// the operation may be done already, then there are no more
+		// events, only its status
+		if state := s.op.state(); state.Done() {
+			send(statusEvent(state))
+			return
+		}
+	}
+
+	var closed <-chan bool
+	if notifier, ok := w.(http.CloseNotifier); ok {
+		closed = notifier.CloseNotify()
+	}
+
+	for {
+		var evs []client.Event
+		select {
+		case ev := <-sub.events:
+			evs = []client.Event{ev}
+		case <-sub.kept:
+			evs = sub.next()
+		case <-closed:
+			return
+		}
+
+		for _, ev := range evs {
+			if !send(ev) {
+				return
+			}
+			if s.op != nil && ev.Done() {
+				return
+			}
+		}
+	}
+}
+
+// statusEvent returns the status event for the given state of an
+// operation
+func statusEvent(state client.Operation) client.Event {
+	ev := client.Event{
+		Operation: state.ID,
+		Type:      client.EventStatus,
+		Status:    state.Status,
+		Err:       state.Err,
+	}
+	switch {
+	case state.Finished != nil:
+		ev.Time = *state.Finished
+	case state.Started != nil:
+		ev.Time = *state.Started
+	default:
+		ev.Time = state.Created
+	}
+
+	return ev
+}
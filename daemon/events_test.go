@@ -0,0 +1,180 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"launchpad.net/snappy/client"
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/snappy"
+
+	. "launchpad.net/gocheck"
+)
+
+// readEvents decodes the server-sent events of the given stream
+func readEvents(c *C, stream string) []client.Event {
+	var events []client.Event
+	for _, line := range strings.Split(stream, "\n") {
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var ev client.Event
+		c.Assert(json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev), IsNil)
+		events = append(events, ev)
+	}
+
+	return events
+}
+
+// subscribers returns the number of subscribers of the hub
+func subscribers(hub *eventHub) int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	return len(hub.subs)
+}
+
+func (s *DaemonTestSuite) TestEventHubFilters(c *C) {
+	hub := newEventHub()
+	all := hub.subscribe("")
+	one := hub.subscribe("one")
+
+	hub.publish(client.Event{Operation: "one", Type: client.EventSpin})
+	hub.publish(client.Event{Operation: "two", Type: client.EventSpin})
+
+	c.Check(all.events, HasLen, 2)
+	c.Check(one.events, HasLen, 1)
+
+	hub.unsubscribe(all)
+	hub.publish(client.Event{Operation: "one", Type: client.EventSpin})
+	c.Check(all.events, HasLen, 2)
+	c.Check(one.events, HasLen, 2)
+}
+
+func (s *DaemonTestSuite) TestEventHubDropsForSlowSubscribers(c *C) {
+	hub := newEventHub()
+	sub := hub.subscribe("")
+
+	for i := 0; i < maxQueuedEvents+10; i++ {
+		hub.publish(client.Event{Operation: "one", Type: client.EventSpin})
+	}
+	c.Check(sub.events, HasLen, maxQueuedEvents)
+}
+
+func (s *DaemonTestSuite) TestEventHubKeepsStatusForSlowSubscribers(c *C) {
+	hub := newEventHub()
+	sub := hub.subscribe("one")
+
+	for i := 0; i < maxQueuedEvents+10; i++ {
+		hub.publish(client.Event{Operation: "one", Type: client.EventSpin})
+	}
+	hub.publish(client.Event{Operation: "one", Type: client.EventStatus, Status: client.StatusSucceeded})
+
+	select {
+	case <-sub.kept:
+	default:
+		c.Fatal("the status event was not kept")
+	}
+	evs := sub.next()
+	c.Assert(evs, HasLen, maxQueuedEvents+1)
+	c.Check(evs[maxQueuedEvents].Done(), Equals, true)
+	c.Check(sub.next(), HasLen, 0)
+}
+
+func (s *DaemonTestSuite) TestOperationEvents(c *C) {
+	snappyInstall = func(name string, flags snappy.InstallFlags, meter progress.Meter) (string, error) {
+		meter.Start(10)
+		meter.Set(5)
+		meter.Spin("unpacking")
+		meter.Spin("unpacking")
+		meter.Finished()
+		return name, nil
+	}
+
+	_, rsp := s.request(c, "POST", "/1.0/packages/hello-world", `{"action": "install"}`)
+	var op client.Operation
+	c.Assert(json.Unmarshal(rsp.Result, &op), IsNil)
+
+	req, err := http.NewRequest("GET", "http://localhost/1.0/operations/"+op.ID+"/events", nil)
+	c.Assert(err, IsNil)
+	rec := httptest.NewRecorder()
+	done := make(chan bool)
+	go func() {
+		s.d.ServeHTTP(rec, req)
+		close(done)
+	}()
+
+	// only run the operation once the stream is subscribed
+	for i := 0; i < 100 && subscribers(s.d.queue.events) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.waitOperation(c, op.ID)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("event stream did not end")
+	}
+
+	c.Check(rec.Header().Get("Content-Type"), Equals, "text/event-stream")
+	var types []string
+	for _, ev := range readEvents(c, rec.Body.String()) {
+		c.Check(ev.Operation, Equals, op.ID)
+		types = append(types, ev.Type)
+	}
+	c.Check(types, DeepEquals, []string{
+		client.EventStatus,
+		client.EventStart,
+		client.EventSet,
+		client.EventSpin,
+		client.EventSpin,
+		client.EventFinished,
+		client.EventStatus,
+	})
+
+	// the log only has the spinner message once
+	state := s.d.queue.get(op.ID).state()
+	c.Check(state.Log, HasLen, 1)
+}
+
+func (s *DaemonTestSuite) TestEventsOfDoneOperation(c *C) {
+	_, rsp := s.request(c, "POST", "/1.0/packages/hello-world/hardware", `{"device": "/dev/ttyUSB0"}`)
+	var op client.Operation
+	c.Assert(json.Unmarshal(rsp.Result, &op), IsNil)
+	snappyAddHWAccess = func(name, device string) error { return nil }
+	defer func() { snappyAddHWAccess = snappy.AddHWAccess }()
+	s.waitOperation(c, op.ID)
+
+	req, err := http.NewRequest("GET", "http://localhost/1.0/operations/"+op.ID+"/events", nil)
+	c.Assert(err, IsNil)
+	rec := httptest.NewRecorder()
+	s.d.ServeHTTP(rec, req)
+
+	events := readEvents(c, rec.Body.String())
+	c.Assert(events, HasLen, 1)
+	c.Check(events[0].Type, Equals, client.EventStatus)
+	c.Check(events[0].Status, Equals, client.StatusSucceeded)
+
+	rec, _ = s.request(c, "GET", "/1.0/operations/nope/events", "")
+	c.Check(rec.Code, Equals, http.StatusNotFound)
+}
@@ -0,0 +1,366 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"launchpad.net/snappy/client"
+	"launchpad.net/snappy/logger"
+	"launchpad.net/snappy/priv"
+	"launchpad.net/snappy/progress"
+)
+
+// errQueueFull is returned if too many operations are waiting to be run
+var errQueueFull = errors.New("too many pending operations, try again later")
+
+// errQueueStopped is returned if the daemon is shutting down
+var errQueueStopped = errors.New("the snappy daemon is shutting down")
+
+const (
+	// maxPendingOps is the number of operations that may wait to be run
+	maxPendingOps = 64
+	// maxDoneOps is the number of done operations that are remembered
+	maxDoneOps = 100
+)
+
+// lockSystem takes the lock that the snappy command line tool takes for
+// changes of the system, it returns the function that releases it. Useful
+// to override for testing.
+var lockSystem = func() (func(), error) {
+	privMutex := priv.New()
+	if err := privMutex.Lock(); err != nil {
+		return nil, err
+	}
+
+	return func() { privMutex.Unlock() }, nil
+}
+
+// operationFunc does the work of an operation, the result is json
+// encoded into the operation
+type operationFunc func(meter progress.Meter) (interface{}, error)
+
+// operation is an operation of the queue
+type operation struct {
+	mu            sync.Mutex
+	info          client.Operation
+	licenseAgreed bool
+	do            operationFunc
+	events        *eventHub
+}
+
+// state returns a copy of the state of the operation
+func (op *operation) state() client.Operation {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	state := op.info
+	state.Log = append([]client.LogEntry(nil), op.info.Log...)
+
+	return state
+}
+
+// update changes the state of the operation with the given function and
+// publishes the event it returns (if any)
+func (op *operation) update(f func(info *client.Operation) *client.Event) {
+	op.mu.Lock()
+	ev := f(&op.info)
+	if ev != nil {
+		ev.Operation = op.info.ID
+	}
+	op.mu.Unlock()
+
+	if ev != nil && op.events != nil {
+		op.events.publish(*ev)
+	}
+}
+
+// setStatus changes the status of the operation
+func (op *operation) setStatus(status string, err error) {
+	op.update(func(info *client.Operation) *client.Event {
+		now := timeNow()
+		info.Status = status
+		switch status {
+		case client.StatusRunning:
+			info.Started = &now
+		case client.StatusSucceeded, client.StatusFailed:
+			info.Finished = &now
+		}
+		if err != nil {
+			info.Err = err.Error()
+		}
+		ev := statusEvent(*info)
+		return &ev
+	})
+}
+
+// run does the operation and returns its error, the final status is
+// set with finish
+func (op *operation) run() (err error) {
+	op.setStatus(client.StatusRunning, nil)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = logger.LogError(fmt.Errorf("internal error: %v", r))
+		}
+	}()
+
+	result, err := op.do(&operationMeter{op: op})
+	if err == nil && result != nil {
+		var data []byte
+		data, err = json.Marshal(result)
+		op.update(func(info *client.Operation) *client.Event {
+			info.Result = data
+			return nil
+		})
+	}
+
+	return err
+}
+
+// finish sets the final status of the operation, depending on the
+// error of run
+func (op *operation) finish(err error) {
+	if err != nil {
+		op.setStatus(client.StatusFailed, err)
+		return
+	}
+	op.setStatus(client.StatusSucceeded, nil)
+}
+
+// timeNow returns the current time, useful to override for testing
+var timeNow = time.Now
+
+// operationMeter is a progress.Meter that keeps the progress in the
+// operation and publishes it as events
+type operationMeter struct {
+	op *operation
+}
+
+// Start sets the total and resets the current progress
+func (m *operationMeter) Start(total float64) {
+	m.op.update(func(info *client.Operation) *client.Event {
+		info.Progress.Current = 0
+		info.Progress.Total = total
+		return &client.Event{Type: client.EventStart, Time: timeNow(), Total: total}
+	})
+}
+
+// Set sets the current progress
+func (m *operationMeter) Set(current float64) {
+	m.op.update(func(info *client.Operation) *client.Event {
+		info.Progress.Current = current
+		return &client.Event{Type: client.EventSet, Time: timeNow(), Current: current, Total: info.Progress.Total}
+	})
+}
+
+// SetTotal sets the total
+func (m *operationMeter) SetTotal(total float64) {
+	m.op.update(func(info *client.Operation) *client.Event {
+		info.Progress.Total = total
+		return &client.Event{Type: client.EventTotal, Time: timeNow(), Current: info.Progress.Current, Total: total}
+	})
+}
+
+// Finished sets the current progress to the total
+func (m *operationMeter) Finished() {
+	m.op.update(func(info *client.Operation) *client.Event {
+		info.Progress.Current = info.Progress.Total
+		return &client.Event{Type: client.EventFinished, Time: timeNow(), Current: info.Progress.Current, Total: info.Progress.Total}
+	})
+}
+
+// Spin sets the message, it is only logged if it changed as it is
+// called over and over while waiting
+func (m *operationMeter) Spin(msg string) {
+	m.op.update(func(info *client.Operation) *client.Event {
+		now := timeNow()
+		if msg != info.Progress.Message {
+			info.Log = append(info.Log, client.LogEntry{Time: now, Message: msg})
+		}
+		info.Progress.Message = msg
+		return &client.Event{Type: client.EventSpin, Time: now, Message: msg}
+	})
+}
+
+// Write does nothing, there is no terminal to write to
+func (m *operationMeter) Write(p []byte) (n int, err error) {
+	return len(p), nil
+}
+
+// Agreed returns true if the license was agreed to in the request
+func (m *operationMeter) Agreed(intro, license string) bool {
+	return m.op.licenseAgreed
+}
+
+// Notify sets the message and logs it
+func (m *operationMeter) Notify(msg string) {
+	m.op.update(func(info *client.Operation) *client.Event {
+		now := timeNow()
+		info.Log = append(info.Log, client.LogEntry{Time: now, Message: msg})
+		info.Progress.Message = msg
+		return &client.Event{Type: client.EventNotify, Time: now, Message: msg}
+	})
+}
+
+// operationQueue runs the operations one after the other
+type operationQueue struct {
+	mu      sync.Mutex
+	ops     map[string]*operation
+	ids     []string
+	pending chan *operation
+	stopped bool
+	events  *eventHub
+	// done is closed when run returned
+	done chan struct{}
+}
+
+func newOperationQueue() *operationQueue {
+	return &operationQueue{
+		ops:     make(map[string]*operation),
+		pending: make(chan *operation, maxPendingOps),
+		events:  newEventHub(),
+		done:    make(chan struct{}),
+	}
+}
+
+// newOperationID returns a random id for an operation
+func newOperationID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// add queues an operation of the given kind for the given package
+func (q *operationQueue) add(kind, pkg string, licenseAgreed bool, do operationFunc) (*operation, error) {
+	id, err := newOperationID()
+	if err != nil {
+		return nil, err
+	}
+
+	op := &operation{
+		info: client.Operation{
+			ID:      id,
+			Kind:    kind,
+			Package: pkg,
+			Status:  client.StatusQueued,
+			Created: timeNow(),
+		},
+		licenseAgreed: licenseAgreed,
+		do:            do,
+		events:        q.events,
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped {
+		return nil, errQueueStopped
+	}
+	select {
+	case q.pending <- op:
+	default:
+		return nil, errQueueFull
+	}
+	q.ops[id] = op
+	q.ids = append(q.ids, id)
+	q.forgetDone()
+
+	return op, nil
+}
+
+// forgetDone forgets the oldest done operations if there are more
+// than maxDoneOps, it needs to be called with the lock held
+func (q *operationQueue) forgetDone() {
+	done := 0
+	for _, id := range q.ids {
+		if q.ops[id].state().Done() {
+			done++
+		}
+	}
+
+	var ids []string
+	for _, id := range q.ids {
+		if done > maxDoneOps && q.ops[id].state().Done() {
+			delete(q.ops, id)
+			done--
+			continue
+		}
+		ids = append(ids, id)
+	}
+	q.ids = ids
+}
+
+// get returns the operation with the given id, or nil
+func (q *operationQueue) get(id string) *operation {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.ops[id]
+}
+
+// list returns the state of all operations, in the order they were
+// queued
+func (q *operationQueue) list() []client.Operation {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	infos := make([]client.Operation, 0, len(q.ids))
+	for _, id := range q.ids {
+		infos = append(infos, q.ops[id].state())
+	}
+
+	return infos
+}
+
+// run runs the queued operations until the queue is stopped, each one
+// with the system lock held
+func (q *operationQueue) run() {
+	defer close(q.done)
+
+	for op := range q.pending {
+		unlock, err := lockSystem()
+		if err == nil {
+			err = op.run()
+			unlock()
+		}
+		// only done operations are reported once the lock is
+		// released, so clients can go on with the next change
+		op.finish(err)
+	}
+}
+
+// stop stops the queue once the queued operations are done
+func (q *operationQueue) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.stopped {
+		q.stopped = true
+		close(q.pending)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"launchpad.net/snappy/client"
+	"launchpad.net/snappy/progress"
+
+	. "launchpad.net/gocheck"
+)
+
+func nop(meter progress.Meter) (interface{}, error) {
+	return nil, nil
+}
+
+func (s *DaemonTestSuite) TestQueueForgetsOldOperations(c *C) {
+	q := newOperationQueue()
+	var first *operation
+	for i := 0; i < maxDoneOps+2; i++ {
+		op, err := q.add("test", "", false, nop)
+		c.Assert(err, IsNil)
+		op.finish(op.run())
+		<-q.pending
+		if first == nil {
+			first = op
+		}
+	}
+
+	c.Check(q.list(), HasLen, maxDoneOps+1)
+	c.Check(q.get(first.state().ID), IsNil)
+}
+
+func (s *DaemonTestSuite) TestOperationPanics(c *C) {
+	op, err := s.d.queue.add("test", "", false, func(meter progress.Meter) (interface{}, error) {
+		panic("boom")
+	})
+	c.Assert(err, IsNil)
+
+	info := s.waitOperation(c, op.state().ID)
+	c.Check(info.Status, Equals, client.StatusFailed)
+	c.Check(info.Err, Equals, "internal error: boom")
+	c.Check(s.locked, Equals, 0)
+}
+
+func (s *DaemonTestSuite) TestQueueFull(c *C) {
+	q := newOperationQueue()
+	for i := 0; i < maxPendingOps; i++ {
+		_, err := q.add("test", "", false, nop)
+		c.Assert(err, IsNil)
+	}
+
+	_, err := q.add("test", "", false, nop)
+	c.Check(err, Equals, errQueueFull)
+
+	q.stop()
+	_, err = q.add("test", "", false, nop)
+	c.Check(err, Equals, errQueueStopped)
+}
+
+func (s *DaemonTestSuite) TestOperationMeterLicense(c *C) {
+	op := &operation{licenseAgreed: true}
+	meter := &operationMeter{op: op}
+	c.Check(meter.Agreed("intro", "license"), Equals, true)
+
+	meter.Start(4)
+	meter.Finished()
+	c.Check(op.state().Progress, DeepEquals, client.Progress{Current: 4, Total: 4})
+}
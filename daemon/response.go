@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+
+	"launchpad.net/snappy/client"
+	"launchpad.net/snappy/logger"
+)
+
+// response is what a handler answers, it is sent as a client.Response
+type response struct {
+	Type       string      `json:"type"`
+	StatusCode int         `json:"status-code"`
+	Result     interface{} `json:"result"`
+
+	location string
+}
+
+func (r *response) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		logger.LogError(err)
+		r = errorResponse(http.StatusInternalServerError, "cannot encode the response: %s", err)
+		data, _ = json.Marshal(r)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.location != "" {
+		w.Header().Set("Location", r.location)
+	}
+	w.WriteHeader(r.StatusCode)
+	w.Write(data)
+}
+
+// syncResponse answers with the given result
+func syncResponse(result interface{}) *response {
+	return &response{
+		Type:       client.ResponseTypeSync,
+		StatusCode: http.StatusOK,
+		Result:     result,
+	}
+}
+
+// asyncResponse answers with the given operation that was started
+func asyncResponse(op client.Operation) *response {
+	return &response{
+		Type:       client.ResponseTypeAsync,
+		StatusCode: http.StatusAccepted,
+		Result:     op,
+		location:   path.Join(client.APIVersion, "operations", op.ID),
+	}
+}
+
+// errorResponse answers with the given error message
+func errorResponse(status int, format string, v ...interface{}) *response {
+	return &response{
+		Type:       client.ResponseTypeError,
+		StatusCode: status,
+		Result:     &client.Error{Message: fmt.Sprintf(format, v...)},
+	}
+}
+
+// notFound answers that the given thing does not exist
+func notFound(format string, v ...interface{}) *response {
+	return errorResponse(http.StatusNotFound, format, v...)
+}
+
+// badRequest answers that the request can not be understood
+func badRequest(format string, v ...interface{}) *response {
+	return errorResponse(http.StatusBadRequest, format, v...)
+}
+
+// internalError answers that the request failed
+func internalError(err error) *response {
+	return errorResponse(http.StatusInternalServerError, "%s", err)
+}
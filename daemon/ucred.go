@@ -0,0 +1,111 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"syscall"
+)
+
+// errNoUcred is returned if the credentials of the peer are unknown
+var errNoUcred = errors.New("no credentials of the peer")
+
+// ucredAddr is the address of a connection, it carries the credentials
+// of the peer so that the handlers can see them in the RemoteAddr of
+// the request
+type ucredAddr struct {
+	net.Addr
+	pid uint32
+	uid uint32
+}
+
+func (addr *ucredAddr) String() string {
+	return fmt.Sprintf("pid=%d;uid=%d;%s", addr.pid, addr.uid, addr.Addr)
+}
+
+var ucredRegexp = regexp.MustCompile(`^pid=(\d+);uid=(\d+);`)
+
+// ucredFromRemoteAddr returns the uid of the peer from the RemoteAddr
+// of a request
+func ucredFromRemoteAddr(remoteAddr string) (uid uint32, err error) {
+	m := ucredRegexp.FindStringSubmatch(remoteAddr)
+	if m == nil {
+		return 0, errNoUcred
+	}
+
+	n, err := strconv.ParseUint(m[2], 10, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint32(n), nil
+}
+
+// ucredConn is a connection with the credentials of its peer
+type ucredConn struct {
+	net.Conn
+	addr *ucredAddr
+}
+
+func (conn *ucredConn) RemoteAddr() net.Addr {
+	return conn.addr
+}
+
+// ucredListener is a unix socket listener that asks the kernel for the
+// credentials of the peer of the connections it accepts
+type ucredListener struct {
+	net.Listener
+}
+
+func (l *ucredListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return conn, nil
+	}
+
+	f, err := unixConn.File()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	defer f.Close()
+
+	ucred, err := syscall.GetsockoptUcred(int(f.Fd()), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &ucredConn{
+		Conn: conn,
+		addr: &ucredAddr{
+			Addr: conn.RemoteAddr(),
+			pid:  uint32(ucred.Pid),
+			uid:  ucred.Uid,
+		},
+	}, nil
+}
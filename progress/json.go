@@ -0,0 +1,213 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package progress
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// the types of the events of a JSONProgress, they match the events of
+// the snappy daemon (see docs/rest.md)
+const (
+	EventStart         = "start"
+	EventSet           = "set"
+	EventTotal         = "total"
+	EventSpin          = "spin"
+	EventNotify        = "notify"
+	EventFinished      = "finished"
+	EventLicensePrompt = "license-prompt"
+)
+
+// Event is what a JSONProgress writes, one per line
+type Event struct {
+	Type    string    `json:"type"`
+	Package string    `json:"package,omitempty"`
+	Time    time.Time `json:"time"`
+	// Current and Total are set for start, set, total and finished
+	// events
+	Current float64 `json:"current,omitempty"`
+	Total   float64 `json:"total,omitempty"`
+	// Message is set for spin and notify events
+	Message string `json:"message,omitempty"`
+	// Intro and License are set for license-prompt events
+	Intro   string `json:"intro,omitempty"`
+	License string `json:"license,omitempty"`
+}
+
+// LicenseAnswer is the line a JSONProgress reads as the answer to a
+// license-prompt event
+type LicenseAnswer struct {
+	Agreed bool `json:"agreed"`
+}
+
+// jsonSetInterval is how often set events are written at most, as
+// downloads call Write for every few kilobytes
+var jsonSetInterval = 250 * time.Millisecond
+
+// JSONProgress writes the progress as newline-delimited JSON events, for
+// programs that track the progress of snappy
+type JSONProgress struct {
+	mu      sync.Mutex
+	w       io.Writer
+	in      io.Reader
+	pkg     string
+	total   float64
+	current float64
+	lastSet time.Time
+}
+
+// NewJSONProgress returns a new JSONProgress that writes the events for
+// the given package to w and reads the answers to license prompts from
+// stdin
+func NewJSONProgress(pkg string, w io.Writer) *JSONProgress {
+	return &JSONProgress{w: w, in: os.Stdin, pkg: pkg}
+}
+
+// emit writes the given event, it needs to be called with the lock
+// held
+func (t *JSONProgress) emit(ev Event) error {
+	ev.Package = t.pkg
+	ev.Time = time.Now()
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = t.w.Write(append(data, '\n'))
+
+	return err
+}
+
+// Start writes a start event
+func (t *JSONProgress) Start(total float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total = total
+	t.current = 0
+	t.lastSet = time.Time{}
+	t.emit(Event{Type: EventStart, Total: total})
+}
+
+// set sets the current progress and writes a set event unless one was
+// written less than jsonSetInterval ago
+func (t *JSONProgress) set(current float64) {
+	t.current = current
+
+	if now := time.Now(); now.Sub(t.lastSet) >= jsonSetInterval {
+		t.lastSet = now
+		t.emit(Event{Type: EventSet, Current: t.current, Total: t.total})
+	}
+}
+
+// Set writes a set event
+func (t *JSONProgress) Set(current float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.set(current)
+}
+
+// SetTotal writes a total event
+func (t *JSONProgress) SetTotal(total float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.total = total
+	t.emit(Event{Type: EventTotal, Current: t.current, Total: total})
+}
+
+// Finished writes a finished event
+func (t *JSONProgress) Finished() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.emit(Event{Type: EventFinished, Current: t.current, Total: t.total})
+}
+
+// Write adds the written bytes to the progress, so that the progress
+// of io operations can be tracked
+func (t *JSONProgress) Write(p []byte) (n int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.set(t.current + float64(len(p)))
+
+	return len(p), nil
+}
+
+// Spin writes a spin event
+func (t *JSONProgress) Spin(msg string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.emit(Event{Type: EventSpin, Message: msg})
+}
+
+// Agreed writes a license-prompt event and reads the answer, a
+// LicenseAnswer on a line of its own
+func (t *JSONProgress) Agreed(intro, license string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.emit(Event{Type: EventLicensePrompt, Intro: intro, License: license}); err != nil {
+		return false
+	}
+
+	line, err := readLine(t.in)
+	if err != nil && err != io.EOF {
+		return false
+	}
+	var answer LicenseAnswer
+	if err := json.Unmarshal(line, &answer); err != nil {
+		return false
+	}
+
+	return answer.Agreed
+}
+
+// readLine reads a line from r one byte at a time, so that nothing
+// after the line is consumed (as a buffered reader would)
+func readLine(r io.Reader) ([]byte, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				return line, nil
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			return line, err
+		}
+	}
+}
+
+// Notify writes a notify event
+func (t *JSONProgress) Notify(msg string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.emit(Event{Type: EventNotify, Message: msg})
+}
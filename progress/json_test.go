@@ -0,0 +1,119 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	. "launchpad.net/gocheck"
+)
+
+// jsonEvents decodes the events written by a JSONProgress
+func jsonEvents(c *C, out string) []Event {
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		var ev Event
+		c.Assert(json.Unmarshal([]byte(line), &ev), IsNil)
+		c.Check(ev.Package, Equals, "foo")
+		ev.Package = ""
+		ev.Time = time.Time{}
+		events = append(events, ev)
+	}
+
+	return events
+}
+
+func (ts *ProgressTestSuite) TestJSONProgress(c *C) {
+	var buf bytes.Buffer
+	t := NewJSONProgress("foo", &buf)
+
+	t.Start(10)
+	t.Set(2)
+	t.SetTotal(20)
+	t.Spin("waiting")
+	t.Notify("hello")
+	t.Finished()
+
+	c.Check(jsonEvents(c, buf.String()), DeepEquals, []Event{
+		{Type: EventStart, Total: 10},
+		{Type: EventSet, Current: 2, Total: 10},
+		{Type: EventTotal, Current: 2, Total: 20},
+		{Type: EventSpin, Message: "waiting"},
+		{Type: EventNotify, Message: "hello"},
+		{Type: EventFinished, Current: 2, Total: 20},
+	})
+}
+
+func (ts *ProgressTestSuite) TestJSONProgressWriteThrottles(c *C) {
+	var buf bytes.Buffer
+	t := NewJSONProgress("foo", &buf)
+
+	t.Start(10)
+	for i := 0; i < 10; i++ {
+		n, err := t.Write([]byte("x"))
+		c.Assert(err, IsNil)
+		c.Check(n, Equals, 1)
+	}
+	t.Finished()
+
+	c.Check(jsonEvents(c, buf.String()), DeepEquals, []Event{
+		{Type: EventStart, Total: 10},
+		{Type: EventSet, Current: 1, Total: 10},
+		{Type: EventFinished, Current: 10, Total: 10},
+	})
+}
+
+func (ts *ProgressTestSuite) TestJSONProgressAgreed(c *C) {
+	for answer, agreed := range map[string]bool{
+		`{"agreed": true}` + "\n": true,
+		`{"agreed": false}`:       false,
+		"y\n":                     false,
+		"":                        false,
+	} {
+		var buf bytes.Buffer
+		t := NewJSONProgress("foo", &buf)
+		t.in = strings.NewReader(answer)
+
+		c.Check(t.Agreed("intro", "license"), Equals, agreed, Commentf(answer))
+		c.Check(jsonEvents(c, buf.String()), DeepEquals, []Event{
+			{Type: EventLicensePrompt, Intro: "intro", License: "license"},
+		})
+	}
+}
+
+func (ts *ProgressTestSuite) TestJSONProgressAgreedTwice(c *C) {
+	var buf bytes.Buffer
+	t := NewJSONProgress("foo", &buf)
+	t.in = strings.NewReader(`{"agreed": true}` + "\n" + `{"agreed": true}` + "\n")
+
+	// the second answer is not lost to the first prompt
+	c.Check(t.Agreed("intro", "license"), Equals, true)
+	c.Check(t.Agreed("intro", "license"), Equals, true)
+	c.Check(t.Agreed("intro", "license"), Equals, false)
+}
+
+func (ts *ProgressTestSuite) TestMakeProgressBarJSON(c *C) {
+	var buf bytes.Buffer
+	UseJSON(&buf)
+	defer UseJSON(nil)
+
+	c.Check(MakeProgressBar("foo"), FitsTypeOf, &JSONProgress{})
+}
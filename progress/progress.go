@@ -20,7 +20,9 @@ package progress
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"sync"
 	"unicode"
 
 	"github.com/cheggaaa/pb"
@@ -177,11 +179,130 @@ func (*TextProgress) Notify(msg string) {
 	fmt.Println(msg)
 }
 
+// MultiProgress shows the progress of several concurrent operations
+// (e.g. downloads) as one progress on the given Meter
+type MultiProgress struct {
+	mu      sync.Mutex
+	pbar    Meter
+	started bool
+	total   float64
+	current float64
+}
+
+// NewMultiProgress returns a new MultiProgress for the given Meter
+func NewMultiProgress(pbar Meter) *MultiProgress {
+	return &MultiProgress{pbar: pbar}
+}
+
+// Child returns a Meter for one of the operations
+func (m *MultiProgress) Child() Meter {
+	return &multiProgressChild{m: m}
+}
+
+// Finished finishes the progress display of all operations
+func (m *MultiProgress) Finished() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.started {
+		m.pbar.Finished()
+	}
+}
+
+// add adds the given amounts to the total and the current progress
+func (m *MultiProgress) add(total, current float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.total += total
+	m.current += current
+
+	if !m.started {
+		m.pbar.Start(m.total)
+		m.started = true
+	} else if total != 0 {
+		m.pbar.SetTotal(m.total)
+	}
+	m.pbar.Set(m.current)
+}
+
+func (m *MultiProgress) notify(msg string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pbar.Notify(msg)
+}
+
+// multiProgressChild is the Meter of a single operation of a
+// MultiProgress
+type multiProgressChild struct {
+	m       *MultiProgress
+	total   float64
+	current float64
+}
+
+// Start adds the total of the operation to the overall total
+func (c *multiProgressChild) Start(total float64) {
+	c.m.add(total-c.total, -c.current)
+	c.total = total
+	c.current = 0
+}
+
+// Set sets the progress of the operation
+func (c *multiProgressChild) Set(current float64) {
+	c.m.add(0, current-c.current)
+	c.current = current
+}
+
+// SetTotal sets the total of the operation
+func (c *multiProgressChild) SetTotal(total float64) {
+	c.m.add(total-c.total, 0)
+	c.total = total
+}
+
+// Finished does nothing, the MultiProgress is finished as a whole
+func (c *multiProgressChild) Finished() {
+}
+
+// Spin does nothing, the overall progress is shown instead
+func (c *multiProgressChild) Spin(msg string) {
+}
+
+// Write adds the written bytes to the progress of the operation
+func (c *multiProgressChild) Write(p []byte) (n int, err error) {
+	c.Set(c.current + float64(len(p)))
+
+	return len(p), nil
+}
+
+// Agreed is not supported for concurrent operations
+func (c *multiProgressChild) Agreed(intro, licenseFile string) bool {
+	return false
+}
+
+// Notify notifies the user of miscelaneous events
+func (c *multiProgressChild) Notify(msg string) {
+	c.m.notify(msg)
+}
+
+// jsonOutput is where MakeProgressBar makes JSONProgress meters write
+// to, nil if it makes the ones for the terminal
+var jsonOutput io.Writer
+
+// UseJSON makes MakeProgressBar return JSONProgress meters that write to
+// the given writer, or the ones for the terminal again if it is nil
+func UseJSON(w io.Writer) {
+	jsonOutput = w
+}
+
 // MakeProgressBar creates an appropriate progress (which may be a
-// NullProgress bar if there is no associated terminal).
+// NullProgress bar if there is no associated terminal, or a JSONProgress
+// if UseJSON was called).
 func MakeProgressBar(name string) Meter {
 	var pbar Meter
-	if attachedToTerminal() {
+	if jsonOutput != nil {
+		pbar = NewJSONProgress(name, jsonOutput)
+	} else if attachedToTerminal() {
 		pbar = NewTextProgress(name)
 	} else {
 		pbar = &NullProgress{}
@@ -146,3 +146,58 @@ func (ts *ProgressTestSuite) TestMakeProgressBar(c *C) {
 	c.Assert(pbar, FitsTypeOf, &NullProgress{})
 
 }
+
+// recordingMeter remembers the last values it was given
+type recordingMeter struct {
+	NullProgress
+	starts   int
+	total    float64
+	current  float64
+	finished bool
+}
+
+func (r *recordingMeter) Start(total float64) {
+	r.starts++
+	r.total = total
+}
+
+func (r *recordingMeter) SetTotal(total float64) {
+	r.total = total
+}
+
+func (r *recordingMeter) Set(current float64) {
+	r.current = current
+}
+
+func (r *recordingMeter) Finished() {
+	r.finished = true
+}
+
+func (ts *ProgressTestSuite) TestMultiProgress(c *C) {
+	r := &recordingMeter{}
+	m := NewMultiProgress(r)
+
+	a := m.Child()
+	b := m.Child()
+	a.Start(100)
+	b.Start(50)
+	c.Check(r.starts, Equals, 1)
+	c.Check(r.total, Equals, float64(150))
+
+	a.Write(make([]byte, 30))
+	b.Set(20)
+	c.Check(r.current, Equals, float64(50))
+
+	// a restarted operation starts over
+	a.Start(100)
+	c.Check(r.total, Equals, float64(150))
+	c.Check(r.current, Equals, float64(20))
+
+	b.SetTotal(60)
+	c.Check(r.total, Equals, float64(160))
+
+	a.Finished()
+	c.Check(r.finished, Equals, false)
+	m.Finished()
+	c.Check(r.finished, Equals, true)
+}
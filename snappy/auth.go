@@ -84,8 +84,7 @@ func RequestStoreToken(username, password, tokenName, otp string) (*StoreToken,
 		return nil, err
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpDo(req)
 	if err != nil {
 		return nil, err
 	}
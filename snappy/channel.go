@@ -0,0 +1,146 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"launchpad.net/snappy/progress"
+)
+
+// the channels a snap can track, from the most to the least stable one
+var snapChannels = []string{"stable", "candidate", "beta", "edge"}
+
+// defaultSnapChannel is the channel of snaps that were not set to
+// track another one
+const defaultSnapChannel = "edge"
+
+// isValidChannel returns true if the given channel is one of
+// snapChannels
+func isValidChannel(channel string) bool {
+	for _, ch := range snapChannels {
+		if ch == channel {
+			return true
+		}
+	}
+
+	return false
+}
+
+// snapChannelsStore has the channels the snaps track, snaps that track
+// the default channel are not in there
+var snapChannelsStore = newSnapStore(&snapChannelsFile, func() interface{} { return &map[string]string{} })
+
+// readSnapChannels returns the channels the snaps track (by snap name)
+func readSnapChannels() (map[string]string, error) {
+	channels := make(map[string]string)
+	if err := snapChannelsStore.read(&channels); err != nil {
+		return nil, err
+	}
+
+	return channels, nil
+}
+
+// snapChannel returns the channel the given snap tracks
+func snapChannel(name string) string {
+	name, _ = splitNamespace(name)
+
+	channels, err := readSnapChannels()
+	if err != nil {
+		return defaultSnapChannel
+	}
+	if channel, ok := channels[name]; ok {
+		return channel
+	}
+
+	return defaultSnapChannel
+}
+
+// setSnapChannel makes the given snap track the given channel
+func setSnapChannel(name, channel string) error {
+	if !isValidChannel(channel) {
+		return &ErrUnknownChannel{channel: channel}
+	}
+	name, _ = splitNamespace(name)
+
+	channels, err := readSnapChannels()
+	if err != nil {
+		return err
+	}
+
+	if channel == defaultSnapChannel {
+		delete(channels, name)
+	} else {
+		channels[name] = channel
+	}
+
+	return snapChannelsStore.write(channels)
+}
+
+// setSnapChannelProperty is the "channel" property of SetProperty
+func setSnapChannelProperty(pkgname, channel string) error {
+	if name, _ := splitNamespace(pkgname); ActiveSnapByName(name) == nil {
+		return ErrNotInstalled
+	}
+
+	return setSnapChannel(pkgname, channel)
+}
+
+// UpdateSnap makes the given snap use the current version of the
+// channel it tracks, e.g. after the channel was changed. This may also
+// go back to an older version. It returns the new part or nil if the
+// snap is already up to date, held snaps are not changed.
+func UpdateSnap(name string, flags InstallFlags, meter progress.Meter) (Part, error) {
+	name, _ = splitNamespace(name)
+	current := ActiveSnapByName(name)
+	if current == nil {
+		return nil, ErrNotInstalled
+	}
+	if IsHeld(name) {
+		return nil, ErrSnapHeld
+	}
+
+	fullName := current.Name()
+	if current.Namespace() != "" {
+		fullName += "." + current.Namespace()
+	}
+	found, err := NewMetaStoreRepository().Details(fullName)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, ErrPackageNotFound
+	}
+	part := found[0]
+	if part.Version() == current.Version() {
+		return nil, nil
+	}
+
+	// the version may still be installed
+	installed, err := NewMetaLocalRepository().Installed()
+	if err != nil {
+		return nil, err
+	}
+	if old := FindSnapsByNameAndVersion(Dirname(part), part.Version(), installed); len(old) > 0 {
+		return old[0], old[0].SetActive(meter)
+	}
+
+	if _, err := part.Install(meter, flags); err != nil {
+		return nil, err
+	}
+
+	return part, GarbageCollect(part.Name(), flags)
+}
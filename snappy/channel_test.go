@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+
+	. "launchpad.net/gocheck"
+)
+
+func (s *SnapTestSuite) TestSnapChannelDefault(c *C) {
+	c.Check(snapChannel("foo"), Equals, defaultSnapChannel)
+}
+
+func (s *SnapTestSuite) TestSetSnapChannel(c *C) {
+	c.Assert(setSnapChannel("foo.bar", "stable"), IsNil)
+	c.Check(snapChannel("foo"), Equals, "stable")
+	c.Check(snapChannel("foo.bar"), Equals, "stable")
+	c.Check(snapChannel("baz"), Equals, defaultSnapChannel)
+
+	// going back to the default channel forgets the snap
+	c.Assert(setSnapChannel("foo", defaultSnapChannel), IsNil)
+	channels, err := readSnapChannels()
+	c.Assert(err, IsNil)
+	c.Check(channels, HasLen, 0)
+}
+
+func (s *SnapTestSuite) TestSetSnapChannelUnknown(c *C) {
+	err := setSnapChannel("foo", "unstable")
+	c.Assert(err, FitsTypeOf, &ErrUnknownChannel{})
+	c.Check(err, ErrorMatches, `unknown channel "unstable" \(use one of stable, candidate, beta, edge\)`)
+}
+
+func (s *SnapTestSuite) TestSetSnapChannelPropertyNotInstalled(c *C) {
+	c.Check(setSnapChannelProperty("foo", "stable"), Equals, ErrNotInstalled)
+}
+
+func (s *SnapTestSuite) TestSnapPartChannel(c *C) {
+	snapFile := makeTestSnapPackage(c, "")
+	_, err := installClick(snapFile, 0, nil, testNamespace)
+	c.Assert(err, IsNil)
+
+	c.Assert(setSnapChannelProperty("foo", "beta"), IsNil)
+	c.Check(ActiveSnapByName("foo").Channel(), Equals, "beta")
+}
+
+func (s *SnapTestSuite) TestUbuntuStoreRepositoryDetailsChannel(c *C) {
+	var channel string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channel = r.Header.Get("X-Ubuntu-Device-Channel")
+		io.WriteString(w, MockDetailsJSON)
+	}))
+	defer mockServer.Close()
+
+	var err error
+	storeDetailsURI, err = url.Parse(mockServer.URL + "/details/")
+	c.Assert(err, IsNil)
+	c.Assert(setSnapChannel(funkyAppName, "candidate"), IsNil)
+
+	parts, err := NewUbuntuStoreSnapRepository().Details(funkyAppName + "." + funkyAppOrigin)
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 1)
+	c.Check(channel, Equals, "candidate")
+	c.Check(parts[0].Channel(), Equals, "candidate")
+}
+
+func (s *SnapTestSuite) TestUbuntuStoreRepositoryUpdatesPerChannel(c *C) {
+	requests := make(map[string]string)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jsonReq, err := ioutil.ReadAll(r.Body)
+		c.Assert(err, IsNil)
+		requests[r.Header.Get("X-Ubuntu-Device-Channel")] = string(jsonReq)
+		io.WriteString(w, "[]")
+	}))
+	defer mockServer.Close()
+
+	var err error
+	storeBulkURI, err = url.Parse(mockServer.URL + "/updates/")
+	c.Assert(err, IsNil)
+	mockActiveSnapNamesByType([]string{"foo", "bar", "baz"})
+	c.Assert(setSnapChannel("bar", "stable"), IsNil)
+
+	_, err = NewUbuntuStoreSnapRepository().Updates()
+	c.Assert(err, IsNil)
+
+	var channels []string
+	for channel := range requests {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	c.Assert(channels, DeepEquals, []string{"edge", "stable"})
+	c.Check(requests["stable"], Equals, `{"name":["bar"]}`)
+	c.Check(requests["edge"], Equals, `{"name":["foo","baz"]}`)
+}
+
+func (s *SnapTestSuite) TestUpdateSnapNotInStore(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer mockServer.Close()
+
+	var err error
+	storeDetailsURI, err = url.Parse(mockServer.URL + "/details/")
+	c.Assert(err, IsNil)
+
+	snapFile := makeTestSnapPackage(c, "")
+	_, err = installClick(snapFile, 0, nil, testNamespace)
+	c.Assert(err, IsNil)
+
+	_, err = NewMetaStoreRepository().Details("foo." + testNamespace)
+	c.Check(err, Equals, ErrPackageNotFound)
+
+	part, err := UpdateSnap("foo", 0, nil)
+	c.Check(err, Equals, ErrPackageNotFound)
+	c.Check(part, IsNil)
+}
@@ -37,6 +37,8 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -354,7 +356,11 @@ func binPathForBinary(pkgPath string, binary Binary) string {
 }
 
 func verifyBinariesYaml(binary Binary) error {
-	return verifyStructStringsAgainstWhitelist(binary, servicesBinariesStringsWhitelist)
+	if err := verifyStructStringsAgainstWhitelist(binary, servicesBinariesStringsWhitelist); err != nil {
+		return err
+	}
+
+	return binary.ResourceLimits.verify()
 }
 
 func generateSnapBinaryWrapper(binary Binary, pkgPath, aaProfile string, m *packageYaml) (string, error) {
@@ -400,8 +406,17 @@ export HOME="$SNAP_APP_USER_DATA_PATH"
 # export old pwd
 export SNAP_OLD_PWD="$(pwd)"
 cd {{.Path}}
-ubuntu-core-launcher {{.UdevAppName}} {{.AaProfile}} {{.Target}} "$@"
-`
+{{if .LimitProperties}}
+# run in a transient scope with the resource limits of the binary, only
+# root gets one as users may have no systemd user manager and it could
+# not limit memory nor cpu anyway
+if [ "$(id -u)" = "0" ]; then
+    systemd-run --scope --quiet{{range .LimitProperties}} -p {{.}}{{end}} ubuntu-core-launcher {{.UdevAppName}} {{.AaProfile}} {{.Target}} "$@"
+else
+    ubuntu-core-launcher {{.UdevAppName}} {{.AaProfile}} {{.Target}} "$@"
+fi
+{{else}}ubuntu-core-launcher {{.UdevAppName}} {{.AaProfile}} {{.Target}} "$@"
+{{end}}`
 
 	// it's fine for this to error out; we might be in a framework or sth
 	namespace, _ := namespaceFromYamlPath(filepath.Join(pkgPath, "meta", "package.yaml"))
@@ -416,24 +431,31 @@ ubuntu-core-launcher {{.UdevAppName}} {{.AaProfile}} {{.Target}} "$@"
 		return "", err
 	}
 
+	limits, err := systemdLimits(m.Name, binary.ResourceLimits)
+	if err != nil {
+		return "", err
+	}
+
 	var templateOut bytes.Buffer
 	t := template.Must(template.New("wrapper").Parse(wrapperTemplate))
 	wrapperData := struct {
-		Name        string
-		Version     string
-		Target      string
-		Path        string
-		AaProfile   string
-		UdevAppName string
-		Namespace   string
+		Name            string
+		Version         string
+		Target          string
+		Path            string
+		AaProfile       string
+		UdevAppName     string
+		Namespace       string
+		LimitProperties []string
 	}{
-		Name:        m.Name,
-		Version:     m.Version,
-		Target:      actualBinPath,
-		Path:        pkgPath,
-		AaProfile:   aaProfile,
-		UdevAppName: udevPartName,
-		Namespace:   namespace,
+		Name:            m.Name,
+		Version:         m.Version,
+		Target:          actualBinPath,
+		Path:            pkgPath,
+		AaProfile:       aaProfile,
+		UdevAppName:     udevPartName,
+		Namespace:       namespace,
+		LimitProperties: limits.RuntimeProperties(),
 	}
 	t.Execute(&templateOut, wrapperData)
 
@@ -460,12 +482,16 @@ func verifyStructStringsAgainstWhitelist(s interface{}, whitelist string) error
 		if v.Field(i).Kind() == reflect.Ptr {
 			vi := v.Field(i).Elem()
 			if vi.Kind() == reflect.Struct {
-				return verifyStructStringsAgainstWhitelist(vi.Interface(), whitelist)
+				if err := verifyStructStringsAgainstWhitelist(vi.Interface(), whitelist); err != nil {
+					return err
+				}
 			}
 		}
 		if v.Field(i).Kind() == reflect.Struct {
 			vi := v.Field(i).Interface()
-			return verifyStructStringsAgainstWhitelist(vi, whitelist)
+			if err := verifyStructStringsAgainstWhitelist(vi, whitelist); err != nil {
+				return err
+			}
 		}
 		if v.Field(i).Kind() == reflect.String {
 			key := t.Field(i).Name
@@ -483,8 +509,141 @@ func verifyStructStringsAgainstWhitelist(s interface{}, whitelist string) error
 	return nil
 }
 
+// restartConditions maps the restart-condition of a service to the
+// Restart= setting of its unit
+var restartConditions = map[string]string{
+	"always":     "always",
+	"on-failure": "on-failure",
+	"never":      "no",
+}
+
+// serviceTypes are the types a service may have
+var serviceTypes = map[string]bool{
+	"simple":  true,
+	"forking": true,
+	"oneshot": true,
+	"notify":  true,
+}
+
+// environmentNameWhitelist is the whitelist of the names in the
+// "environment" of a service
+const environmentNameWhitelist = `^[A-Za-z_][A-Za-z0-9_]*$`
+
+// isReservedEnvironmentName returns true for the variables snappy sets
+// for the services itself
+func isReservedEnvironmentName(name string) bool {
+	return name == "TMPDIR" || strings.HasPrefix(name, "SNAP_") || strings.HasPrefix(name, "SNAPP_")
+}
+
 func verifyServiceYaml(service Service) error {
-	return verifyStructStringsAgainstWhitelist(service, servicesBinariesStringsWhitelist)
+	if err := verifyStructStringsAgainstWhitelist(service, servicesBinariesStringsWhitelist); err != nil {
+		return err
+	}
+
+	if _, ok := restartConditions[service.RestartCondition]; service.RestartCondition != "" && !ok {
+		return &ErrInvalidServiceOption{service: service.Name, option: "restart-condition", value: service.RestartCondition, msg: "use always, on-failure or never"}
+	}
+	if service.RestartDelay < 0 {
+		return &ErrInvalidServiceOption{service: service.Name, option: "restart-delay", value: service.RestartDelay.String(), msg: "must not be negative"}
+	}
+
+	if service.Type != "" {
+		if !serviceTypes[service.Type] {
+			return &ErrInvalidServiceOption{service: service.Name, option: "type", value: service.Type, msg: "use simple, forking, oneshot or notify"}
+		}
+		if service.BusName != "" {
+			return &ErrInvalidServiceOption{service: service.Name, option: "type", value: service.Type, msg: "services with a bus-name are of type dbus"}
+		}
+		if service.Type == "oneshot" && service.RestartCondition == "always" {
+			return &ErrInvalidServiceOption{service: service.Name, option: "type", value: service.Type, msg: "oneshot services can not be restarted always"}
+		}
+	}
+
+	nameWhitelist := regexp.MustCompile(environmentNameWhitelist)
+	valueWhitelist := regexp.MustCompile(servicesBinariesStringsWhitelist)
+	for name, value := range service.Environment {
+		if !nameWhitelist.MatchString(name) || isReservedEnvironmentName(name) {
+			return &ErrInvalidServiceOption{service: service.Name, option: "environment variable", value: name, msg: "not a valid name or set by snappy"}
+		}
+		if !valueWhitelist.MatchString(value) {
+			return &ErrStructIllegalContent{
+				field:     "Environment",
+				content:   value,
+				whitelist: servicesBinariesStringsWhitelist,
+			}
+		}
+	}
+
+	if service.SocketActivation {
+		if _, _, err := socketListenAddresses(service); err != nil {
+			return err
+		}
+	}
+
+	if service.HealthCheck != nil {
+		if err := verifyHealthCheck(service.Name, service.HealthCheck); err != nil {
+			return err
+		}
+	}
+
+	return service.ResourceLimits.verify()
+}
+
+// verifyHealthCheck checks that the health-check of a service runs a
+// command of the snap
+func verifyHealthCheck(serviceName string, check *HealthCheck) error {
+	if err := verifyStructStringsAgainstWhitelist(*check, servicesBinariesStringsWhitelist); err != nil {
+		return err
+	}
+
+	args := strings.Fields(check.Command)
+	if len(args) == 0 || filepath.IsAbs(args[0]) || strings.HasPrefix(filepath.Clean(args[0]), "..") {
+		return &ErrInvalidServiceOption{service: serviceName, option: "health-check", value: check.Command, msg: "the command must be relative to the snap"}
+	}
+	if check.Timeout < 0 || check.Retries < 0 {
+		return &ErrInvalidServiceOption{service: serviceName, option: "health-check", value: check.Command, msg: "timeout and retries must not be negative"}
+	}
+
+	return nil
+}
+
+// socketListenAddresses returns the stream (tcp) and datagram (udp)
+// ports the socket of the given socket activated service listens on,
+// from its external ports (e.g. "80/tcp")
+func socketListenAddresses(service Service) (streams, datagrams []string, err error) {
+	if service.Ports == nil || len(service.Ports.External) == 0 {
+		return nil, nil, &ErrInvalidServiceOption{service: service.Name, option: "socket-activation", value: "true", msg: "the service has no external ports"}
+	}
+
+	// sorted by tag name, so the socket unit does not change between
+	// updates
+	tags := make([]string, 0, len(service.Ports.External))
+	for tag := range service.Ports.External {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	for _, tag := range tags {
+		port := service.Ports.External[tag].Port
+		parts := strings.Split(port, "/")
+		if len(parts) != 2 {
+			return nil, nil, &ErrInvalidServiceOption{service: service.Name, option: "port", value: port, msg: "use number/protocol, e.g. 80/tcp"}
+		}
+		if n, err := strconv.Atoi(parts[0]); err != nil || n < 1 || n > 65535 {
+			return nil, nil, &ErrInvalidServiceOption{service: service.Name, option: "port", value: port, msg: "not a port number"}
+		}
+
+		switch parts[1] {
+		case "tcp":
+			streams = append(streams, parts[0])
+		case "udp":
+			datagrams = append(datagrams, parts[0])
+		default:
+			return nil, nil, &ErrInvalidServiceOption{service: service.Name, option: "port", value: port, msg: "the protocol must be tcp or udp"}
+		}
+	}
+
+	return streams, datagrams, nil
 }
 
 func generateSnapServicesFile(service Service, baseDir string, aaProfile string, m *packageYaml) (string, error) {
@@ -497,21 +656,52 @@ func generateSnapServicesFile(service Service, baseDir string, aaProfile string,
 		return "", err
 	}
 
+	limits, err := systemdLimits(m.Name, service.ResourceLimits)
+	if err != nil {
+		return "", err
+	}
+
 	return systemd.New(globalRootDir, nil).GenServiceFile(
 		&systemd.ServiceDescription{
-			AppName:     m.Name,
-			ServiceName: service.Name,
-			Version:     m.Version,
-			Description: service.Description,
-			AppPath:     baseDir,
-			Start:       service.Start,
-			Stop:        service.Stop,
-			PostStop:    service.PostStop,
-			StopTimeout: time.Duration(service.StopTimeout),
-			AaProfile:   aaProfile,
-			IsFramework: m.Type == SnapTypeFramework,
-			BusName:     service.BusName,
-			UdevAppName: udevPartName,
+			AppName:      m.Name,
+			ServiceName:  service.Name,
+			Version:      m.Version,
+			Description:  service.Description,
+			AppPath:      baseDir,
+			Start:        service.Start,
+			Stop:         service.Stop,
+			PostStop:     service.PostStop,
+			StopTimeout:  time.Duration(service.StopTimeout),
+			AaProfile:    aaProfile,
+			IsFramework:  m.Type == SnapTypeFramework,
+			BusName:      service.BusName,
+			UdevAppName:  udevPartName,
+			Restart:      restartConditions[service.RestartCondition],
+			RestartDelay: time.Duration(service.RestartDelay),
+			Type:         service.Type,
+			Environment:  service.Environment,
+			Limits:       limits,
+		}), nil
+}
+
+func generateSnapSocketFile(service Service, m *packageYaml) (string, error) {
+	if err := verifyServiceYaml(service); err != nil {
+		return "", err
+	}
+
+	streams, datagrams, err := socketListenAddresses(service)
+	if err != nil {
+		return "", err
+	}
+
+	return systemd.New(globalRootDir, nil).GenSocketFile(
+		&systemd.ServiceDescription{
+			AppName:         m.Name,
+			ServiceName:     service.Name,
+			Version:         m.Version,
+			Description:     service.Description,
+			ListenStreams:   streams,
+			ListenDatagrams: datagrams,
 		}), nil
 }
 
@@ -519,6 +709,20 @@ func generateServiceFileName(m *packageYaml, service Service) string {
 	return filepath.Join(snapServicesDir, fmt.Sprintf("%s_%s_%s.service", m.Name, service.Name, m.Version))
 }
 
+func generateSocketFileName(m *packageYaml, service Service) string {
+	return filepath.Join(snapServicesDir, fmt.Sprintf("%s_%s_%s.socket", m.Name, service.Name, m.Version))
+}
+
+// activationUnitName returns the unit that starts the given service,
+// its socket if it is socket activated
+func activationUnitName(m *packageYaml, service Service) string {
+	if service.SocketActivation {
+		return filepath.Base(generateSocketFileName(m, service))
+	}
+
+	return filepath.Base(generateServiceFileName(m, service))
+}
+
 func generateBusPolicyFileName(m *packageYaml, service Service) string {
 	return filepath.Join(snapBusPolicyDir, fmt.Sprintf("%s_%s_%s.conf", m.Name, service.Name, m.Version))
 }
@@ -552,22 +756,7 @@ func addPackageServices(baseDir string, inhibitHooks bool, inter interacter) err
 	}
 
 	for _, service := range m.Services {
-		aaProfile, err := getSecurityProfile(m, service.Name, baseDir)
-		if err != nil {
-			return err
-		}
-		// this will remove the global base dir when generating the
-		// service file, this ensures that /apps/foo/1.0/bin/start
-		// is in the service file when the SetRoot() option
-		// is used
-		realBaseDir := stripGlobalRootDir(baseDir)
-		content, err := generateSnapServicesFile(service, realBaseDir, aaProfile, m)
-		if err != nil {
-			return err
-		}
-		serviceFilename := generateServiceFileName(m, service)
-		helpers.EnsureDir(filepath.Dir(serviceFilename), 0755)
-		if err := ioutil.WriteFile(serviceFilename, []byte(content), 0644); err != nil {
+		if err := writeServiceFile(m, service, baseDir); err != nil {
 			return err
 		}
 
@@ -589,7 +778,9 @@ func addPackageServices(baseDir string, inhibitHooks bool, inter interacter) err
 		// inhibitHooks mode
 		//
 		// *but* always run enable (which just sets a symlink)
-		serviceName := filepath.Base(generateServiceFileName(m, service))
+		//
+		// socket activated services are started by their socket
+		serviceName := activationUnitName(m, service)
 		sysd := systemd.New(globalRootDir, inter)
 		if !inhibitHooks {
 			if err := sysd.DaemonReload(); err != nil {
@@ -597,6 +788,11 @@ func addPackageServices(baseDir string, inhibitHooks bool, inter interacter) err
 			}
 		}
 
+		// services that were disabled stay disabled across updates
+		if isServiceDisabled(m.Name, service.Name) {
+			continue
+		}
+
 		// we always enable the service even in inhibit hooks
 		if err := sysd.Enable(serviceName); err != nil {
 			return err
@@ -612,6 +808,39 @@ func addPackageServices(baseDir string, inhibitHooks bool, inter interacter) err
 	return nil
 }
 
+// writeServiceFile writes the systemd unit of the given service, and
+// the one of its socket if it is socket activated
+func writeServiceFile(m *packageYaml, service Service, baseDir string) error {
+	aaProfile, err := getSecurityProfile(m, service.Name, baseDir)
+	if err != nil {
+		return err
+	}
+	// this will remove the global base dir when generating the
+	// service file, this ensures that /apps/foo/1.0/bin/start
+	// is in the service file when the SetRoot() option
+	// is used
+	realBaseDir := stripGlobalRootDir(baseDir)
+	content, err := generateSnapServicesFile(service, realBaseDir, aaProfile, m)
+	if err != nil {
+		return err
+	}
+	serviceFilename := generateServiceFileName(m, service)
+	helpers.EnsureDir(filepath.Dir(serviceFilename), 0755)
+	if err := ioutil.WriteFile(serviceFilename, []byte(content), 0644); err != nil {
+		return err
+	}
+
+	if !service.SocketActivation {
+		return nil
+	}
+	content, err = generateSnapSocketFile(service, m)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(generateSocketFileName(m, service), []byte(content), 0644)
+}
+
 func removePackageServices(baseDir string, inter interacter) error {
 	m, err := parsePackageYamlFile(filepath.Join(baseDir, "meta", "package.yaml"))
 	if err != nil {
@@ -619,6 +848,21 @@ func removePackageServices(baseDir string, inter interacter) error {
 	}
 	sysd := systemd.New(globalRootDir, inter)
 	for _, service := range m.Services {
+		// the socket goes first, so it does not start the service
+		// again
+		if service.SocketActivation {
+			socketName := filepath.Base(generateSocketFileName(m, service))
+			if err := sysd.Disable(socketName); err != nil {
+				return err
+			}
+			if err := sysd.Stop(socketName, time.Duration(service.StopTimeout)); err != nil {
+				return err
+			}
+			if err := os.Remove(generateSocketFileName(m, service)); err != nil && !os.IsNotExist(err) {
+				log.Printf("Warning: failed to remove socket file for %s: %v", socketName, err)
+			}
+		}
+
 		serviceName := filepath.Base(generateServiceFileName(m, service))
 		if err := sysd.Disable(serviceName); err != nil {
 			return err
@@ -852,51 +1096,71 @@ func writeCompatManifestJSON(clickMetaDir string, manifestData []byte, namespace
 	return nil
 }
 
-func installClick(snapFile string, flags InstallFlags, inter interacter, namespace string) (name string, err error) {
+// installClick installs the given snap, if the health checks of its
+// services fail the previous version is made active again
+func installClick(snapFile string, flags InstallFlags, inter interacter, namespace string) (string, error) {
+	name, oldDir, err := activateClick(snapFile, flags, inter, namespace)
+	if err != nil {
+		return "", err
+	}
+
+	if (flags & InhibitHooks) == 0 {
+		if err := checkHealthOrRollback(name, oldDir, inter); err != nil {
+			return "", err
+		}
+	}
+
+	return name, nil
+}
+
+// activateClick unpacks the given snap and makes it active, it returns
+// the name of the snap and the directory of the version that was active
+// before (if any)
+func activateClick(snapFile string, flags InstallFlags, inter interacter, namespace string) (name string, oldDir string, err error) {
 	allowUnauthenticated := (flags & AllowUnauthenticated) != 0
 	if err := auditClick(snapFile, allowUnauthenticated); err != nil {
-		return "", err
+		return "", "", err
 		// ?
 		//return SnapAuditError
 	}
 
 	d, err := clickdeb.Open(snapFile)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	defer d.Close()
 
 	manifestData, err := d.ControlMember("manifest")
 	if err != nil {
 		log.Printf("Snap inspect failed: %s", snapFile)
-		return "", err
+		return "", "", err
 	}
 
 	manifest, err := readClickManifest([]byte(manifestData))
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	yamlData, err := d.MetaMember("package.yaml")
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	m, err := parsePackageYamlData(yamlData)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if err := m.checkForPackageInstalled(namespace); err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if err := m.checkForNameClashes(); err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if err := m.checkForFrameworks(); err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	targetDir := snapAppsDir
@@ -910,16 +1174,16 @@ func installClick(snapFile string, flags InstallFlags, inter interacter, namespa
 			if currentOEM, err := getOem(); err == nil {
 				if currentOEM.Name != manifest.Name {
 					fmt.Println(currentOEM.Name, manifest.Name)
-					return "", ErrOEMPackageInstall
+					return "", "", ErrOEMPackageInstall
 				}
 			} else {
 				// there should always be an oem package now
-				return "", ErrOEMPackageInstall
+				return "", "", ErrOEMPackageInstall
 			}
 		}
 
 		if err := installOemHardwareUdevRules(m); err != nil {
-			return "", err
+			return "", "", err
 		}
 	}
 
@@ -932,10 +1196,19 @@ func installClick(snapFile string, flags InstallFlags, inter interacter, namespa
 	currentActiveDir, _ := filepath.EvalSymlinks(filepath.Join(instDir, "..", "current"))
 
 	if err := m.checkLicenseAgreement(inter, d, currentActiveDir); err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	dataDir := filepath.Join(snapDataDir, fullName, manifest.Version)
+	inhibitHooks := (flags & InhibitHooks) != 0
+
+	// the deferred cleanups below do not help if we get killed, so
+	// every step is journaled for Recover() first
+	journal := newInstallJournal(fullName, manifest.Version, instDir, currentActiveDir, inhibitHooks)
+	if err := journal.step(installStepUnpack); err != nil {
+		return "", "", err
+	}
+	defer journal.remove()
 
 	if err := helpers.EnsureDir(instDir, 0755); err != nil {
 		log.Printf("WARNING: Can not create %s", instDir)
@@ -953,25 +1226,27 @@ func installClick(snapFile string, flags InstallFlags, inter interacter, namespa
 	// we need to call the external helper so that we can reliable drop
 	// privs
 	if err := unpackWithDropPrivs(d, instDir); err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	// legacy, the hooks (e.g. apparmor) need this. Once we converted
 	// all hooks this can go away
 	clickMetaDir := path.Join(instDir, ".click", "info")
 	if err := os.MkdirAll(clickMetaDir, 0755); err != nil {
-		return "", err
+		return "", "", err
 	}
 	if err := writeCompatManifestJSON(clickMetaDir, manifestData, namespace); err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	// write the hashes now
 	if err := writeHashesFile(d, instDir); err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	inhibitHooks := (flags & InhibitHooks) != 0
+	if err := journal.step(installStepData); err != nil {
+		return "", "", err
+	}
 
 	// deal with the data:
 	//
@@ -983,7 +1258,7 @@ func installClick(snapFile string, flags InstallFlags, inter interacter, namespa
 	if currentActiveDir != "" {
 		oldManifest, err := readClickManifestFromClickDir(currentActiveDir)
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 
 		// we need to stop making it active
@@ -996,7 +1271,7 @@ func installClick(snapFile string, flags InstallFlags, inter interacter, namespa
 			}
 		}()
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 
 		err = copySnapData(fullName, oldManifest.Version, manifest.Version)
@@ -1013,10 +1288,13 @@ func installClick(snapFile string, flags InstallFlags, inter interacter, namespa
 	}()
 
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	// and finally make active
+	if err = journal.step(installStepActivate); err != nil {
+		return "", "", err
+	}
 	err = setActiveClick(instDir, inhibitHooks, inter)
 	defer func() {
 		if err != nil && currentActiveDir != "" {
@@ -1026,19 +1304,22 @@ func installClick(snapFile string, flags InstallFlags, inter interacter, namespa
 		}
 	}()
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+	if err = journal.step(installStepActivated); err != nil {
+		return "", "", err
 	}
 
 	// oh, one more thing: refresh the security bits
 	if !inhibitHooks {
 		part, err := NewSnapPartFromYaml(filepath.Join(instDir, "meta", "package.yaml"), namespace, m)
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 
 		deps, err := part.Dependents()
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
 
 		sysd := systemd.New(globalRootDir, inter)
@@ -1062,14 +1343,14 @@ func installClick(snapFile string, flags InstallFlags, inter interacter, namespa
 				timeout := time.Duration(svc.StopTimeout)
 				if err = sysd.Stop(serviceName, timeout); err != nil {
 					inter.Notify(fmt.Sprintf("unable to stop %s; aborting install: %s", serviceName, err))
-					return "", err
+					return "", "", err
 				}
 				stopped[serviceName] = timeout
 			}
 		}
 
 		if err := part.RefreshDependentsSecurity(currentActiveDir, inter); err != nil {
-			return "", err
+			return "", "", err
 		}
 
 		started := make(map[string]time.Duration)
@@ -1085,13 +1366,13 @@ func installClick(snapFile string, flags InstallFlags, inter interacter, namespa
 		for serviceName, timeout := range stopped {
 			if err = sysd.Start(serviceName); err != nil {
 				inter.Notify(fmt.Sprintf("unable to restart %s; aborting install: %s", serviceName, err))
-				return "", err
+				return "", "", err
 			}
 			started[serviceName] = timeout
 		}
 	}
 
-	return manifest.Name, nil
+	return manifest.Name, currentActiveDir, nil
 }
 
 // removeSnapData removes the data for the given version of the given snap
@@ -26,6 +26,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/mvo5/goconfigparser"
 	. "launchpad.net/gocheck"
@@ -1159,6 +1160,69 @@ services:
 	c.Assert(err, NotNil)
 }
 
+func (s *SnapTestSuite) TestAddRemovePackageServicesSocketActivation(c *C) {
+	var calls [][]string
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		calls = append(calls, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	}
+
+	yamlFile, err := makeInstalledMockSnap(s.tempdir, `name: foo
+version: 1.0
+vendor: Foo Bar <foo@example.com>
+services:
+ - name: web
+   start: bin/web
+   socket-activation: true
+   ports:
+     external:
+       ui:
+         port: 8080/tcp
+       discovery:
+         port: 5353/udp
+`)
+	c.Assert(err, IsNil)
+	baseDir := filepath.Dir(filepath.Dir(yamlFile))
+	c.Assert(addPackageServices(baseDir, false, &MockProgressMeter{}), IsNil)
+
+	content, err := ioutil.ReadFile(filepath.Join(snapServicesDir, "foo_web_1.0.socket"))
+	c.Assert(err, IsNil)
+	c.Check(string(content), Matches, `(?s).*\nListenStream=8080\nListenDatagram=5353\nService=foo_web_1.0.service\n.*`)
+	c.Check(helpers.FileExists(filepath.Join(snapServicesDir, "foo_web_1.0.service")), Equals, true)
+
+	// the socket is enabled and started instead of the service
+	_, err = os.Lstat(filepath.Join(snapServicesDir, "sockets.target.wants", "foo_web_1.0.socket"))
+	c.Check(err, IsNil)
+	_, err = os.Lstat(filepath.Join(snapServicesDir, "multi-user.target.wants", "foo_web_1.0.service"))
+	c.Check(os.IsNotExist(err), Equals, true)
+	c.Check(calls[len(calls)-1], DeepEquals, []string{"start", "foo_web_1.0.socket"})
+
+	// and stopped before the service on removal
+	calls = nil
+	c.Assert(removePackageServices(baseDir, &MockProgressMeter{}), IsNil)
+	c.Check(calls[0], DeepEquals, []string{"--root", s.tempdir, "disable", "foo_web_1.0.socket"})
+	c.Check(calls[1], DeepEquals, []string{"stop", "foo_web_1.0.socket"})
+	c.Check(helpers.FileExists(filepath.Join(snapServicesDir, "foo_web_1.0.socket")), Equals, false)
+	c.Check(helpers.FileExists(filepath.Join(snapServicesDir, "foo_web_1.0.service")), Equals, false)
+}
+
+func (s *SnapTestSuite) TestServiceSocketActivationVerify(c *C) {
+	ports := func(port string) *Ports {
+		return &Ports{External: map[string]Port{"ui": {Port: port}}}
+	}
+
+	c.Check(verifyServiceYaml(Service{SocketActivation: true, Ports: ports("80/tcp")}), IsNil)
+	// the ports only matter for socket activated services
+	c.Check(verifyServiceYaml(Service{Ports: ports("80")}), IsNil)
+
+	c.Check(verifyServiceYaml(Service{Name: "svc", SocketActivation: true}), ErrorMatches, `service "svc": invalid socket-activation "true": the service has no external ports`)
+	c.Check(verifyServiceYaml(Service{SocketActivation: true, Ports: &Ports{}}), NotNil)
+	c.Check(verifyServiceYaml(Service{SocketActivation: true, Ports: ports("80")}), ErrorMatches, `.*invalid port "80".*`)
+	c.Check(verifyServiceYaml(Service{SocketActivation: true, Ports: ports("http/tcp")}), NotNil)
+	c.Check(verifyServiceYaml(Service{SocketActivation: true, Ports: ports("70000/tcp")}), NotNil)
+	c.Check(verifyServiceYaml(Service{SocketActivation: true, Ports: ports("80/sctp")}), NotNil)
+}
+
 func (s *SnapTestSuite) TestAddPackageBinariesStripsGlobalRootdir(c *C) {
 	// ensure that even with a global rootdir the paths in the generated
 	// .services file are setup correctly (i.e. that the global root
@@ -1284,6 +1348,44 @@ func (s *SnapTestSuite) TestServiceWhitelistError(c *C) {
 ' (legal: '^[A-Za-z0-9/. _#:-]*$')`)
 }
 
+func (s *SnapTestSuite) TestServiceRestartTypeEnvironment(c *C) {
+	c.Check(verifyServiceYaml(Service{RestartCondition: "on-failure", RestartDelay: SecondsTimeout(time.Second), Type: "forking"}), IsNil)
+	c.Check(verifyServiceYaml(Service{Environment: map[string]string{"PORT": "8080", "_X1": "/a/b c"}}), IsNil)
+
+	c.Check(verifyServiceYaml(Service{Name: "svc", RestartCondition: "sometimes"}), ErrorMatches, `service "svc": invalid restart-condition "sometimes": .*`)
+	c.Check(verifyServiceYaml(Service{RestartDelay: SecondsTimeout(-time.Second)}), NotNil)
+	c.Check(verifyServiceYaml(Service{Type: "idle"}), ErrorMatches, `.*invalid type "idle".*`)
+	c.Check(verifyServiceYaml(Service{Type: "simple", BusName: "foo.bar"}), NotNil)
+	c.Check(verifyServiceYaml(Service{Type: "oneshot", RestartCondition: "always"}), NotNil)
+	c.Check(verifyServiceYaml(Service{Environment: map[string]string{"1X": "foo"}}), NotNil)
+	c.Check(verifyServiceYaml(Service{Environment: map[string]string{"SNAP_APP_PATH": "foo"}}), NotNil)
+	c.Check(verifyServiceYaml(Service{Environment: map[string]string{"X": "foo\nExecStart=/bin/sh"}}), NotNil)
+	c.Check(verifyServiceYaml(Service{Environment: map[string]string{"X": `"`}}), NotNil)
+}
+
+func (s *SnapTestSuite) TestSnappyGenerateSnapServiceRestart(c *C) {
+	m, err := parsePackageYamlData([]byte(`name: foo
+version: 1.0
+vendor: Foo Bar <foo@example.com>
+services:
+ - name: svc
+   start: bin/foo
+   restart-condition: never
+   restart-delay: 5
+   type: oneshot
+   environment:
+     LANG: C
+`))
+	c.Assert(err, IsNil)
+	c.Assert(m.Services, HasLen, 1)
+	c.Check(m.Services[0].RestartDelay, Equals, SecondsTimeout(5*time.Second))
+
+	generated, err := generateSnapServicesFile(m.Services[0], "/apps/foo.mvo/1.0/", "foo.mvo_svc_1.0", m)
+	c.Assert(err, IsNil)
+	c.Check(generated, Matches, `(?s).*\nEnvironment="LANG=C"\n.*`)
+	c.Check(generated, Matches, `(?s).*\nType=oneshot\nRestart=no\nRestartSec=5\n.*`)
+}
+
 func (s *SnapTestSuite) TestBinariesWhitelistSimple(c *C) {
 	c.Assert(verifyBinariesYaml(Binary{Name: "foo"}), IsNil)
 	c.Assert(verifyBinariesYaml(Binary{Exec: "foo"}), IsNil)
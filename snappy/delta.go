@@ -0,0 +1,263 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"launchpad.net/snappy/clickdeb"
+	"launchpad.net/snappy/helpers"
+	"launchpad.net/snappy/progress"
+
+	"gopkg.in/yaml.v2"
+)
+
+// errNoDelta is returned if there is no delta that can be used for an
+// update, this is not a problem, the full snap is downloaded instead
+var errNoDelta = errors.New("no usable delta")
+
+// remoteDelta is a delta from an older version of a snap as advertised
+// by the store
+type remoteDelta struct {
+	FromVersion     string `json:"from_version"`
+	Format          string `json:"format"`
+	AnonDownloadURL string `json:"anon_download_url,omitempty"`
+	DownloadURL     string `json:"download_url,omitempty"`
+	DownloadSha512  string `json:"download_sha512,omitempty"`
+	DownloadSize    int64  `json:"binary_filesize,omitempty"`
+}
+
+// deltaPatcher applies a delta of a given format with an external tool
+type deltaPatcher struct {
+	tool string
+	args func(old, delta, new string) []string
+}
+
+// the delta formats we know how to apply, useful to override for testing
+var deltaPatchers = map[string]deltaPatcher{
+	"xdelta3": {
+		tool: "xdelta3",
+		args: func(old, delta, new string) []string {
+			return []string{"-d", "-f", "-s", old, delta, new}
+		},
+	},
+	"bsdiff": {
+		tool: "bspatch",
+		args: func(old, delta, new string) []string {
+			return []string{old, new, delta}
+		},
+	},
+}
+
+// supportedDeltaFormats returns the delta formats that can be applied
+// on this system
+func supportedDeltaFormats() []string {
+	var formats []string
+	for format, patcher := range deltaPatchers {
+		if _, err := exec.LookPath(patcher.tool); err == nil {
+			formats = append(formats, format)
+		}
+	}
+	sort.Strings(formats)
+
+	return formats
+}
+
+// applyDelta writes "new" by applying the delta of the given format to
+// "old"
+func applyDelta(format, old, delta, new string) error {
+	patcher, ok := deltaPatchers[format]
+	if !ok {
+		return fmt.Errorf("unknown delta format %q", format)
+	}
+
+	cmd := exec.Command(patcher.tool, patcher.args(old, delta, new)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %s (%q)", patcher.tool, err, output)
+	}
+
+	return nil
+}
+
+// cachedSnapFile returns the path of the cached snap for the given
+// version
+func cachedSnapFile(name, namespace, version string) string {
+	return filepath.Join(snapSnapCacheDir, fmt.Sprintf("%s.%s_%s.snap", name, namespace, version))
+}
+
+// cacheSnap moves the given (installed) snap into the snap cache so that
+// the next update can use a delta against it, older versions of the
+// snap are removed from the cache
+func cacheSnap(snapFile, name, namespace, version string) error {
+	if err := helpers.EnsureDir(snapSnapCacheDir, 0755); err != nil {
+		return err
+	}
+
+	old, err := filepath.Glob(filepath.Join(snapSnapCacheDir, fmt.Sprintf("%s.%s_*.snap", name, namespace)))
+	if err != nil {
+		return err
+	}
+
+	target := cachedSnapFile(name, namespace, version)
+	if err := os.Rename(snapFile, target); err != nil {
+		return err
+	}
+
+	for _, fn := range old {
+		if fn != target {
+			os.Remove(fn)
+		}
+	}
+
+	return nil
+}
+
+// findDelta returns the delta from the given version that can be
+// applied on this system, or nil
+func (s *RemoteSnapPart) findDelta(fromVersion string) *remoteDelta {
+	for i, delta := range s.pkg.Deltas {
+		if delta.FromVersion != fromVersion {
+			continue
+		}
+		patcher, ok := deltaPatchers[delta.Format]
+		if !ok {
+			continue
+		}
+		if _, err := exec.LookPath(patcher.tool); err != nil {
+			continue
+		}
+
+		return &s.pkg.Deltas[i]
+	}
+
+	return nil
+}
+
+// downloadDelta downloads the delta from the installed version of the
+// snap and applies it to the cached snap of that version. It returns
+// the resulting snap, which is checked against the sha512 of the store
+// and the archive-sha512 of its meta/hashes.yaml.
+//
+// errNoDelta is returned if there is no delta or no cached snap to
+// apply it to.
+func (s *RemoteSnapPart) downloadDelta(pbar progress.Meter) (string, error) {
+	current := ActiveSnapByName(s.pkg.Name)
+	if current == nil || current.Namespace() != s.pkg.Namespace {
+		return "", errNoDelta
+	}
+
+	old := cachedSnapFile(s.pkg.Name, s.pkg.Namespace, current.Version())
+	if !helpers.FileExists(old) {
+		return "", errNoDelta
+	}
+
+	delta := s.findDelta(current.Version())
+	if delta == nil {
+		return "", errNoDelta
+	}
+
+	url := delta.AnonDownloadURL
+	if url == "" {
+		url = delta.DownloadURL
+	}
+
+	name := fmt.Sprintf("%s.%s_%s_%s.delta", s.pkg.Name, s.pkg.Namespace, delta.FromVersion, s.pkg.Version)
+	d := newSnapDownload(snapDownloadCacheDir, name, url, pbar)
+	deltaFile, size, hexdigest, err := d.run()
+	if err != nil {
+		return "", err
+	}
+	defer d.remove()
+
+	if delta.DownloadSize > 0 && size != delta.DownloadSize {
+		return "", &ErrDownloadSizeMismatch{snap: name, expected: delta.DownloadSize, got: size}
+	}
+	if delta.DownloadSha512 != "" && hexdigest != delta.DownloadSha512 {
+		return "", &ErrDownloadHashMismatch{snap: name, expected: delta.DownloadSha512, got: hexdigest}
+	}
+
+	target := filepath.Join(snapDownloadCacheDir, fmt.Sprintf("%s.%s_%s.snap", s.pkg.Name, s.pkg.Namespace, s.pkg.Version))
+	if err := applyDelta(delta.Format, old, deltaFile, target); err != nil {
+		os.Remove(target)
+		return "", err
+	}
+
+	if err := s.verifyPatchedSnap(target); err != nil {
+		os.Remove(target)
+		return "", err
+	}
+
+	return target, nil
+}
+
+// verifyPatchedSnap checks the snap that was made from a delta
+func (s *RemoteSnapPart) verifyPatchedSnap(snapFile string) error {
+	st, err := os.Stat(snapFile)
+	if err != nil {
+		return err
+	}
+	hexdigest, err := helpers.Sha512sum(snapFile)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyDownload(st.Size(), hexdigest); err != nil {
+		return err
+	}
+
+	return verifyArchiveHash(snapFile, s.pkg.Name)
+}
+
+// verifyArchiveHash checks the data of the given snap against the
+// archive-sha512 of its meta/hashes.yaml
+func verifyArchiveHash(snapFile, name string) error {
+	d, err := clickdeb.Open(snapFile)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	hashesData, err := d.ControlMember("hashes.yaml")
+	if err != nil {
+		return err
+	}
+
+	var h hashesYaml
+	if err := yaml.Unmarshal(hashesData, &h); err != nil {
+		return err
+	}
+
+	hexdigest, err := d.DataSha512()
+	if err != nil {
+		return err
+	}
+
+	if h.ArchiveSha512 == "" || hexdigest != h.ArchiveSha512 {
+		return &ErrArchiveHashMismatch{
+			snap:     name,
+			expected: h.ArchiveSha512,
+			got:      hexdigest,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"launchpad.net/snappy/helpers"
+
+	. "launchpad.net/gocheck"
+)
+
+// mockDeltaStore serves "delta" as the delta and "full" as the full snap
+type mockDeltaStore struct {
+	server        *httptest.Server
+	deltaRequests int
+	fullRequests  int
+}
+
+// setupDeltaUpdate installs version 1.0 of foo.bar (and caches its snap)
+// and returns a RemoteSnapPart for version 2.0 with a delta from 1.0.
+// The delta format "test" just copies the delta, so a delta that is
+// the full 2.0 snap works.
+func (s *SnapTestSuite) setupDeltaUpdate(c *C, delta string) (*RemoteSnapPart, *mockDeltaStore) {
+	deltaPatchers["test"] = deltaPatcher{
+		tool: "cp",
+		args: func(old, delta, new string) []string {
+			return []string{delta, new}
+		},
+	}
+
+	v1 := makeTestSnapPackage(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	_, err := installClick(v1, 0, nil, "bar")
+	c.Assert(err, IsNil)
+	c.Assert(cacheSnap(v1, "foo", "bar", "1.0"), IsNil)
+
+	full := makeTestSnapPackage(c, "name: foo\nversion: 2.0\nvendor: Foo <foo@example.com>\n")
+	sha512, err := helpers.Sha512sum(full)
+	c.Assert(err, IsNil)
+	if delta == "" {
+		delta = full
+	}
+
+	store := &mockDeltaStore{}
+	store.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/delta":
+			store.deltaRequests++
+			http.ServeFile(w, r, delta)
+		case "/snap":
+			store.fullRequests++
+			http.ServeFile(w, r, full)
+		}
+	}))
+
+	snap := NewRemoteSnapPart(remoteSnap{
+		Name:            "foo",
+		Namespace:       "bar",
+		Version:         "2.0",
+		AnonDownloadURL: store.server.URL + "/snap",
+		DownloadSha512:  sha512,
+		Deltas: []remoteDelta{
+			{FromVersion: "1.0", Format: "test", AnonDownloadURL: store.server.URL + "/delta"},
+		},
+	})
+
+	return snap, store
+}
+
+func (s *SnapTestSuite) TestRemoteSnapInstallWithDelta(c *C) {
+	defer delete(deltaPatchers, "test")
+	snap, store := s.setupDeltaUpdate(c, "")
+	defer store.server.Close()
+
+	name, err := snap.Install(&MockProgressMeter{}, 0)
+	c.Assert(err, IsNil)
+	c.Check(name, Equals, "foo")
+	c.Check(store.deltaRequests, Equals, 1)
+	c.Check(store.fullRequests, Equals, 0)
+
+	// the new snap is the base for the next delta
+	c.Check(helpers.FileExists(cachedSnapFile("foo", "bar", "2.0")), Equals, true)
+	c.Check(helpers.FileExists(cachedSnapFile("foo", "bar", "1.0")), Equals, false)
+}
+
+func (s *SnapTestSuite) TestRemoteSnapInstallBadDeltaFallsBack(c *C) {
+	defer delete(deltaPatchers, "test")
+	// the "patched" snap is the old one, so it does not match the sha512
+	snap, store := s.setupDeltaUpdate(c, cachedSnapFile("foo", "bar", "1.0"))
+	defer store.server.Close()
+
+	name, err := snap.Install(&MockProgressMeter{}, 0)
+	c.Assert(err, IsNil)
+	c.Check(name, Equals, "foo")
+	c.Check(store.deltaRequests, Equals, 1)
+	c.Check(store.fullRequests, Equals, 1)
+}
+
+func (s *SnapTestSuite) TestRemoteSnapInstallNoCachedSnap(c *C) {
+	defer delete(deltaPatchers, "test")
+	snap, store := s.setupDeltaUpdate(c, "")
+	defer store.server.Close()
+	c.Assert(os.Remove(cachedSnapFile("foo", "bar", "1.0")), IsNil)
+
+	_, err := snap.downloadDelta(nil)
+	c.Assert(err, Equals, errNoDelta)
+
+	_, err = snap.Install(&MockProgressMeter{}, 0)
+	c.Assert(err, IsNil)
+	c.Check(store.deltaRequests, Equals, 0)
+	c.Check(store.fullRequests, Equals, 1)
+}
+
+func (s *SnapTestSuite) TestVerifyArchiveHash(c *C) {
+	snapFile := makeTestSnapPackage(c, "")
+	c.Assert(verifyArchiveHash(snapFile, "foo"), IsNil)
+}
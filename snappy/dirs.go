@@ -31,6 +31,20 @@ var (
 	snapSeccompDir   string
 	snapUdevRulesDir string
 
+	snapDownloadCacheDir string
+	snapMetadataCacheDir string
+	snapSnapCacheDir     string
+	snapSourcesDir       string
+	snapChannelsFile     string
+	snapHoldsFile        string
+	snapRetentionFile    string
+	snapServicesFile     string
+	snapLimitsFile       string
+
+	snapTransactionJournalFile string
+	snapInstallJournalDir      string
+	snapSnapshotsDir           string
+
 	snapBinariesDir  string
 	snapServicesDir  string
 	snapBusPolicyDir string
@@ -60,4 +74,17 @@ func SetRootDir(rootdir string) {
 	cloudMetaDataFile = filepath.Join(rootdir, "/var/lib/cloud/seed/nocloud-net/meta-data")
 
 	snapUdevRulesDir = filepath.Join(rootdir, "/etc/udev/rules.d")
+
+	snapDownloadCacheDir = filepath.Join(rootdir, "/var/lib/snappy/cache/downloads")
+	snapMetadataCacheDir = filepath.Join(rootdir, "/var/lib/snappy/cache/metadata")
+	snapSnapCacheDir = filepath.Join(rootdir, "/var/lib/snappy/cache/snaps")
+	snapSourcesDir = filepath.Join(rootdir, "/etc/snappy/sources.d")
+	snapChannelsFile = filepath.Join(rootdir, "/var/lib/snappy/channels.yaml")
+	snapHoldsFile = filepath.Join(rootdir, "/var/lib/snappy/holds.yaml")
+	snapRetentionFile = filepath.Join(rootdir, "/var/lib/snappy/retention.yaml")
+	snapServicesFile = filepath.Join(rootdir, "/var/lib/snappy/services.yaml")
+	snapLimitsFile = filepath.Join(rootdir, "/var/lib/snappy/limits.yaml")
+	snapTransactionJournalFile = filepath.Join(rootdir, "/var/lib/snappy/update-transaction.yaml")
+	snapInstallJournalDir = filepath.Join(rootdir, "/var/lib/snappy/install-journal")
+	snapSnapshotsDir = filepath.Join(rootdir, "/var/lib/snappy/snapshots")
 }
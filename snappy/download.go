@@ -0,0 +1,277 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"launchpad.net/snappy/helpers"
+	"launchpad.net/snappy/progress"
+)
+
+var (
+	// downloadRetries is the number of attempts made for a single
+	// download before giving up
+	downloadRetries = 5
+
+	// downloadRetryDelay is the delay before the first retry, it is
+	// doubled for every further retry
+	downloadRetryDelay = 2 * time.Second
+)
+
+// errTransientDownload wraps errors that are worth retrying a download for
+type errTransientDownload struct {
+	err error
+}
+
+func (e *errTransientDownload) Error() string {
+	return e.err.Error()
+}
+
+// isTransientDownloadError returns true if the given error is likely to go
+// away when the download is retried, i.e. timeouts, connections that
+// were reset or closed early and the server errors that say so. A bad
+// url or a failed TLS handshake are not.
+func isTransientDownloadError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	switch e := err.(type) {
+	case *errTransientDownload:
+		return true
+	case net.Error:
+		return e.Timeout() || e.Temporary()
+	}
+
+	return err == io.ErrUnexpectedEOF || err == io.EOF
+}
+
+// isNetworkError returns true if the given error means that the server
+// could not be reached, e.g. there is no network or it is down
+func isNetworkError(err error) bool {
+	if isTransientDownloadError(err) {
+		return true
+	}
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	_, ok := err.(net.Error)
+
+	return ok
+}
+
+// snapDownload is a (resumable) download of a single snap into the
+// download cache
+type snapDownload struct {
+	url     string
+	partial string
+	pbar    progress.Meter
+	started bool
+}
+
+// newSnapDownload returns a snapDownload for the given url that keeps
+// its partial data in dir (usually the download cache) under the given
+// name
+func newSnapDownload(dir, name, url string, pbar progress.Meter) *snapDownload {
+	return &snapDownload{
+		url:     url,
+		partial: filepath.Join(dir, name+".partial"),
+		pbar:    pbar,
+	}
+}
+
+// validatorFile is the file that stores the ETag or Last-Modified value
+// of the partial download, sent as If-Range when resuming
+func (d *snapDownload) validatorFile() string {
+	return d.partial + ".validator"
+}
+
+// remove removes all the data of the partial download
+func (d *snapDownload) remove() {
+	os.Remove(d.partial)
+	os.Remove(d.validatorFile())
+}
+
+// run downloads the snap, resuming a previous partial download if
+// possible and retrying with exponential backoff on transient errors. It
+// returns the path to the complete download and its size and sha512.
+func (d *snapDownload) run() (path string, size int64, hexdigest string, err error) {
+	if err := helpers.EnsureDir(filepath.Dir(d.partial), 0755); err != nil {
+		return "", 0, "", err
+	}
+
+	if d.pbar != nil {
+		defer func() {
+			if d.started {
+				d.pbar.Finished()
+			}
+		}()
+	}
+
+	delay := downloadRetryDelay
+	for attempt := 1; ; attempt++ {
+		size, hexdigest, err = d.attempt()
+		if err == nil {
+			break
+		}
+		if !isTransientDownloadError(err) || attempt >= downloadRetries {
+			return "", 0, "", err
+		}
+
+		msg := fmt.Sprintf("Download of %s failed (%s), retrying in %s", d.url, err, delay)
+		log.Print(msg)
+		if d.pbar != nil {
+			d.pbar.Notify(msg)
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+
+	os.Remove(d.validatorFile())
+
+	return d.partial, size, hexdigest, nil
+}
+
+// attempt does a single download attempt, appending to the partial file
+// if the server supports it
+func (d *snapDownload) attempt() (size int64, hexdigest string, err error) {
+	w, err := os.OpenFile(d.partial, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, "", err
+	}
+	defer w.Close()
+
+	// the sha512 needs to cover what we already have too
+	hasher := sha512.New()
+	offset, err := io.Copy(hasher, w)
+	if err != nil {
+		return 0, "", err
+	}
+
+	req, err := http.NewRequest("GET", d.url, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	setUbuntuStoreHeaders(req)
+
+	validator, _ := ioutil.ReadFile(d.validatorFile())
+	if offset > 0 && len(validator) > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", string(validator))
+	}
+
+	resp, err := httpDo(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == 206 && strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)):
+		// resuming
+	case resp.StatusCode == 200:
+		// the server (re)sends everything
+		if offset, hasher, err = d.restart(w); err != nil {
+			return 0, "", err
+		}
+	case resp.StatusCode == 206 || resp.StatusCode == 416:
+		// our partial data is of no use
+		d.remove()
+		return 0, "", &errTransientDownload{fmt.Errorf("Unexpected status code %v", resp.StatusCode)}
+	case resp.StatusCode >= 500 || resp.StatusCode == 408 || resp.StatusCode == 429:
+		return 0, "", &errTransientDownload{fmt.Errorf("Unexpected status code %v", resp.StatusCode)}
+	default:
+		return 0, "", fmt.Errorf("Unexpected status code %v", resp.StatusCode)
+	}
+
+	if err := d.writeValidator(resp); err != nil {
+		return 0, "", err
+	}
+
+	dest := io.MultiWriter(w, hasher)
+	if d.pbar != nil {
+		// a total of 0 is unknown, the server may not send a length
+		var total float64
+		if resp.ContentLength >= 0 {
+			total = float64(offset + resp.ContentLength)
+		}
+		if !d.started {
+			d.pbar.Start(total)
+			d.started = true
+		} else {
+			d.pbar.SetTotal(total)
+		}
+		d.pbar.Set(float64(offset))
+		dest = io.MultiWriter(w, hasher, d.pbar)
+	}
+
+	n, err := io.Copy(dest, resp.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return 0, "", io.ErrUnexpectedEOF
+	}
+
+	if err := w.Sync(); err != nil {
+		return 0, "", err
+	}
+
+	return offset + n, hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// restart truncates the partial file and returns a fresh hasher for it
+func (d *snapDownload) restart(w *os.File) (int64, hash.Hash, error) {
+	if err := w.Truncate(0); err != nil {
+		return 0, nil, err
+	}
+	if _, err := w.Seek(0, 0); err != nil {
+		return 0, nil, err
+	}
+
+	return 0, sha512.New(), nil
+}
+
+// writeValidator stores the ETag (or the Last-Modified date if there is
+// no ETag) of the response so that a later attempt can resume safely
+func (d *snapDownload) writeValidator(resp *http.Response) error {
+	validator := resp.Header.Get("ETag")
+	if validator == "" {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	if validator == "" {
+		os.Remove(d.validatorFile())
+		return nil
+	}
+
+	return helpers.AtomicWriteFile(d.validatorFile(), []byte(validator), 0644)
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "launchpad.net/gocheck"
+)
+
+const downloadTestPayload = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+func (s *SnapTestSuite) mockDownloadPart(url string) *RemoteSnapPart {
+	snap := &RemoteSnapPart{}
+	snap.pkg.Name = "foo"
+	snap.pkg.Namespace = "bar"
+	snap.pkg.Version = "1.0"
+	snap.pkg.AnonDownloadURL = url
+
+	return snap
+}
+
+func (s *SnapTestSuite) TestDownloadResumesPartial(c *C) {
+	oldRetries := downloadRetries
+	downloadRetries = 1
+	defer func() { downloadRetries = oldRetries }()
+
+	var ranges, ifRanges []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		ifRanges = append(ifRanges, r.Header.Get("If-Range"))
+		w.Header().Set("ETag", `"v1"`)
+
+		if r.Header.Get("Range") == "" {
+			// drop the connection half way through
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(downloadTestPayload)))
+			w.Write([]byte(downloadTestPayload[:10]))
+			return
+		}
+		http.ServeContent(w, r, "foo.snap", time.Time{}, strings.NewReader(downloadTestPayload))
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	snap := s.mockDownloadPart(mockServer.URL + "/snap")
+
+	_, err := snap.Download(nil)
+	c.Assert(err, NotNil)
+	partial := filepath.Join(snapDownloadCacheDir, "foo.bar_1.0.snap.partial")
+	content, err := ioutil.ReadFile(partial)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, downloadTestPayload[:10])
+
+	p := &MockProgressMeter{}
+	fn, err := snap.Download(p)
+	c.Assert(err, IsNil)
+	content, err = ioutil.ReadFile(fn)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, downloadTestPayload)
+
+	c.Check(ranges, DeepEquals, []string{"", "bytes=10-"})
+	c.Check(ifRanges, DeepEquals, []string{"", `"v1"`})
+	c.Check(p.progress, DeepEquals, []float64{10})
+	c.Check(p.written, Equals, len(downloadTestPayload)-10)
+	c.Check(p.total, Equals, float64(len(downloadTestPayload)))
+	c.Check(p.finished, Equals, true)
+}
+
+func (s *SnapTestSuite) TestDownloadRestartsWhenResourceChanged(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// If-Range does not match so ServeContent sends everything
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "foo.snap", time.Time{}, strings.NewReader(downloadTestPayload))
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	c.Assert(os.MkdirAll(snapDownloadCacheDir, 0755), IsNil)
+	partial := filepath.Join(snapDownloadCacheDir, "foo.bar_1.0.snap.partial")
+	c.Assert(ioutil.WriteFile(partial, []byte("stale data"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(partial+".validator", []byte(`"v1"`), 0644), IsNil)
+
+	snap := s.mockDownloadPart(mockServer.URL + "/snap")
+	fn, err := snap.Download(nil)
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(fn)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, downloadTestPayload)
+}
+
+func (s *SnapTestSuite) TestDownloadRetriesTransientErrors(c *C) {
+	oldDelay := downloadRetryDelay
+	downloadRetryDelay = time.Millisecond
+	defer func() { downloadRetryDelay = oldDelay }()
+
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		if n < 3 {
+			w.WriteHeader(503)
+			return
+		}
+		w.Write([]byte(downloadTestPayload))
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	snap := s.mockDownloadPart(mockServer.URL + "/snap")
+	p := &MockProgressMeter{}
+	fn, err := snap.Download(p)
+	c.Assert(err, IsNil)
+	c.Check(n, Equals, 3)
+	c.Check(p.notified, HasLen, 2)
+	content, err := ioutil.ReadFile(fn)
+	c.Assert(err, IsNil)
+	c.Check(bytes.Equal(content, []byte(downloadTestPayload)), Equals, true)
+}
+
+func (s *SnapTestSuite) TestDownloadDoesNotRetryPermanentErrors(c *C) {
+	n := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		w.WriteHeader(404)
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	snap := s.mockDownloadPart(mockServer.URL + "/snap")
+	_, err := snap.Download(nil)
+	c.Assert(err, ErrorMatches, "Unexpected status code 404")
+	c.Check(n, Equals, 1)
+}
+
+type mockNetError struct {
+	timeout bool
+}
+
+func (e *mockNetError) Error() string   { return "mock net error" }
+func (e *mockNetError) Timeout() bool   { return e.timeout }
+func (e *mockNetError) Temporary() bool { return false }
+
+func (s *SnapTestSuite) TestIsTransientDownloadError(c *C) {
+	c.Check(isTransientDownloadError(io.ErrUnexpectedEOF), Equals, true)
+	c.Check(isTransientDownloadError(&url.Error{Op: "Get", URL: "http://x", Err: &mockNetError{timeout: true}}), Equals, true)
+	c.Check(isTransientDownloadError(&url.Error{Op: "Get", URL: "http://x", Err: io.EOF}), Equals, true)
+
+	c.Check(isTransientDownloadError(&url.Error{Op: "Get", URL: "http://x", Err: &mockNetError{}}), Equals, false)
+	c.Check(isTransientDownloadError(&url.Error{Op: "Get", URL: "foo://x", Err: errors.New("unsupported protocol scheme")}), Equals, false)
+	c.Check(isTransientDownloadError(errors.New("x509: certificate signed by unknown authority")), Equals, false)
+}
+
+func (s *SnapTestSuite) TestDownloadUnknownLength(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// flushing before the body makes it chunked, without a length
+		w.WriteHeader(200)
+		w.(http.Flusher).Flush()
+		w.Write([]byte(downloadTestPayload))
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	snap := s.mockDownloadPart(mockServer.URL + "/snap")
+	p := &MockProgressMeter{}
+	fn, err := snap.Download(p)
+	c.Assert(err, IsNil)
+	c.Check(p.total, Equals, 0.0)
+	content, err := ioutil.ReadFile(fn)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, downloadTestPayload)
+}
+
+func (s *SnapTestSuite) TestDownloadHashMismatchRemovesPartial(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(downloadTestPayload))
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	snap := s.mockDownloadPart(mockServer.URL + "/snap")
+	snap.pkg.DownloadSha512 = "invalid-sha512"
+	_, err := snap.Download(nil)
+	c.Assert(err, FitsTypeOf, &ErrDownloadHashMismatch{})
+
+	_, err = os.Stat(filepath.Join(snapDownloadCacheDir, "foo.bar_1.0.snap.partial"))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
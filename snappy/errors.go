@@ -141,6 +141,21 @@ var (
 
 	// ErrInvalidPart is returned when something on the filesystem does not make sense
 	ErrInvalidPart = errors.New("invalid package on system")
+
+	// ErrInvalidOfflineIndex is returned if the index of an offline
+	// repository lacks required fields (or the namespace of an app)
+	ErrInvalidOfflineIndex = errors.New("offline repository index entries need a name, version, file and sha512 (and a namespace for apps)")
+
+	// ErrOfflineIndexHashMismatch is returned if the index of an offline
+	// repository does not match its index.yaml.sha512 file
+	ErrOfflineIndexHashMismatch = errors.New("offline repository index does not match its sha512")
+
+	// ErrSnapHeld is returned if a held snap is asked to be updated
+	ErrSnapHeld = errors.New("snap is held at its current version")
+
+	// ErrNoStoreSources is returned if snaps are to be downloaded but
+	// no store is configured in the sources
+	ErrNoStoreSources = errors.New("no store sources configured")
 )
 
 // ErrInstallFailed is an error type for installation errors for snaps
@@ -154,6 +169,79 @@ func (e *ErrInstallFailed) Error() string {
 	return fmt.Sprintf("%s failed to install: %s", e.snap, e.origErr)
 }
 
+// ErrDownloadFailed is returned if the download of a snap failed
+type ErrDownloadFailed struct {
+	snap    string
+	origErr error
+}
+
+func (e *ErrDownloadFailed) Error() string {
+	return fmt.Sprintf("%s failed to download: %s", e.snap, e.origErr)
+}
+
+// ErrHealthCheckFailed is returned if the health check of a service of
+// a snap failed after it was installed
+type ErrHealthCheckFailed struct {
+	snap    string
+	service string
+	origErr error
+}
+
+func (e *ErrHealthCheckFailed) Error() string {
+	return fmt.Sprintf("health check of %s service %s failed: %s", e.snap, e.service, e.origErr)
+}
+
+// ErrSnapshotNotFound is returned if a snap has no snapshot with the
+// given id
+type ErrSnapshotNotFound struct {
+	name string
+	id   string
+}
+
+func (e *ErrSnapshotNotFound) Error() string {
+	return fmt.Sprintf("%s has no snapshot %s", e.name, e.id)
+}
+
+// ErrRollbackFailed is returned if parts of an update transaction could
+// not be reverted
+type ErrRollbackFailed struct {
+	errs []string
+}
+
+func (e *ErrRollbackFailed) Error() string {
+	return fmt.Sprintf("rollback failed: %s", strings.Join(e.errs, ", "))
+}
+
+// ErrSearchFailed is returned if some of the repositories could not be
+// searched
+type ErrSearchFailed struct {
+	errs []string
+}
+
+func (e *ErrSearchFailed) Error() string {
+	return fmt.Sprintf("search failed: %s", strings.Join(e.errs, ", "))
+}
+
+// ErrUnknownChannel is returned for a channel that is not one of
+// stable, candidate, beta or edge
+type ErrUnknownChannel struct {
+	channel string
+}
+
+func (e *ErrUnknownChannel) Error() string {
+	return fmt.Sprintf("unknown channel %q (use one of %s)", e.channel, strings.Join(snapChannels, ", "))
+}
+
+// ErrInvalidHold is returned for a hold that is neither true, false
+// nor a date
+type ErrInvalidHold struct {
+	value string
+}
+
+func (e *ErrInvalidHold) Error() string {
+	return fmt.Sprintf("invalid hold %q (use true, false or a date like 2015-12-31)", e.value)
+}
+
 // ErrUnpackFailed is the error type for a snap unpack problem
 type ErrUnpackFailed struct {
 	snapFile string
@@ -196,6 +284,42 @@ func (e *ErrDataCopyFailed) Error() string {
 	return fmt.Sprintf("data copy from %v to %v failed with exit status %d", e.oldPath, e.newPath, e.exitCode)
 }
 
+// ErrDownloadHashMismatch is returned if the sha512 of a downloaded snap
+// does not match the one advertised by the store
+type ErrDownloadHashMismatch struct {
+	snap     string
+	expected string
+	got      string
+}
+
+func (e *ErrDownloadHashMismatch) Error() string {
+	return fmt.Sprintf("sha512 mismatch for %s download: expected %s, got %s", e.snap, e.expected, e.got)
+}
+
+// ErrDownloadSizeMismatch is returned if the size of a downloaded snap
+// does not match the one advertised by the store
+type ErrDownloadSizeMismatch struct {
+	snap     string
+	expected int64
+	got      int64
+}
+
+func (e *ErrDownloadSizeMismatch) Error() string {
+	return fmt.Sprintf("size mismatch for %s download: expected %d bytes, got %d", e.snap, e.expected, e.got)
+}
+
+// ErrArchiveHashMismatch is returned if the data of a snap does not
+// match the archive-sha512 of its meta/hashes.yaml
+type ErrArchiveHashMismatch struct {
+	snap     string
+	expected string
+	got      string
+}
+
+func (e *ErrArchiveHashMismatch) Error() string {
+	return fmt.Sprintf("archive sha512 mismatch for %s: expected %s, got %s", e.snap, e.expected, e.got)
+}
+
 // ErrUpgradeVerificationFailed is returned if the upgrade has not
 // worked (i.e. no new version on the other partition)
 type ErrUpgradeVerificationFailed struct {
@@ -246,3 +370,53 @@ type ErrFrameworkInUse []string
 func (e ErrFrameworkInUse) Error() string {
 	return fmt.Sprintf("framework still in use by: %s", strings.Join(e, ", "))
 }
+
+// ErrInvalidSource is returned for a source that can not be used
+type ErrInvalidSource struct {
+	source Source
+	msg    string
+}
+
+func (e *ErrInvalidSource) Error() string {
+	return fmt.Sprintf("invalid source %q: %s", e.source.Name, e.msg)
+}
+
+// ErrServiceNotFound is returned if a package has no service with the
+// given name, or no services at all if the name is empty
+type ErrServiceNotFound struct {
+	pkg     string
+	service string
+}
+
+func (e *ErrServiceNotFound) Error() string {
+	if e.service == "" {
+		return fmt.Sprintf("package %q has no services", e.pkg)
+	}
+
+	return fmt.Sprintf("package %q has no service %q", e.pkg, e.service)
+}
+
+// ErrInvalidServiceOption is returned for an option of a service in the
+// package.yaml whose value is not supported
+type ErrInvalidServiceOption struct {
+	service string
+	option  string
+	value   string
+	msg     string
+}
+
+func (e *ErrInvalidServiceOption) Error() string {
+	return fmt.Sprintf("service %q: invalid %s %q: %s", e.service, e.option, e.value, e.msg)
+}
+
+// ErrInvalidResourceLimit is returned for a resource limit whose value
+// is not supported
+type ErrInvalidResourceLimit struct {
+	limit string
+	value string
+	msg   string
+}
+
+func (e *ErrInvalidResourceLimit) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.limit, e.value, e.msg)
+}
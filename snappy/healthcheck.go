@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"launchpad.net/snappy/progress"
+)
+
+// HealthCheck is the health-check of a service in the package.yaml, the
+// command is run after the service was started and must exit with 0
+type HealthCheck struct {
+	Command string         `yaml:"command" json:"command,omitempty"`
+	Timeout SecondsTimeout `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Retries int            `yaml:"retries,omitempty" json:"retries,omitempty"`
+}
+
+var (
+	// defaultHealthCheckTimeout is used for health checks without a
+	// timeout
+	defaultHealthCheckTimeout = SecondsTimeout(30 * time.Second)
+
+	// healthCheckRetryDelay is the time between two tries of a health
+	// check
+	healthCheckRetryDelay = 2 * time.Second
+)
+
+// run runs the health check of the given service of the part until it
+// succeeds or it failed 1 + Retries times
+func (h *HealthCheck) run(part *SnapPart, serviceName string) (err error) {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+
+	// the check runs confined like the service itself
+	aaProfile, err := getSecurityProfile(part.m, serviceName, part.basedir)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i <= h.Retries; i++ {
+		if i > 0 {
+			time.Sleep(healthCheckRetryDelay)
+		}
+		if err = runHealthCheckCommand(part, aaProfile, h.Command, time.Duration(timeout)); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// runHealthCheckCommand runs the given command (relative to the snap)
+// under the given apparmor profile with the environment of the hooks,
+// it is killed after the timeout
+func runHealthCheckCommand(part *SnapPart, aaProfile, command string, timeout time.Duration) error {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return fmt.Errorf("empty command")
+	}
+	path := filepath.Join(part.basedir, args[0])
+	if !strings.HasPrefix(path, filepath.Clean(part.basedir)+"/") {
+		return fmt.Errorf("%s is not part of the snap", args[0])
+	}
+
+	var output bytes.Buffer
+	cmd := exec.Command(aaExec, append([]string{"-p", aaProfile, path}, args[1:]...)...)
+	cmd.Dir = part.basedir
+	cmd.Env = makeSnapHookEnv(part)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%s failed: %s (%q)", command, err, output.String())
+		}
+		return nil
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		<-done
+		return fmt.Errorf("%s timed out after %s", command, timeout)
+	}
+}
+
+// checkSnapHealth runs the health checks of all services of the given
+// snap
+func checkSnapHealth(part *SnapPart) error {
+	for _, svc := range part.Services() {
+		if svc.HealthCheck == nil {
+			continue
+		}
+		if err := svc.HealthCheck.run(part, svc.Name); err != nil {
+			return &ErrHealthCheckFailed{snap: part.Name(), service: svc.Name, origErr: err}
+		}
+	}
+
+	return nil
+}
+
+// checkHealthOrRollback runs the health checks of the just installed
+// snap, if one fails the version that was active before is made active
+// again (which restarts its services), or the snap is removed again if
+// there was none, and the failure is returned
+func checkHealthOrRollback(name, oldDir string, inter interacter) error {
+	part, ok := ActiveSnapByName(name).(*SnapPart)
+	if !ok {
+		return nil
+	}
+
+	err := checkSnapHealth(part)
+	if err == nil {
+		return nil
+	}
+
+	meter, ok := inter.(progress.Meter)
+	if !ok {
+		meter = &progress.NullProgress{}
+	}
+
+	if oldDir == "" {
+		inter.Notify(fmt.Sprintf("%s, removing it again", err))
+		if rerr := part.Uninstall(meter); rerr != nil {
+			return fmt.Errorf("%s (and the removal failed: %s)", err, rerr)
+		}
+		return err
+	}
+
+	inter.Notify(fmt.Sprintf("%s, rolling back to the previous version", err))
+
+	pkg := name
+	if part.Namespace() != "" {
+		pkg += "." + part.Namespace()
+	}
+	if _, rerr := Rollback(pkg, filepath.Base(oldDir), meter); rerr != nil {
+		return fmt.Errorf("%s (and the rollback failed: %s)", err, rerr)
+	}
+
+	return err
+}
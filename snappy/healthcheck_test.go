@@ -0,0 +1,128 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "launchpad.net/gocheck"
+)
+
+const healthCheckYaml = `name: foo
+version: %s
+vendor: Foo <foo@example.com>
+services:
+ - name: svc
+   start: bin/foo
+   health-check:
+     command: %s
+     timeout: 5
+     retries: 1
+`
+
+func (s *SnapTestSuite) TestHealthCheckYaml(c *C) {
+	m, err := parsePackageYamlData([]byte(fmt.Sprintf(healthCheckYaml, "1.0", "bin/foo --check")))
+	c.Assert(err, IsNil)
+	c.Assert(m.Services[0].HealthCheck, NotNil)
+	c.Check(m.Services[0].HealthCheck.Command, Equals, "bin/foo --check")
+	c.Check(time.Duration(m.Services[0].HealthCheck.Timeout), Equals, 5*time.Second)
+	c.Check(m.Services[0].HealthCheck.Retries, Equals, 1)
+}
+
+func (s *SnapTestSuite) TestInstallHealthCheckRollsBack(c *C) {
+	defer func(d time.Duration) { healthCheckRetryDelay = d }(healthCheckRetryDelay)
+	healthCheckRetryDelay = 0
+
+	snapFile := makeTestSnapPackage(c, fmt.Sprintf(healthCheckYaml, "1.0", "bin/foo"))
+	_, err := installClick(snapFile, 0, &MockProgressMeter{}, testNamespace)
+	c.Assert(err, IsNil)
+
+	snapFile = makeTestSnapPackage(c, fmt.Sprintf(healthCheckYaml, "2.0", "bin/no-such-check"))
+	meter := &MockProgressMeter{}
+	_, err = installClick(snapFile, 0, meter, testNamespace)
+	c.Assert(err, FitsTypeOf, &ErrHealthCheckFailed{})
+	c.Check(meter.notified, Not(HasLen), 0)
+
+	// the old version is back, the new one is still around
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "1.0")
+	installed, err := NewMetaLocalRepository().Installed()
+	c.Assert(err, IsNil)
+	c.Check(FindSnapsByNameAndVersion("foo", "2.0", installed), HasLen, 1)
+}
+
+func (s *SnapTestSuite) TestInstallHealthCheckFirstInstallRemoves(c *C) {
+	defer func(d time.Duration) { healthCheckRetryDelay = d }(healthCheckRetryDelay)
+	healthCheckRetryDelay = 0
+
+	snapFile := makeTestSnapPackage(c, fmt.Sprintf(healthCheckYaml, "1.0", "bin/no-such-check"))
+	meter := &MockProgressMeter{}
+	_, err := installClick(snapFile, 0, meter, testNamespace)
+	c.Assert(err, FitsTypeOf, &ErrHealthCheckFailed{})
+	c.Check(meter.notified, Not(HasLen), 0)
+
+	// there is nothing to roll back to, so the snap is gone
+	c.Check(ActiveSnapByName("foo"), IsNil)
+	installed, err := NewMetaLocalRepository().Installed()
+	c.Assert(err, IsNil)
+	c.Check(FindSnapsByName("foo", installed), HasLen, 0)
+}
+
+func makeHealthCheckPart(c *C, check string) *SnapPart {
+	dir := filepath.Join(c.MkDir(), "foo."+testNamespace, "1.0")
+	c.Assert(os.MkdirAll(filepath.Join(dir, "bin"), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "bin", "check"), []byte(check), 0755), IsNil)
+
+	return &SnapPart{basedir: dir, m: &packageYaml{Name: "foo", Version: "1.0"}}
+}
+
+func (s *SnapTestSuite) TestHealthCheckTimeout(c *C) {
+	part := makeHealthCheckPart(c, "#!/bin/sh\nsleep 10\n")
+
+	check := &HealthCheck{Command: "bin/check", Timeout: SecondsTimeout(10 * time.Millisecond)}
+	c.Check(check.run(part, "svc"), ErrorMatches, "bin/check timed out after 10ms")
+}
+
+func (s *SnapTestSuite) TestHealthCheckIsConfined(c *C) {
+	part := makeHealthCheckPart(c, "#!/bin/sh\nexit 0\n")
+	argsFile := filepath.Join(c.MkDir(), "args")
+	c.Assert(ioutil.WriteFile(aaExec, []byte("#!/bin/sh\necho \"$@\" > "+argsFile+"\n"), 0755), IsNil)
+
+	check := &HealthCheck{Command: "bin/check --quick"}
+	c.Assert(check.run(part, "svc"), IsNil)
+	args, err := ioutil.ReadFile(argsFile)
+	c.Assert(err, IsNil)
+	c.Check(string(args), Equals, fmt.Sprintf("-p foo.%s_svc_1.0 %s/bin/check --quick\n", testNamespace, part.basedir))
+}
+
+func (s *SnapTestSuite) TestHealthCheckOutsideSnap(c *C) {
+	part := makeHealthCheckPart(c, "#!/bin/sh\nexit 0\n")
+
+	check := &HealthCheck{Command: "../../bin/true"}
+	c.Check(check.run(part, "svc"), ErrorMatches, ".* is not part of the snap")
+}
+
+func (s *SnapTestSuite) TestHealthCheckYamlInvalidCommand(c *C) {
+	for _, command := range []string{"/bin/true", "../bin/true", "bin/../../true", "'bin/foo; rm -rf /'"} {
+		_, err := parsePackageYamlData([]byte(fmt.Sprintf(healthCheckYaml, "1.0", command)))
+		c.Check(err, NotNil, Commentf(command))
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"time"
+)
+
+// holdDateFormat is the format of the date a hold ends
+const holdDateFormat = "2006-01-02"
+
+// snapHold keeps a snap at its current version, until the given time
+// or forever if that is not set
+type snapHold struct {
+	Until time.Time `yaml:"until,omitempty"`
+}
+
+// active returns true if the hold has not expired
+func (h snapHold) active() bool {
+	return h.Until.IsZero() || time.Now().Before(h.Until)
+}
+
+// snapHoldsStore has the holds of the snaps
+var snapHoldsStore = newSnapStore(&snapHoldsFile, func() interface{} { return &map[string]snapHold{} })
+
+// readSnapHolds returns the holds by snap name
+func readSnapHolds() (map[string]snapHold, error) {
+	holds := make(map[string]snapHold)
+	if err := snapHoldsStore.read(&holds); err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+// HeldUntil returns if the given snap is held and when the hold ends,
+// the time is zero for holds that do not end
+func HeldUntil(name string) (bool, time.Time) {
+	name, _ = splitNamespace(name)
+
+	holds, err := readSnapHolds()
+	if err != nil {
+		return false, time.Time{}
+	}
+
+	hold, ok := holds[name]
+	if !ok || !hold.active() {
+		return false, time.Time{}
+	}
+
+	return true, hold.Until
+}
+
+// IsHeld returns true if the given snap must not be updated
+func IsHeld(name string) bool {
+	held, _ := HeldUntil(name)
+	return held
+}
+
+// holdSnap holds the given snap until the given time (forever for the
+// zero time)
+func holdSnap(name string, until time.Time) error {
+	name, _ = splitNamespace(name)
+
+	holds, err := readSnapHolds()
+	if err != nil {
+		return err
+	}
+	holds[name] = snapHold{Until: until}
+
+	return snapHoldsStore.write(holds)
+}
+
+// releaseSnap removes the hold of the given snap
+func releaseSnap(name string) error {
+	name, _ = splitNamespace(name)
+
+	return snapHoldsStore.forget(name)
+}
+
+// setSnapHoldProperty is the "hold" property of SetProperty, the value
+// is "true", "false" or the date the hold ends (YYYY-MM-DD), at the
+// start of that day
+func setSnapHoldProperty(pkgname, value string) error {
+	if name, _ := splitNamespace(pkgname); ActiveSnapByName(name) == nil {
+		return ErrNotInstalled
+	}
+
+	switch value {
+	case "true":
+		return holdSnap(pkgname, time.Time{})
+	case "false":
+		return releaseSnap(pkgname)
+	}
+
+	until, err := time.ParseInLocation(holdDateFormat, value, time.Local)
+	if err != nil {
+		return &ErrInvalidHold{value: value}
+	}
+
+	return holdSnap(pkgname, until)
+}
+
+// withoutHeldParts returns the given parts without the held ones
+func withoutHeldParts(parts []Part) []Part {
+	var res []Part
+	for _, part := range parts {
+		if !IsHeld(part.Name()) {
+			res = append(res, part)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "launchpad.net/gocheck"
+)
+
+func (s *SnapTestSuite) TestHoldSnap(c *C) {
+	c.Check(IsHeld("foo"), Equals, false)
+
+	c.Assert(holdSnap("foo.bar", time.Time{}), IsNil)
+	c.Check(IsHeld("foo"), Equals, true)
+	held, until := HeldUntil("foo")
+	c.Check(held, Equals, true)
+	c.Check(until.IsZero(), Equals, true)
+
+	c.Assert(releaseSnap("foo"), IsNil)
+	c.Check(IsHeld("foo"), Equals, false)
+}
+
+func (s *SnapTestSuite) TestHoldSnapExpires(c *C) {
+	c.Assert(holdSnap("foo", time.Now().Add(-time.Hour)), IsNil)
+	c.Check(IsHeld("foo"), Equals, false)
+
+	c.Assert(holdSnap("foo", time.Now().Add(time.Hour)), IsNil)
+	c.Check(IsHeld("foo"), Equals, true)
+}
+
+func (s *SnapTestSuite) TestSetSnapHoldProperty(c *C) {
+	c.Check(setSnapHoldProperty("foo", "true"), Equals, ErrNotInstalled)
+
+	snapFile := makeTestSnapPackage(c, "")
+	_, err := installClick(snapFile, 0, nil, testNamespace)
+	c.Assert(err, IsNil)
+
+	c.Assert(setSnapHoldProperty("foo", "true"), IsNil)
+	c.Check(IsHeld("foo"), Equals, true)
+	c.Assert(setSnapHoldProperty("foo", "false"), IsNil)
+	c.Check(IsHeld("foo"), Equals, false)
+
+	c.Assert(setSnapHoldProperty("foo", "2100-01-01"), IsNil)
+	held, until := HeldUntil("foo")
+	c.Check(held, Equals, true)
+	c.Check(until.Year(), Equals, 2100)
+
+	// the hold ends when the day starts
+	now := time.Now()
+	c.Assert(setSnapHoldProperty("foo", now.Format(holdDateFormat)), IsNil)
+	c.Check(IsHeld("foo"), Equals, false)
+	c.Assert(setSnapHoldProperty("foo", now.AddDate(0, 0, 1).Format(holdDateFormat)), IsNil)
+	held, until = HeldUntil("foo")
+	c.Check(held, Equals, true)
+	c.Check(until.Equal(time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local)), Equals, true)
+
+	err = setSnapHoldProperty("foo", "maybe")
+	c.Assert(err, FitsTypeOf, &ErrInvalidHold{})
+}
+
+func (s *SnapTestSuite) TestUpdatesSkipsHeldSnaps(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, MockUpdatesJSON)
+	}))
+	defer mockServer.Close()
+
+	var err error
+	storeBulkURI, err = url.Parse(mockServer.URL + "/updates/")
+	c.Assert(err, IsNil)
+	mockActiveSnapNamesByType([]string{funkyAppName})
+
+	m := &MetaRepository{all: []Repository{NewUbuntuStoreSnapRepository()}}
+	updates, err := m.Updates()
+	c.Assert(err, IsNil)
+	c.Assert(updates, HasLen, 1)
+
+	c.Assert(holdSnap(funkyAppName, time.Time{}), IsNil)
+	updates, err = m.Updates()
+	c.Assert(err, IsNil)
+	c.Check(updates, HasLen, 0)
+
+	// the store repository on its own leaves them out too
+	updates, err = NewUbuntuStoreSnapRepository().Updates()
+	c.Assert(err, IsNil)
+	c.Check(updates, HasLen, 0)
+}
+
+func (s *SnapTestSuite) TestUpdateSnapHeld(c *C) {
+	snapFile := makeTestSnapPackage(c, "")
+	_, err := installClick(snapFile, 0, nil, testNamespace)
+	c.Assert(err, IsNil)
+	c.Assert(holdSnap("foo", time.Time{}), IsNil)
+
+	part, err := UpdateSnap("foo", 0, nil)
+	c.Check(err, Equals, ErrSnapHeld)
+	c.Check(part, IsNil)
+}
@@ -0,0 +1,219 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"launchpad.net/snappy/coreconfig"
+)
+
+var (
+	// systemCABundle is the bundle of the system CA certificates, the
+	// configured ca-certs are trusted in addition to these
+	systemCABundle = "/etc/ssl/certs/ca-certificates.crt"
+
+	// defaultHTTPTimeout is used for connecting and for waiting for
+	// the response headers if no timeout is configured
+	defaultHTTPTimeout = 30 * time.Second
+
+	// for testing
+	getNetworkSettings = coreconfig.NetworkSettings
+)
+
+// the shared client and the settings it was made for
+var (
+	httpClientMutex   sync.Mutex
+	httpClientNetwork coreconfig.NetworkConfig
+	sharedHTTPClient  *http.Client
+)
+
+// httpClient returns the http client for all the store, SSO and
+// system-image traffic. It is configured with the network settings of
+// ubuntu-core (see "snappy config ubuntu-core") and made again when
+// those change.
+func httpClient() (*http.Client, error) {
+	network, err := getNetworkSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	httpClientMutex.Lock()
+	defer httpClientMutex.Unlock()
+
+	if sharedHTTPClient != nil && *network == httpClientNetwork {
+		return sharedHTTPClient, nil
+	}
+
+	client, err := newHTTPClient(network)
+	if err != nil {
+		return nil, err
+	}
+	sharedHTTPClient = client
+	httpClientNetwork = *network
+
+	return client, nil
+}
+
+// newHTTPClient returns a new http client for the given network settings
+func newHTTPClient(network *coreconfig.NetworkConfig) (*http.Client, error) {
+	timeout := defaultHTTPTimeout
+	if network.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(network.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid network timeout %q: %s", network.Timeout, err)
+		}
+	}
+
+	tlsConfig, err := newTLSConfig(network)
+	if err != nil {
+		return nil, err
+	}
+
+	// no timeout for the whole request, downloads can take a long time
+	transport := &http.Transport{
+		Proxy: proxyFunc(network),
+		Dial: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// newTLSConfig returns the tls settings with the configured CA and
+// client certificates, or nil to use the defaults
+func newTLSConfig(network *coreconfig.NetworkConfig) (*tls.Config, error) {
+	if network.CACerts == "" && network.ClientCert == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{}
+
+	if network.CACerts != "" {
+		pool := x509.NewCertPool()
+		// its ok if there are no system certs
+		if pem, err := ioutil.ReadFile(systemCABundle); err == nil {
+			pool.AppendCertsFromPEM(pem)
+		}
+
+		pem, err := ioutil.ReadFile(network.CACerts)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", network.CACerts)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if network.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(network.ClientCert, network.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// proxyFunc returns the proxy function for the given settings, the
+// environment (http_proxy, ...) is used if no proxy is configured
+func proxyFunc(network *coreconfig.NetworkConfig) func(*http.Request) (*url.URL, error) {
+	if network.HTTPProxy == "" && network.HTTPSProxy == "" {
+		return http.ProxyFromEnvironment
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		if noProxyMatches(network.NoProxy, req.URL.Host) {
+			return nil, nil
+		}
+
+		proxy := network.HTTPProxy
+		if req.URL.Scheme == "https" && network.HTTPSProxy != "" {
+			proxy = network.HTTPSProxy
+		}
+		if proxy == "" {
+			return nil, nil
+		}
+
+		return url.Parse(proxy)
+	}
+}
+
+// noProxyMatches returns true if the given host (with an optional port)
+// is in the comma separated noProxy list. Entries starting with a "."
+// match all hosts in that domain.
+func noProxyMatches(noProxy, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		case strings.HasPrefix(entry, "."):
+			if strings.HasSuffix(host, entry) || host == entry[1:] {
+				return true
+			}
+		case host == entry:
+			return true
+		}
+	}
+
+	return false
+}
+
+// httpDo sends the given request with the shared http client
+func httpDo(req *http.Request) (*http.Response, error) {
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Do(req)
+}
+
+// httpGet gets the given url with the shared http client
+func httpGet(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return httpDo(req)
+}
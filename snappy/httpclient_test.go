@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	"launchpad.net/snappy/coreconfig"
+
+	. "launchpad.net/gocheck"
+)
+
+func (s *SnapTestSuite) TestHTTPClientUsesProxy(c *C) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Host, Equals, "store.example.com")
+		c.Check(r.Header.Get("Proxy-Authorization"), Equals, "Basic dXNlcjpzZWNyZXQ=")
+		io.WriteString(w, "proxied")
+	}))
+	defer proxy.Close()
+
+	network := &coreconfig.NetworkConfig{HTTPProxy: "http://user:secret@" + proxy.Listener.Addr().String()}
+	getNetworkSettings = func() (*coreconfig.NetworkConfig, error) { return network, nil }
+
+	resp, err := httpGet("http://store.example.com/api/v1/search")
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+	c.Check(string(body), Equals, "proxied")
+}
+
+func (s *SnapTestSuite) TestHTTPClientNoProxy(c *C) {
+	network := &coreconfig.NetworkConfig{
+		HTTPProxy:  "http://proxy:3128",
+		HTTPSProxy: "http://secure-proxy:3128",
+		NoProxy:    "localhost, .internal.example.com",
+	}
+	proxy := proxyFunc(network)
+
+	for _, t := range []struct {
+		url   string
+		proxy string
+	}{
+		{"http://store.example.com/", "http://proxy:3128"},
+		{"https://store.example.com/", "http://secure-proxy:3128"},
+		{"https://localhost:8080/", ""},
+		{"https://foo.internal.example.com/", ""},
+		{"https://internal.example.com/", ""},
+		{"https://notinternal.example.com/", "http://secure-proxy:3128"},
+	} {
+		req, err := http.NewRequest("GET", t.url, nil)
+		c.Assert(err, IsNil)
+		u, err := proxy(req)
+		c.Assert(err, IsNil)
+		if t.proxy == "" {
+			c.Check(u, IsNil, Commentf(t.url))
+		} else {
+			c.Check(u.String(), Equals, t.proxy, Commentf(t.url))
+		}
+	}
+}
+
+func (s *SnapTestSuite) TestHTTPClientCustomCA(c *C) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer server.Close()
+
+	// the test server is not trusted by default
+	_, err := httpGet(server.URL)
+	c.Assert(err, NotNil)
+
+	caFile := filepath.Join(c.MkDir(), "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+	c.Assert(ioutil.WriteFile(caFile, caPem, 0644), IsNil)
+	network := &coreconfig.NetworkConfig{CACerts: caFile}
+	getNetworkSettings = func() (*coreconfig.NetworkConfig, error) { return network, nil }
+
+	resp, err := httpGet(server.URL)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+	c.Check(resp.StatusCode, Equals, 200)
+}
+
+func (s *SnapTestSuite) TestHTTPClientIsShared(c *C) {
+	client1, err := httpClient()
+	c.Assert(err, IsNil)
+	client2, err := httpClient()
+	c.Assert(err, IsNil)
+	c.Check(client1, Equals, client2)
+
+	// but made again when the settings change
+	getNetworkSettings = func() (*coreconfig.NetworkConfig, error) {
+		return &coreconfig.NetworkConfig{Timeout: "5s"}, nil
+	}
+	client3, err := httpClient()
+	c.Assert(err, IsNil)
+	c.Check(client3 == client1, Equals, false)
+}
+
+func (s *SnapTestSuite) TestHTTPClientInvalidSettings(c *C) {
+	_, err := newHTTPClient(&coreconfig.NetworkConfig{Timeout: "forever"})
+	c.Check(err, NotNil)
+
+	_, err = newHTTPClient(&coreconfig.NetworkConfig{CACerts: "/no/such/file"})
+	c.Check(err, NotNil)
+}
@@ -20,7 +20,6 @@ package snappy
 import (
 	"io/ioutil"
 	"os"
-	"sort"
 	"strings"
 
 	"launchpad.net/snappy/logger"
@@ -122,53 +121,18 @@ func doInstall(name string, flags InstallFlags, meter progress.Meter) (snapName
 	return "", ErrPackageNotFound
 }
 
-// GarbageCollect removes all versions two older than the current active
-// version, as long as NeedsReboot() is false on all the versions found, and
-// DoInstallGC is set.
+// GarbageCollect removes the versions of the snap with the given name
+// that its retention policy does not keep (see PlanGarbageCollection),
+// as long as DoInstallGC is set.
 func GarbageCollect(name string, flags InstallFlags) error {
-	var parts BySnapVersion
-
 	if (flags & DoInstallGC) == 0 {
 		return nil
 	}
 
-	m := NewMetaRepository()
-	installed, err := m.Installed()
+	plan, err := PlanGarbageCollection(name)
 	if err != nil {
 		return err
 	}
 
-	parts = FindSnapsByName(name, installed)
-	if len(parts) < 3 {
-		// not enough things installed to do gc
-		return nil
-	}
-
-	sort.Sort(parts)
-	active := -1 // active is the index of the active part in parts (-1 if no active part)
-
-	for i, part := range parts {
-		if part.IsActive() {
-			if active > -1 {
-				return ErrGarbageCollectImpossible("more than one active (should not happen).")
-			}
-			active = i
-		}
-		if part.NeedsReboot() {
-			return nil // don't do gc on parts that need reboot.
-		}
-	}
-
-	if active < 1 {
-		// how was this an install?
-		return nil
-	}
-
-	for _, part := range parts[:active-1] {
-		if err := part.Uninstall(progress.MakeProgressBar(part.Name())); err != nil {
-			return ErrGarbageCollectImpossible(err.Error())
-		}
-	}
-
-	return nil
+	return plan.Run(progress.MakeProgressBar(name))
 }
@@ -0,0 +1,197 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"launchpad.net/snappy/helpers"
+	"launchpad.net/snappy/progress"
+
+	"gopkg.in/yaml.v2"
+)
+
+// the steps of installClick that are recorded in the install journal,
+// a step is written before it is started
+const (
+	installStepUnpack    = "unpack"
+	installStepData      = "data"
+	installStepActivate  = "activate"
+	installStepActivated = "activated"
+)
+
+// installJournal is the write-ahead journal of an install. It only
+// exists while installClick runs, so if it is found otherwise the
+// install was interrupted and needs to be recovered.
+type installJournal struct {
+	FullName     string `yaml:"name"`
+	Version      string `yaml:"version"`
+	InstDir      string `yaml:"inst-dir"`
+	OldDir       string `yaml:"old-dir,omitempty"`
+	InhibitHooks bool   `yaml:"inhibit-hooks,omitempty"`
+	Step         string `yaml:"step"`
+}
+
+func newInstallJournal(fullName, version, instDir, oldDir string, inhibitHooks bool) *installJournal {
+	return &installJournal{
+		FullName:     fullName,
+		Version:      version,
+		InstDir:      instDir,
+		OldDir:       oldDir,
+		InhibitHooks: inhibitHooks,
+	}
+}
+
+func (j *installJournal) filename() string {
+	return filepath.Join(snapInstallJournalDir, fmt.Sprintf("%s_%s.yaml", j.FullName, j.Version))
+}
+
+// step records that the given step is about to start
+func (j *installJournal) step(step string) error {
+	j.Step = step
+
+	yamlData, err := yaml.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	if err := helpers.EnsureDir(snapInstallJournalDir, 0755); err != nil {
+		return err
+	}
+
+	return helpers.AtomicWriteFile(j.filename(), yamlData, 0644)
+}
+
+// remove removes the journal once the install is finished (or cleaned
+// up after a failure)
+func (j *installJournal) remove() {
+	if err := os.Remove(j.filename()); err != nil && !os.IsNotExist(err) {
+		log.Printf("WARNING: failed to remove install journal %s: %s", j.filename(), err)
+	}
+}
+
+// recover finishes the interrupted install: if the new version was
+// activated it is kept, otherwise everything is undone and the old
+// version is made active again
+func (j *installJournal) recover(inter interacter) error {
+	currentActiveDir, _ := filepath.EvalSymlinks(filepath.Join(j.InstDir, "..", "current"))
+
+	if j.Step == installStepActivated {
+		inter.Notify(fmt.Sprintf("finishing interrupted install of %s %s", j.FullName, j.Version))
+		return setActiveClick(j.InstDir, j.InhibitHooks, inter)
+	}
+
+	// a reinstall of the active version: undoing it would remove the
+	// version (and the data) that was active before, so it is only
+	// made active again
+	if j.InstDir == j.OldDir {
+		inter.Notify(fmt.Sprintf("reactivating %s %s after an interrupted reinstall", j.FullName, j.Version))
+		if currentActiveDir != j.OldDir {
+			return setActiveClick(j.OldDir, j.InhibitHooks, inter)
+		}
+		return nil
+	}
+
+	inter.Notify(fmt.Sprintf("undoing interrupted install of %s %s", j.FullName, j.Version))
+
+	if currentActiveDir == j.InstDir {
+		if err := unsetActiveClick(j.InstDir, j.InhibitHooks, inter); err != nil {
+			return err
+		}
+	}
+
+	if j.Step != installStepUnpack {
+		if err := removeSnapData(j.FullName, j.Version); err != nil {
+			return err
+		}
+	}
+
+	if err := os.RemoveAll(j.InstDir); err != nil {
+		return err
+	}
+	// the snap dir itself is removed if this was the only version
+	os.Remove(filepath.Dir(j.InstDir))
+
+	if j.OldDir != "" && currentActiveDir != j.OldDir {
+		return setActiveClick(j.OldDir, j.InhibitHooks, inter)
+	}
+
+	return nil
+}
+
+// interruptedInstalls returns the journals of the installs that were
+// interrupted
+func interruptedInstalls() ([]*installJournal, error) {
+	journalFiles, err := filepath.Glob(filepath.Join(snapInstallJournalDir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	var journals []*installJournal
+	for _, fn := range journalFiles {
+		yamlData, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+
+		var j installJournal
+		if err := yaml.Unmarshal(yamlData, &j); err != nil {
+			log.Printf("WARNING: ignoring broken install journal %s: %s", fn, err)
+			continue
+		}
+		journals = append(journals, &j)
+	}
+
+	return journals, nil
+}
+
+// NeedsRecovery returns true if an install or update was interrupted
+// and Recover needs to run
+func NeedsRecovery() bool {
+	if journals, err := interruptedInstalls(); err == nil && len(journals) > 0 {
+		return true
+	}
+
+	journal, err := readTransactionJournal()
+
+	return err == nil && journal.State == transactionRunning
+}
+
+// Recover rolls the installs that were interrupted (e.g. by a crash or
+// a power loss) forward or back and then recovers an interrupted update
+// transaction. It must only run while no other install is in progress,
+// i.e. with the privileged lock held.
+func Recover(pbar progress.Meter) error {
+	journals, err := interruptedInstalls()
+	if err != nil {
+		return err
+	}
+
+	for _, j := range journals {
+		if err := j.recover(pbar); err != nil {
+			return fmt.Errorf("can not recover install of %s %s: %s", j.FullName, j.Version, err)
+		}
+		j.remove()
+	}
+
+	return RecoverUpdateTransaction(pbar)
+}
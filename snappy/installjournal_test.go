@@ -0,0 +1,114 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"os"
+	"path/filepath"
+
+	"launchpad.net/snappy/helpers"
+
+	. "launchpad.net/gocheck"
+)
+
+// installTestVersions installs the given versions of foo.bar, the last
+// one is active
+func (s *SnapTestSuite) installTestVersions(c *C, versions ...string) {
+	for _, v := range versions {
+		snapFile := makeTestSnapPackage(c, "name: foo\nversion: "+v+"\nvendor: Foo <foo@example.com>\n")
+		_, err := installClick(snapFile, 0, nil, "bar")
+		c.Assert(err, IsNil)
+	}
+}
+
+func (s *SnapTestSuite) TestInstallClickRemovesJournal(c *C) {
+	s.installTestVersions(c, "1.0")
+
+	c.Check(NeedsRecovery(), Equals, false)
+	journals, err := interruptedInstalls()
+	c.Assert(err, IsNil)
+	c.Check(journals, HasLen, 0)
+}
+
+func (s *SnapTestSuite) TestRecoverInterruptedUnpack(c *C) {
+	s.installTestVersions(c, "1.0")
+	oldDir := filepath.Join(snapAppsDir, "foo.bar", "1.0")
+	instDir := filepath.Join(snapAppsDir, "foo.bar", "2.0")
+	dataDir := filepath.Join(snapDataDir, "foo.bar", "2.0")
+
+	// killed while copying the data
+	c.Assert(os.MkdirAll(filepath.Join(instDir, "meta"), 0755), IsNil)
+	c.Assert(os.MkdirAll(dataDir, 0755), IsNil)
+	j := newInstallJournal("foo.bar", "2.0", instDir, oldDir, false)
+	c.Assert(j.step(installStepData), IsNil)
+	c.Check(NeedsRecovery(), Equals, true)
+
+	c.Assert(Recover(&MockProgressMeter{}), IsNil)
+	c.Check(helpers.FileExists(instDir), Equals, false)
+	c.Check(helpers.FileExists(dataDir), Equals, false)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "1.0")
+	c.Check(NeedsRecovery(), Equals, false)
+}
+
+func (s *SnapTestSuite) TestRecoverInterruptedActivate(c *C) {
+	s.installTestVersions(c, "1.0", "2.0")
+	oldDir := filepath.Join(snapAppsDir, "foo.bar", "1.0")
+	instDir := filepath.Join(snapAppsDir, "foo.bar", "2.0")
+
+	// killed right after the new version was made active
+	j := newInstallJournal("foo.bar", "2.0", instDir, oldDir, false)
+	c.Assert(j.step(installStepActivate), IsNil)
+
+	c.Assert(Recover(&MockProgressMeter{}), IsNil)
+	c.Check(helpers.FileExists(instDir), Equals, false)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "1.0")
+}
+
+func (s *SnapTestSuite) TestRecoverInterruptedAfterActivation(c *C) {
+	s.installTestVersions(c, "1.0", "2.0")
+	oldDir := filepath.Join(snapAppsDir, "foo.bar", "1.0")
+	instDir := filepath.Join(snapAppsDir, "foo.bar", "2.0")
+
+	// killed while restarting the services, the install is kept
+	j := newInstallJournal("foo.bar", "2.0", instDir, oldDir, false)
+	c.Assert(j.step(installStepActivated), IsNil)
+
+	c.Assert(Recover(&MockProgressMeter{}), IsNil)
+	c.Check(helpers.FileExists(instDir), Equals, true)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "2.0")
+	c.Check(NeedsRecovery(), Equals, false)
+}
+
+func (s *SnapTestSuite) TestRecoverInterruptedReinstall(c *C) {
+	s.installTestVersions(c, "1.0")
+	dir := filepath.Join(snapAppsDir, "foo.bar", "1.0")
+	dataDir := filepath.Join(snapDataDir, "foo.bar", "1.0")
+
+	// killed while reinstalling the active version, after it was made
+	// inactive for the data step
+	c.Assert(unsetActiveClick(dir, false, &MockProgressMeter{}), IsNil)
+	j := newInstallJournal("foo.bar", "1.0", dir, dir, false)
+	c.Assert(j.step(installStepData), IsNil)
+
+	c.Assert(Recover(&MockProgressMeter{}), IsNil)
+	c.Check(helpers.FileExists(dir), Equals, true)
+	c.Check(helpers.FileExists(dataDir), Equals, true)
+	c.Assert(ActiveSnapByName("foo"), NotNil)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "1.0")
+	c.Check(NeedsRecovery(), Equals, false)
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"path/filepath"
+	"strconv"
+
+	"launchpad.net/snappy/coreconfig"
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/systemd"
+)
+
+// ResourceLimits are the limits of the resources a service or a binary
+// may use, the zero values mean no limit
+type ResourceLimits struct {
+	// MemoryLimit is a size like "64M"
+	MemoryLimit string `yaml:"memory-limit,omitempty" json:"memory-limit,omitempty"`
+	// CPUQuota is the percentage of the time of one CPU
+	CPUQuota int `yaml:"cpu-quota,omitempty" json:"cpu-quota,omitempty"`
+	TasksMax int `yaml:"tasks-max,omitempty" json:"tasks-max,omitempty"`
+	// IOWeight is the weight of the IO relative to the other processes,
+	// 10 to 1000 (500 if it is not set)
+	IOWeight int `yaml:"io-weight,omitempty" json:"io-weight,omitempty"`
+}
+
+// the IOWeight systemd takes (as BlockIOWeight=)
+const (
+	minIOWeight = 10
+	maxIOWeight = 1000
+)
+
+// verify checks that the limits are valid
+func (l *ResourceLimits) verify() error {
+	if l.MemoryLimit != "" {
+		if _, err := coreconfig.ParseSize(l.MemoryLimit); err != nil {
+			return &ErrInvalidResourceLimit{limit: "memory-limit", value: l.MemoryLimit, msg: "use a size like 64M"}
+		}
+	}
+	if l.CPUQuota < 0 {
+		return &ErrInvalidResourceLimit{limit: "cpu-quota", value: strconv.Itoa(l.CPUQuota), msg: "must not be negative"}
+	}
+	if l.TasksMax < 0 {
+		return &ErrInvalidResourceLimit{limit: "tasks-max", value: strconv.Itoa(l.TasksMax), msg: "must not be negative"}
+	}
+	if l.IOWeight != 0 && (l.IOWeight < minIOWeight || l.IOWeight > maxIOWeight) {
+		return &ErrInvalidResourceLimit{limit: "io-weight", value: strconv.Itoa(l.IOWeight), msg: "must be between 10 and 1000"}
+	}
+
+	return nil
+}
+
+// merge returns the limits with the ones set in override replacing them
+func (l ResourceLimits) merge(override ResourceLimits) ResourceLimits {
+	if override.MemoryLimit != "" {
+		l.MemoryLimit = override.MemoryLimit
+	}
+	if override.CPUQuota != 0 {
+		l.CPUQuota = override.CPUQuota
+	}
+	if override.TasksMax != 0 {
+		l.TasksMax = override.TasksMax
+	}
+	if override.IOWeight != 0 {
+		l.IOWeight = override.IOWeight
+	}
+
+	return l
+}
+
+// systemdLimits returns the limits of a service or binary of the given
+// snap for systemd, the limits that were set for the snap replace the
+// ones of its package.yaml
+func systemdLimits(pkgname string, limits ResourceLimits) (systemd.ResourceLimits, error) {
+	overrides, err := readSnapLimits()
+	if err != nil {
+		return systemd.ResourceLimits{}, err
+	}
+	limits = limits.merge(overrides[pkgname])
+
+	var memoryLimit int64
+	if limits.MemoryLimit != "" {
+		memoryLimit, err = coreconfig.ParseSize(limits.MemoryLimit)
+		if err != nil {
+			return systemd.ResourceLimits{}, err
+		}
+	}
+
+	return systemd.ResourceLimits{
+		MemoryLimit:   memoryLimit,
+		CPUQuota:      limits.CPUQuota,
+		TasksMax:      limits.TasksMax,
+		BlockIOWeight: limits.IOWeight,
+	}, nil
+}
+
+// snapLimitsStore has the limits that were set for the snaps
+var snapLimitsStore = newSnapStore(&snapLimitsFile, func() interface{} { return &map[string]ResourceLimits{} })
+
+// readSnapLimits returns the limits that were set by snap name
+func readSnapLimits() (map[string]ResourceLimits, error) {
+	limits := make(map[string]ResourceLimits)
+	if err := snapLimitsStore.read(&limits); err != nil {
+		return nil, err
+	}
+
+	return limits, nil
+}
+
+// setSnapLimits changes the limits of the given snap with the given
+// function, regenerates its services and binaries with them and applies
+// them to the running services
+func setSnapLimits(pkgname string, change func(limits *ResourceLimits) error) error {
+	name, _ := splitNamespace(pkgname)
+	part, ok := ActiveSnapByName(name).(*SnapPart)
+	if !ok {
+		return ErrNotInstalled
+	}
+
+	all, err := readSnapLimits()
+	if err != nil {
+		return err
+	}
+
+	limits := all[name]
+	if err := change(&limits); err != nil {
+		return err
+	}
+	if err := limits.verify(); err != nil {
+		return err
+	}
+
+	if limits == (ResourceLimits{}) {
+		delete(all, name)
+	} else {
+		all[name] = limits
+	}
+	if err := snapLimitsStore.write(all); err != nil {
+		return err
+	}
+
+	if err := regenerateServicesAndBinaries(part); err != nil {
+		return err
+	}
+
+	return applyServiceLimits(part)
+}
+
+// applyServiceLimits applies the limits of the services of the given
+// snap to the ones that are running. Limits that were removed (and are
+// not in the package.yaml) stay until the service is restarted.
+func applyServiceLimits(part *SnapPart) error {
+	sysd := systemd.New(globalRootDir, &progress.NullProgress{})
+	for _, service := range part.Services() {
+		serviceName := filepath.Base(generateServiceFileName(part.m, service))
+		status, err := sysd.Status(serviceName)
+		if err != nil {
+			return err
+		}
+		if status.ActiveState != "active" {
+			continue
+		}
+
+		limits, err := systemdLimits(part.m.Name, service.ResourceLimits)
+		if err != nil {
+			return err
+		}
+		if err := sysd.SetLimits(serviceName, limits); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// regenerateServicesAndBinaries writes the units of the services and the
+// wrappers of the binaries of the given snap again
+func regenerateServicesAndBinaries(part *SnapPart) error {
+	for _, service := range part.Services() {
+		if err := writeServiceFile(part.m, service, part.basedir); err != nil {
+			return err
+		}
+	}
+	if len(part.Services()) > 0 {
+		if err := systemd.New(globalRootDir, &progress.NullProgress{}).DaemonReload(); err != nil {
+			return err
+		}
+	}
+
+	return addPackageBinaries(part.basedir)
+}
+
+// setSnapMemoryLimitProperty is the "memory-limit" property of
+// SetProperty
+func setSnapMemoryLimitProperty(pkgname, value string) error {
+	return setSnapLimits(pkgname, func(limits *ResourceLimits) error {
+		limits.MemoryLimit = value
+		return nil
+	})
+}
+
+// setSnapCPUQuotaProperty is the "cpu-quota" property of SetProperty
+func setSnapCPUQuotaProperty(pkgname, value string) error {
+	return setSnapLimits(pkgname, func(limits *ResourceLimits) (err error) {
+		limits.CPUQuota, err = parseCountProperty(value)
+		return err
+	})
+}
+
+// setSnapTasksMaxProperty is the "tasks-max" property of SetProperty
+func setSnapTasksMaxProperty(pkgname, value string) error {
+	return setSnapLimits(pkgname, func(limits *ResourceLimits) (err error) {
+		limits.TasksMax, err = parseCountProperty(value)
+		return err
+	})
+}
+
+// setSnapIOWeightProperty is the "io-weight" property of SetProperty
+func setSnapIOWeightProperty(pkgname, value string) error {
+	return setSnapLimits(pkgname, func(limits *ResourceLimits) (err error) {
+		limits.IOWeight, err = parseCountProperty(value)
+		return err
+	})
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/systemd"
+
+	. "launchpad.net/gocheck"
+)
+
+const limitsPackageYaml = `name: foo
+version: 1.0
+icon: foo.svg
+vendor: Foo Bar <foo@example.com>
+services:
+ - name: svc
+   start: bin/foo
+   memory-limit: 64M
+   cpu-quota: 50
+binaries:
+ - name: bin/foo
+   tasks-max: 10
+`
+
+// installLimitsSnap installs a snap with resource limits and returns
+// its unit and wrapper files
+func (s *SnapTestSuite) installLimitsSnap(c *C) (unitFile, wrapperFile string) {
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		return []byte("ActiveState=inactive\n"), nil
+	}
+
+	snapFile := makeTestSnapPackage(c, limitsPackageYaml)
+	_, err := installClick(snapFile, AllowUnauthenticated, &progress.NullProgress{}, testNamespace)
+	c.Assert(err, IsNil)
+
+	return filepath.Join(snapServicesDir, "foo_svc_1.0.service"), filepath.Join(snapBinariesDir, "foo.foo")
+}
+
+func (s *SnapTestSuite) TestResourceLimitsVerify(c *C) {
+	c.Check((&ResourceLimits{MemoryLimit: "1G", CPUQuota: 200, TasksMax: 1, IOWeight: 1000}).verify(), IsNil)
+
+	c.Check((&ResourceLimits{MemoryLimit: "lots"}).verify(), ErrorMatches, `invalid memory-limit "lots": .*`)
+	c.Check((&ResourceLimits{CPUQuota: -1}).verify(), NotNil)
+	c.Check((&ResourceLimits{TasksMax: -1}).verify(), NotNil)
+	c.Check((&ResourceLimits{IOWeight: 1001}).verify(), ErrorMatches, `invalid io-weight "1001": .*`)
+	c.Check((&ResourceLimits{IOWeight: 9}).verify(), ErrorMatches, `invalid io-weight "9": .*`)
+
+	c.Check(verifyServiceYaml(Service{ResourceLimits: ResourceLimits{MemoryLimit: "x"}}), NotNil)
+	c.Check(verifyBinariesYaml(Binary{ResourceLimits: ResourceLimits{IOWeight: -1}}), NotNil)
+}
+
+func (s *SnapTestSuite) TestResourceLimitsFromPackageYaml(c *C) {
+	m, err := parsePackageYamlData([]byte(limitsPackageYaml))
+	c.Assert(err, IsNil)
+	c.Check(m.Services[0].ResourceLimits, Equals, ResourceLimits{MemoryLimit: "64M", CPUQuota: 50})
+	c.Check(m.Binaries[0].ResourceLimits, Equals, ResourceLimits{TasksMax: 10})
+
+	unitFile, wrapperFile := s.installLimitsSnap(c)
+
+	unit, err := ioutil.ReadFile(unitFile)
+	c.Assert(err, IsNil)
+	c.Check(string(unit), Matches, `(?s).*\nMemoryLimit=67108864\nCPUQuota=50%\n.*`)
+
+	wrapper, err := ioutil.ReadFile(wrapperFile)
+	c.Assert(err, IsNil)
+	// systemd-run refuses TasksMax= on systemd 219, so there is no scope
+	c.Check(string(wrapper), Not(Matches), `(?s).*systemd-run.*`)
+}
+
+func (s *SnapTestSuite) TestSetResourceLimitProperties(c *C) {
+	unitFile, wrapperFile := s.installLimitsSnap(c)
+
+	var calls [][]string
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		calls = append(calls, cmd)
+		return []byte("ActiveState=active\n"), nil
+	}
+
+	// the set limits replace the ones of the package.yaml
+	c.Assert(setSnapMemoryLimitProperty("foo", "128M"), IsNil)
+	c.Assert(setSnapIOWeightProperty("foo", "500"), IsNil)
+	c.Check(hasCall(calls, "daemon-reload"), Equals, true)
+
+	// the running service gets them right away
+	c.Check(calls[len(calls)-1], DeepEquals, []string{"set-property", "--runtime", "foo_svc_1.0.service", "MemoryLimit=134217728", "CPUQuota=50%", "BlockIOWeight=500"})
+
+	unit, err := ioutil.ReadFile(unitFile)
+	c.Assert(err, IsNil)
+	c.Check(string(unit), Matches, `(?s).*\nMemoryLimit=134217728\nCPUQuota=50%\nBlockIOWeight=500\n.*`)
+
+	wrapper, err := ioutil.ReadFile(wrapperFile)
+	c.Assert(err, IsNil)
+	c.Check(string(wrapper), Matches, `(?s).*\nif \[ "\$\(id -u\)" = "0" \]; then\n    systemd-run --scope --quiet -p MemoryLimit=134217728 -p BlockIOWeight=500 ubuntu-core-launcher .*\nelse\n    ubuntu-core-launcher .*`)
+
+	// and an empty value resets them
+	c.Assert(setSnapMemoryLimitProperty("foo", ""), IsNil)
+	c.Assert(setSnapIOWeightProperty("foo", ""), IsNil)
+	limits, err := readSnapLimits()
+	c.Assert(err, IsNil)
+	c.Check(limits, HasLen, 0)
+
+	unit, err = ioutil.ReadFile(unitFile)
+	c.Assert(err, IsNil)
+	c.Check(string(unit), Matches, `(?s).*\nMemoryLimit=67108864\nCPUQuota=50%\n\n.*`)
+}
+
+func (s *SnapTestSuite) TestSetResourceLimitPropertyInvalid(c *C) {
+	s.installLimitsSnap(c)
+
+	c.Check(setSnapMemoryLimitProperty("foo", "lots"), NotNil)
+	c.Check(setSnapCPUQuotaProperty("foo", "half"), NotNil)
+	c.Check(setSnapTasksMaxProperty("foo", "-1"), NotNil)
+	c.Check(setSnapIOWeightProperty("foo", "0x10"), NotNil)
+	c.Check(setSnapTasksMaxProperty("no-such-snap", "1"), Equals, ErrNotInstalled)
+
+	limits, err := readSnapLimits()
+	c.Assert(err, IsNil)
+	c.Check(limits, HasLen, 0)
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"launchpad.net/snappy/clickdeb"
+	"launchpad.net/snappy/helpers"
+	"launchpad.net/snappy/progress"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Mirror is an offline repository (see SnapOfflineRepository) that is
+// filled with snaps downloaded from the configured stores
+type Mirror struct {
+	dir   string
+	store *MetaRepository
+	index *offlineIndex
+	// the files of replaced snaps, they are removed by Save
+	obsolete []string
+}
+
+// NewMirror returns a Mirror for the given directory, it is created if
+// it does not exist yet. Snaps that are already in the mirror are only
+// downloaded again when the store has a new version.
+func NewMirror(dir string) (*Mirror, error) {
+	if err := helpers.EnsureDir(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// only the stores, a mirror is not made from other offline
+	// repositories
+	store := newMetaRepositoryForSources(SourceTypeStore)
+	if len(store.all) == 0 {
+		return nil, ErrNoStoreSources
+	}
+
+	idx, err := readOfflineIndex(dir)
+	switch {
+	case os.IsNotExist(err):
+		idx = &offlineIndex{}
+	case err != nil:
+		return nil, err
+	}
+
+	return &Mirror{dir: dir, store: store, index: idx}, nil
+}
+
+// Names returns the names (with namespace) of the snaps in the mirror
+func (m *Mirror) Names() []string {
+	names := make([]string, 0, len(m.index.Snaps))
+	for _, snap := range m.index.Snaps {
+		if snap.Namespace == "" {
+			names = append(names, snap.Name)
+		} else {
+			names = append(names, snap.Name+"."+snap.Namespace)
+		}
+	}
+
+	return names
+}
+
+// find returns the index of the given snap in the mirror index, or -1
+func (m *Mirror) find(name, namespace string) int {
+	for i, snap := range m.index.Snaps {
+		if snap.Name == name && snap.Namespace == namespace {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Add downloads the current version of the given snap from the stores
+// into the mirror, unless the mirror already has it. It returns the
+// mirrored part and the frameworks it needs.
+func (m *Mirror) Add(name string, pbar progress.Meter) (Part, []string, error) {
+	found, err := m.store.Details(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the newest version if more than one store has the snap
+	var remote *RemoteSnapPart
+	for _, part := range found {
+		r, ok := part.(*RemoteSnapPart)
+		if ok && (remote == nil || VersionCompare(remote.Version(), r.Version()) < 0) {
+			remote = r
+		}
+	}
+	if remote == nil {
+		return nil, nil, ErrPackageNotFound
+	}
+	pkg := remote.pkg
+
+	i := m.find(pkg.Name, pkg.Namespace)
+	if i > -1 {
+		cur := m.index.Snaps[i]
+		if cur.Version == pkg.Version && helpers.FileExists(filepath.Join(m.dir, cur.File)) {
+			return NewOfflineSnapPart(cur, m.dir), cur.Frameworks, nil
+		}
+	}
+
+	// download straight into the mirror (and not the download cache
+	// that only root can write to), a partial download is resumed on
+	// the next run
+	downloaded, err := remote.downloadTo(m.dir, pbar)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snapName := fmt.Sprintf("%s.%s_%s_%s.snap", pkg.Name, pkg.Namespace, pkg.Version, Architecture())
+	target := filepath.Join(m.dir, snapName)
+	if err := os.Rename(downloaded, target); err != nil {
+		os.Remove(downloaded)
+		return nil, nil, err
+	}
+
+	entry, err := offlineSnapFromFile(target)
+	if err != nil {
+		os.Remove(target)
+		return nil, nil, err
+	}
+	entry.Namespace = pkg.Namespace
+	entry.Title = pkg.Title
+	entry.LastUpdated = pkg.LastUpdated
+
+	if i > -1 {
+		if old := m.index.Snaps[i].File; old != entry.File {
+			m.obsolete = append(m.obsolete, old)
+		}
+		m.index.Snaps[i] = *entry
+	} else {
+		m.index.Snaps = append(m.index.Snaps, *entry)
+	}
+
+	return NewOfflineSnapPart(*entry, m.dir), entry.Frameworks, nil
+}
+
+// Save writes the index of the mirror, and its sha512 to detect an index
+// that was damaged (e.g. copied only partly). The sha512 does not
+// protect against changes, the signatures of the snaps do. The files of
+// replaced snaps are only removed once the new index is written.
+func (m *Mirror) Save() error {
+	sort.Sort(byOfflineSnapName(m.index.Snaps))
+
+	yamlData, err := yaml.Marshal(m.index)
+	if err != nil {
+		return err
+	}
+
+	if err := helpers.AtomicWriteFile(filepath.Join(m.dir, offlineIndexName), yamlData, 0644); err != nil {
+		return err
+	}
+
+	if err := helpers.AtomicWriteFile(filepath.Join(m.dir, offlineIndexHashName), []byte(sha512sum(yamlData)+"\n"), 0644); err != nil {
+		return err
+	}
+
+	for _, old := range m.obsolete {
+		os.Remove(filepath.Join(m.dir, old))
+	}
+	m.obsolete = nil
+
+	return nil
+}
+
+// offlineSnapFromFile returns the index entry for the given .snap file
+func offlineSnapFromFile(snapFile string) (*offlineSnap, error) {
+	d, err := clickdeb.Open(snapFile)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	yamlData, err := d.MetaMember("package.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	py, err := parsePackageYamlData(yamlData)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := os.Stat(snapFile)
+	if err != nil {
+		return nil, err
+	}
+
+	hexdigest, err := helpers.Sha512sum(snapFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &offlineSnap{
+		Name:       py.Name,
+		Version:    py.Version,
+		Type:       py.Type,
+		File:       filepath.Base(snapFile),
+		Sha512:     hexdigest,
+		Size:       st.Size(),
+		Frameworks: py.Frameworks,
+	}, nil
+}
+
+type byOfflineSnapName []offlineSnap
+
+func (bn byOfflineSnapName) Len() int      { return len(bn) }
+func (bn byOfflineSnapName) Swap(a, b int) { bn[a], bn[b] = bn[b], bn[a] }
+func (bn byOfflineSnapName) Less(a, b int) bool {
+	if bn[a].Name != bn[b].Name {
+		return bn[a].Name < bn[b].Name
+	}
+
+	return bn[a].Namespace < bn[b].Namespace
+}
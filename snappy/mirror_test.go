@@ -0,0 +1,230 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"launchpad.net/snappy/helpers"
+
+	. "launchpad.net/gocheck"
+)
+
+// mockMirrorStore serves the given package.yaml snaps (in the "bar"
+// namespace) as a store and counts the downloads
+type mockMirrorStore struct {
+	server    *httptest.Server
+	snaps     map[string]string
+	downloads int
+}
+
+func (s *SnapTestSuite) newMockMirrorStore(c *C, packageYamls ...string) *mockMirrorStore {
+	store := &mockMirrorStore{snaps: make(map[string]string)}
+	details := make(map[string]remoteSnap)
+	for _, packageYaml := range packageYamls {
+		m, err := parsePackageYamlData([]byte(packageYaml))
+		c.Assert(err, IsNil)
+		snapFile := makeTestSnapPackage(c, packageYaml)
+		sha512, err := helpers.Sha512sum(snapFile)
+		c.Assert(err, IsNil)
+
+		store.snaps[m.Name] = snapFile
+		details[m.Name] = remoteSnap{
+			Name:           m.Name,
+			Namespace:      "bar",
+			Version:        m.Version,
+			Title:          m.Name + " title",
+			DownloadSha512: sha512,
+			LastUpdated:    "2015-04-15T18:30:16Z",
+		}
+	}
+
+	store.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/details/"):
+			name, _ := splitNamespace(strings.TrimPrefix(r.URL.Path, "/details/"))
+			snap, ok := details[name]
+			if !ok {
+				w.WriteHeader(404)
+				return
+			}
+			snap.AnonDownloadURL = store.server.URL + "/download/" + name
+			json.NewEncoder(w).Encode(snap)
+		case strings.HasPrefix(r.URL.Path, "/download/"):
+			store.downloads++
+			http.ServeFile(w, r, store.snaps[strings.TrimPrefix(r.URL.Path, "/download/")])
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+
+	var err error
+	storeDetailsURI, err = url.Parse(store.server.URL + "/details/")
+	c.Assert(err, IsNil)
+
+	return store
+}
+
+func (s *SnapTestSuite) TestMirrorAdd(c *C) {
+	store := s.newMockMirrorStore(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\nframeworks: [fmk]\n")
+	defer store.server.Close()
+
+	mirrorDir := filepath.Join(c.MkDir(), "mirror")
+	m, err := NewMirror(mirrorDir)
+	c.Assert(err, IsNil)
+
+	part, frameworks, err := m.Add("foo", nil)
+	c.Assert(err, IsNil)
+	c.Check(part.Name(), Equals, "foo")
+	c.Check(part.Namespace(), Equals, "bar")
+	c.Check(part.Version(), Equals, "1.0")
+	c.Check(frameworks, DeepEquals, []string{"fmk"})
+	c.Assert(m.Save(), IsNil)
+
+	// the result can be used as an offline repository
+	repo := NewOfflineSnapRepository(mirrorDir)
+	c.Assert(repo, NotNil)
+	parts, err := repo.Details("foo.bar")
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 1)
+	c.Check(parts[0].Description(), Equals, "foo title")
+	snapFile, err := parts[0].(*OfflineSnapPart).fetch(nil)
+	c.Assert(err, IsNil)
+	os.Remove(snapFile)
+	c.Check(helpers.FileExists(filepath.Join(mirrorDir, offlineIndexHashName)), Equals, true)
+}
+
+func (s *SnapTestSuite) TestMirrorIsIncremental(c *C) {
+	store := s.newMockMirrorStore(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	defer store.server.Close()
+
+	mirrorDir := c.MkDir()
+	m, err := NewMirror(mirrorDir)
+	c.Assert(err, IsNil)
+	_, _, err = m.Add("foo", nil)
+	c.Assert(err, IsNil)
+	c.Assert(m.Save(), IsNil)
+	c.Assert(store.downloads, Equals, 1)
+
+	// same version in the store, nothing is downloaded
+	m, err = NewMirror(mirrorDir)
+	c.Assert(err, IsNil)
+	c.Check(m.Names(), DeepEquals, []string{"foo.bar"})
+	_, _, err = m.Add("foo.bar", nil)
+	c.Assert(err, IsNil)
+	c.Check(store.downloads, Equals, 1)
+}
+
+func (s *SnapTestSuite) TestMirrorReplacesOldVersion(c *C) {
+	store := s.newMockMirrorStore(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	mirrorDir := c.MkDir()
+	m, err := NewMirror(mirrorDir)
+	c.Assert(err, IsNil)
+	_, _, err = m.Add("foo", nil)
+	c.Assert(err, IsNil)
+	c.Assert(m.Save(), IsNil)
+	store.server.Close()
+
+	store = s.newMockMirrorStore(c, "name: foo\nversion: 2.0\nvendor: Foo <foo@example.com>\n")
+	defer store.server.Close()
+	m, err = NewMirror(mirrorDir)
+	c.Assert(err, IsNil)
+	part, _, err := m.Add("foo", nil)
+	c.Assert(err, IsNil)
+	c.Check(part.Version(), Equals, "2.0")
+	c.Assert(m.Save(), IsNil)
+
+	snaps, err := filepath.Glob(filepath.Join(mirrorDir, "*.snap"))
+	c.Assert(err, IsNil)
+	c.Assert(snaps, HasLen, 1)
+	c.Check(strings.Contains(snaps[0], "_2.0_"), Equals, true)
+}
+
+func (s *SnapTestSuite) TestMirrorRemovesOldSnapOnSave(c *C) {
+	store := s.newMockMirrorStore(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	mirrorDir := c.MkDir()
+	m, err := NewMirror(mirrorDir)
+	c.Assert(err, IsNil)
+	old, _, err := m.Add("foo", nil)
+	c.Assert(err, IsNil)
+	c.Assert(m.Save(), IsNil)
+	store.server.Close()
+	oldFile := old.(*OfflineSnapPart).snapFile()
+
+	store = s.newMockMirrorStore(c, "name: foo\nversion: 2.0\nvendor: Foo <foo@example.com>\n")
+	defer store.server.Close()
+	m, err = NewMirror(mirrorDir)
+	c.Assert(err, IsNil)
+	part, _, err := m.Add("foo", nil)
+	c.Assert(err, IsNil)
+	c.Check(part.Version(), Equals, "2.0")
+
+	// the old index still points at the old snap until it is saved
+	c.Check(helpers.FileExists(oldFile), Equals, true)
+	c.Assert(m.Save(), IsNil)
+	c.Check(helpers.FileExists(oldFile), Equals, false)
+	c.Check(helpers.FileExists(part.(*OfflineSnapPart).snapFile()), Equals, true)
+
+	// the (root only) download cache is not used
+	c.Check(helpers.FileExists(snapDownloadCacheDir), Equals, false)
+}
+
+func (s *SnapTestSuite) TestMirrorUnknownSnap(c *C) {
+	store := s.newMockMirrorStore(c)
+	defer store.server.Close()
+
+	m, err := NewMirror(c.MkDir())
+	c.Assert(err, IsNil)
+	_, _, err = m.Add("no-such-snap", nil)
+	c.Assert(err, Equals, ErrPackageNotFound)
+}
+
+func (s *SnapTestSuite) TestMirrorUsesConfiguredStores(c *C) {
+	store := s.newMockMirrorStore(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	defer store.server.Close()
+
+	// offline sources are not mirrored from
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 2.0\nvendor: Foo <foo@example.com>\n")
+	s.writeSourcesFile(c, "10-usb.yaml", "sources:\n - name: usb\n   type: offline\n   uri: "+repoDir+"\n")
+	m, err := NewMirror(c.MkDir())
+	c.Assert(err, IsNil)
+	part, _, err := m.Add("foo", nil)
+	c.Assert(err, IsNil)
+	c.Check(part.Version(), Equals, "1.0")
+
+	s.writeSourcesFile(c, "20-no-store.yaml", "sources:\n - name: ubuntu-store\n   type: store\n   enabled: false\n")
+	_, err = NewMirror(c.MkDir())
+	c.Assert(err, Equals, ErrNoStoreSources)
+}
+
+func (s *SnapTestSuite) TestOfflineRepositoryIndexHashMismatch(c *C) {
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	c.Assert(ioutil.WriteFile(filepath.Join(repoDir, offlineIndexHashName), []byte("deadbeef\n"), 0644), IsNil)
+
+	repo := NewOfflineSnapRepository(repoDir)
+	c.Assert(repo, NotNil)
+	_, err := repo.Details("foo")
+	c.Assert(err, Equals, ErrOfflineIndexHashMismatch)
+}
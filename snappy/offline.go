@@ -0,0 +1,446 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"launchpad.net/snappy/progress"
+
+	"gopkg.in/yaml.v2"
+)
+
+// the name of the index file of an offline repository
+const offlineIndexName = "index.yaml"
+
+// the name of the (optional) file with the sha512 of the index, it is
+// a checksum against damaged indexes and not a signature: the snaps
+// themselves are verified as all snaps are when they are installed
+const offlineIndexHashName = offlineIndexName + ".sha512"
+
+// offlineSnap is a single snap in the index of an offline repository
+type offlineSnap struct {
+	Name        string   `yaml:"name"`
+	Namespace   string   `yaml:"namespace,omitempty"`
+	Version     string   `yaml:"version"`
+	Type        SnapType `yaml:"type,omitempty"`
+	Title       string   `yaml:"title,omitempty"`
+	File        string   `yaml:"file"`
+	Sha512      string   `yaml:"sha512"`
+	Size        int64    `yaml:"size,omitempty"`
+	Frameworks  []string `yaml:"frameworks,omitempty"`
+	LastUpdated string   `yaml:"last-updated,omitempty"`
+}
+
+// offlineIndex is the index of an offline repository
+type offlineIndex struct {
+	Snaps []offlineSnap `yaml:"snaps"`
+}
+
+func parseOfflineIndex(yamlData []byte) (*offlineIndex, error) {
+	var idx offlineIndex
+	if err := yaml.Unmarshal(yamlData, &idx); err != nil {
+		return nil, err
+	}
+
+	for _, snap := range idx.Snaps {
+		if snap.Name == "" || snap.Version == "" || snap.File == "" || snap.Sha512 == "" {
+			return nil, ErrInvalidOfflineIndex
+		}
+		// apps are always installed into a namespace
+		if (snap.Type == "" || snap.Type == SnapTypeApp) && snap.Namespace == "" {
+			return nil, ErrInvalidOfflineIndex
+		}
+	}
+
+	return &idx, nil
+}
+
+// SnapOfflineRepository is a repository of .snap files in a local
+// directory (e.g. a usb stick or a nfs share) that is described by an
+// index.yaml file
+type SnapOfflineRepository struct {
+	path string
+}
+
+// NewOfflineSnapRepository returns a new SnapOfflineRepository for the
+// given path
+func NewOfflineSnapRepository(path string) *SnapOfflineRepository {
+	if s, err := os.Stat(path); err != nil || !s.IsDir() {
+		return nil
+	}
+	return &SnapOfflineRepository{path: path}
+}
+
+// Description describes the offline repository
+func (s *SnapOfflineRepository) Description() string {
+	return fmt.Sprintf("Snap offline repository for %s", s.path)
+}
+
+// index returns the index of the repository, a repository without an
+// index has no snaps
+func (s *SnapOfflineRepository) index() (*offlineIndex, error) {
+	idx, err := readOfflineIndex(s.path)
+	if os.IsNotExist(err) {
+		return &offlineIndex{}, nil
+	}
+
+	return idx, err
+}
+
+// readOfflineIndex reads the index of the offline repository in dir, if
+// there is a index.yaml.sha512 file (written by "snappy mirror") the
+// index is checked against it
+func readOfflineIndex(dir string) (*offlineIndex, error) {
+	yamlData, err := ioutil.ReadFile(filepath.Join(dir, offlineIndexName))
+	if err != nil {
+		return nil, err
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join(dir, offlineIndexHashName))
+	switch {
+	case err == nil:
+		if strings.TrimSpace(string(expected)) != sha512sum(yamlData) {
+			return nil, ErrOfflineIndexHashMismatch
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	return parseOfflineIndex(yamlData)
+}
+
+// sha512sum returns the hex encoded sha512 of the given data
+func sha512sum(data []byte) string {
+	h := sha512.Sum512(data)
+	return hex.EncodeToString(h[:])
+}
+
+// newest returns a part for the newest version of each snap (by name
+// and namespace) in the index that "filter" returns true for
+func (s *SnapOfflineRepository) newest(filter func(snap *offlineSnap) bool) (parts []Part, err error) {
+	idx, err := s.index()
+	if err != nil {
+		return nil, err
+	}
+
+	newest := make(map[string]*offlineSnap)
+	var order []string
+	for i := range idx.Snaps {
+		snap := &idx.Snaps[i]
+		if !filter(snap) {
+			continue
+		}
+
+		key := snap.Name + "." + snap.Namespace
+		cur, ok := newest[key]
+		if !ok {
+			order = append(order, key)
+		}
+		if !ok || VersionCompare(cur.Version, snap.Version) < 0 {
+			newest[key] = snap
+		}
+	}
+
+	for _, key := range order {
+		parts = append(parts, NewOfflineSnapPart(*newest[key], s.path))
+	}
+
+	return parts, nil
+}
+
+// Details returns details for the given snap
+func (s *SnapOfflineRepository) Details(snapName string) ([]Part, error) {
+	name, namespace := splitNamespace(snapName)
+
+	parts, err := s.newest(func(snap *offlineSnap) bool {
+		return snap.Name == name && (namespace == "" || snap.Namespace == namespace)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, ErrPackageNotFound
+	}
+
+	return parts, nil
+}
+
+// Updates returns the snaps in the repository that are newer than the
+// installed ones
+func (s *SnapOfflineRepository) Updates() (parts []Part, err error) {
+	candidates, err := s.newest(func(snap *offlineSnap) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+
+	for _, part := range candidates {
+		current := ActiveSnapByName(part.Name())
+		if current == nil || current.Namespace() != part.Namespace() {
+			continue
+		}
+		if VersionCompare(current.Version(), part.Version()) < 0 {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts, nil
+}
+
+// Installed returns the installed snaps from this repository
+func (s *SnapOfflineRepository) Installed() (parts []Part, err error) {
+	return nil, err
+}
+
+// Search searches the names and titles of the snaps in the repository
+func (s *SnapOfflineRepository) Search(searchTerm string) (SharedNames, error) {
+	terms := strings.Split(strings.ToLower(searchTerm), ",")
+
+	parts, err := s.newest(func(snap *offlineSnap) bool {
+		for _, term := range terms {
+			if strings.Contains(strings.ToLower(snap.Name), term) || strings.Contains(strings.ToLower(snap.Title), term) {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sharedNames := make(SharedNames, len(parts))
+	for _, part := range parts {
+		if _, ok := sharedNames[part.Name()]; !ok {
+			sharedNames[part.Name()] = new(SharedName)
+		}
+		sharedNames[part.Name()].Parts = append(sharedNames[part.Name()].Parts, part)
+	}
+
+	return sharedNames, nil
+}
+
+// OfflineSnapPart represents a snap available in an offline repository
+type OfflineSnapPart struct {
+	pkg offlineSnap
+	dir string
+}
+
+// NewOfflineSnapPart returns a new OfflineSnapPart for the given index
+// entry of the offline repository in dir
+func NewOfflineSnapPart(data offlineSnap, dir string) *OfflineSnapPart {
+	return &OfflineSnapPart{pkg: data, dir: dir}
+}
+
+// Type returns the type of the SnapPart (app, oem, ...)
+func (s *OfflineSnapPart) Type() SnapType {
+	if s.pkg.Type != "" {
+		return s.pkg.Type
+	}
+
+	return SnapTypeApp
+}
+
+// Name returns the name
+func (s *OfflineSnapPart) Name() string {
+	return s.pkg.Name
+}
+
+// Version returns the version
+func (s *OfflineSnapPart) Version() string {
+	return s.pkg.Version
+}
+
+// Description returns the description
+func (s *OfflineSnapPart) Description() string {
+	return s.pkg.Title
+}
+
+// Namespace is the origin
+func (s *OfflineSnapPart) Namespace() string {
+	return s.pkg.Namespace
+}
+
+// Hash returns the hash
+func (s *OfflineSnapPart) Hash() string {
+	return s.pkg.Sha512
+}
+
+// Channel returns the channel the snap tracks, offline repositories
+// have no channels of their own
+func (s *OfflineSnapPart) Channel() string {
+	return snapChannel(s.Name())
+}
+
+// Icon returns the icon
+func (s *OfflineSnapPart) Icon() string {
+	return ""
+}
+
+// IsActive returns true if the snap is active
+func (s *OfflineSnapPart) IsActive() bool {
+	return false
+}
+
+// IsInstalled returns true if the snap is installed
+func (s *OfflineSnapPart) IsInstalled() bool {
+	return false
+}
+
+// InstalledSize returns the size of the installed snap
+func (s *OfflineSnapPart) InstalledSize() int64 {
+	return -1
+}
+
+// DownloadSize returns the size of the .snap file
+func (s *OfflineSnapPart) DownloadSize() int64 {
+	if s.pkg.Size > 0 {
+		return s.pkg.Size
+	}
+
+	st, err := os.Stat(s.snapFile())
+	if err != nil {
+		return -1
+	}
+
+	return st.Size()
+}
+
+// Date returns the last update time
+func (s *OfflineSnapPart) Date() time.Time {
+	if p, err := time.Parse(time.RFC3339, s.pkg.LastUpdated); err == nil {
+		return p
+	}
+
+	st, err := os.Stat(s.snapFile())
+	if err != nil {
+		return time.Time{}
+	}
+
+	return st.ModTime()
+}
+
+// snapFile returns the path of the .snap file, it is always inside the
+// repository directory
+func (s *OfflineSnapPart) snapFile() string {
+	return filepath.Join(s.dir, filepath.Base(s.pkg.File))
+}
+
+// fetch copies the .snap file to a local temporary file, checks the
+// copy against the size and sha512 of the index and returns its name.
+// The copy is what gets installed, so the file can not be changed (e.g.
+// on a nfs share) between the check and the install.
+func (s *OfflineSnapPart) fetch(pbar progress.Meter) (snapFile string, err error) {
+	f, err := os.Open(s.snapFile())
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	w, err := ioutil.TempFile("", "snappy-offline-")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		w.Close()
+		if err != nil {
+			os.Remove(w.Name())
+		}
+	}()
+
+	hasher := sha512.New()
+	dest := io.MultiWriter(w, hasher)
+	if pbar != nil {
+		if st, err := f.Stat(); err == nil {
+			pbar.Start(float64(st.Size()))
+		}
+		dest = io.MultiWriter(w, hasher, pbar)
+	}
+	size, err := io.Copy(dest, f)
+	if pbar != nil {
+		pbar.Finished()
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := w.Sync(); err != nil {
+		return "", err
+	}
+
+	if s.pkg.Size > 0 && size != s.pkg.Size {
+		return "", &ErrDownloadSizeMismatch{
+			snap:     s.pkg.Name,
+			expected: s.pkg.Size,
+			got:      size,
+		}
+	}
+
+	hexdigest := hex.EncodeToString(hasher.Sum(nil))
+	if hexdigest != s.pkg.Sha512 {
+		return "", &ErrDownloadHashMismatch{
+			snap:     s.pkg.Name,
+			expected: s.pkg.Sha512,
+			got:      hexdigest,
+		}
+	}
+
+	return w.Name(), nil
+}
+
+// Install installs the snap
+func (s *OfflineSnapPart) Install(pbar progress.Meter, flags InstallFlags) (string, error) {
+	snapFile, err := s.fetch(pbar)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(snapFile)
+
+	return installClick(snapFile, flags, pbar, s.Namespace())
+}
+
+// SetActive sets the snap active
+func (s *OfflineSnapPart) SetActive(progress.Meter) error {
+	return ErrNotInstalled
+}
+
+// Uninstall remove the snap from the system
+func (s *OfflineSnapPart) Uninstall(progress.Meter) error {
+	return ErrNotInstalled
+}
+
+// Config is used to to configure the snap
+func (s *OfflineSnapPart) Config(configuration []byte) (new string, err error) {
+	return "", err
+}
+
+// NeedsReboot returns true if the snap becomes active on the next reboot
+func (s *OfflineSnapPart) NeedsReboot() bool {
+	return false
+}
+
+// Frameworks returns the list of frameworks needed by the snap
+func (s *OfflineSnapPart) Frameworks() ([]string, error) {
+	return s.pkg.Frameworks, nil
+}
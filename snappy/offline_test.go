@@ -0,0 +1,230 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"launchpad.net/snappy/helpers"
+
+	. "launchpad.net/gocheck"
+)
+
+// makeOfflineRepo creates an offline repository with the given
+// package.yaml snaps (all in the "bar" namespace) and returns its path
+func (s *SnapTestSuite) makeOfflineRepo(c *C, packageYamls ...string) string {
+	repoDir := c.MkDir()
+
+	index := "snaps:\n"
+	for _, packageYaml := range packageYamls {
+		snapFile := makeTestSnapPackage(c, packageYaml)
+		target := filepath.Join(repoDir, filepath.Base(snapFile))
+		c.Assert(os.Rename(snapFile, target), IsNil)
+
+		m, err := parsePackageYamlData([]byte(packageYaml))
+		c.Assert(err, IsNil)
+		sha512, err := helpers.Sha512sum(target)
+		c.Assert(err, IsNil)
+		index += fmt.Sprintf(" - name: %s\n   namespace: bar\n   version: %s\n   file: %s\n   sha512: %s\n", m.Name, m.Version, filepath.Base(target), sha512)
+	}
+	c.Assert(ioutil.WriteFile(filepath.Join(repoDir, offlineIndexName), []byte(index), 0644), IsNil)
+
+	return repoDir
+}
+
+func (s *SnapTestSuite) TestOfflineRepositoryInvalidPath(c *C) {
+	c.Assert(NewOfflineSnapRepository("/no/such/path"), IsNil)
+}
+
+func (s *SnapTestSuite) TestOfflineRepositoryDetails(c *C) {
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n", "name: foo\nversion: 2.0\nvendor: Foo <foo@example.com>\n")
+	repo := NewOfflineSnapRepository(repoDir)
+	c.Assert(repo, NotNil)
+
+	parts, err := repo.Details("foo")
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 1)
+	c.Check(parts[0].Name(), Equals, "foo")
+	c.Check(parts[0].Namespace(), Equals, "bar")
+	c.Check(parts[0].Version(), Equals, "2.0")
+	c.Check(parts[0].DownloadSize() > 0, Equals, true)
+
+	parts, err = repo.Details("foo.bar")
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 1)
+
+	_, err = repo.Details("foo.baz")
+	c.Assert(err, Equals, ErrPackageNotFound)
+}
+
+func (s *SnapTestSuite) TestOfflineRepositoryDetailsChannel(c *C) {
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	repo := NewOfflineSnapRepository(repoDir)
+
+	parts, err := repo.Details("foo")
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 1)
+	c.Check(parts[0].Channel(), Equals, defaultSnapChannel)
+
+	c.Assert(setSnapChannel("foo", "beta"), IsNil)
+	c.Check(parts[0].Channel(), Equals, "beta")
+}
+
+func (s *SnapTestSuite) TestOfflineRepositoryInstall(c *C) {
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	repo := NewOfflineSnapRepository(repoDir)
+	parts, err := repo.Details("foo")
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 1)
+
+	name, err := parts[0].Install(&MockProgressMeter{}, 0)
+	c.Assert(err, IsNil)
+	c.Check(name, Equals, "foo")
+
+	installed := ActiveSnapByName("foo")
+	c.Assert(installed, NotNil)
+	c.Check(installed.Namespace(), Equals, "bar")
+	c.Check(helpers.FileExists(filepath.Join(snapAppsDir, "foo.bar", "1.0")), Equals, true)
+}
+
+func (s *SnapTestSuite) TestOfflineRepositoryInstallHashMismatch(c *C) {
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	index, err := ioutil.ReadFile(filepath.Join(repoDir, offlineIndexName))
+	c.Assert(err, IsNil)
+	idx, err := parseOfflineIndex(index)
+	c.Assert(err, IsNil)
+
+	part := NewOfflineSnapPart(idx.Snaps[0], repoDir)
+	part.pkg.Sha512 = "invalid-sha512"
+	_, err = part.Install(nil, 0)
+	c.Assert(err, FitsTypeOf, &ErrDownloadHashMismatch{})
+	c.Check(ActiveSnapByName("foo"), IsNil)
+}
+
+func (s *SnapTestSuite) TestOfflineSnapPartFetchCopies(c *C) {
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	parts, err := NewOfflineSnapRepository(repoDir).Details("foo")
+	c.Assert(err, IsNil)
+	part := parts[0].(*OfflineSnapPart)
+	orig, err := ioutil.ReadFile(part.snapFile())
+	c.Assert(err, IsNil)
+
+	snapFile, err := part.fetch(nil)
+	c.Assert(err, IsNil)
+	defer os.Remove(snapFile)
+	c.Check(snapFile, Not(Equals), part.snapFile())
+
+	// a later change of the file in the repository does not change the
+	// checked copy
+	c.Assert(ioutil.WriteFile(part.snapFile(), []byte("evil"), 0644), IsNil)
+	content, err := ioutil.ReadFile(snapFile)
+	c.Assert(err, IsNil)
+	c.Check(content, DeepEquals, orig)
+}
+
+func (s *SnapTestSuite) TestOfflineRepositoryUpdates(c *C) {
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	repo := NewOfflineSnapRepository(repoDir)
+	parts, err := repo.Details("foo")
+	c.Assert(err, IsNil)
+	_, err = parts[0].Install(nil, 0)
+	c.Assert(err, IsNil)
+
+	// nothing newer
+	updates, err := repo.Updates()
+	c.Assert(err, IsNil)
+	c.Check(updates, HasLen, 0)
+
+	newDir := s.makeOfflineRepo(c, "name: foo\nversion: 2.0\nvendor: Foo <foo@example.com>\n", "name: not-installed\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	updates, err = NewOfflineSnapRepository(newDir).Updates()
+	c.Assert(err, IsNil)
+	c.Assert(updates, HasLen, 1)
+	c.Check(updates[0].Name(), Equals, "foo")
+	c.Check(updates[0].Version(), Equals, "2.0")
+}
+
+func (s *SnapTestSuite) TestOfflineRepositorySearch(c *C) {
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n", "name: bar\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	repo := NewOfflineSnapRepository(repoDir)
+
+	results, err := repo.Search("fo")
+	c.Assert(err, IsNil)
+	c.Assert(results, HasLen, 1)
+	c.Assert(results["foo"], NotNil)
+	c.Check(results["foo"].Parts[0].Version(), Equals, "1.0")
+}
+
+func (s *SnapTestSuite) TestOfflineRepositoryWithoutIndex(c *C) {
+	repo := NewOfflineSnapRepository(c.MkDir())
+	c.Assert(repo, NotNil)
+
+	_, err := repo.Details("foo")
+	c.Check(err, Equals, ErrPackageNotFound)
+	updates, err := repo.Updates()
+	c.Check(err, IsNil)
+	c.Check(updates, HasLen, 0)
+}
+
+func (s *SnapTestSuite) TestMetaRepositoryUpdatesNewestOnly(c *C) {
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	parts, err := NewOfflineSnapRepository(repoDir).Details("foo")
+	c.Assert(err, IsNil)
+	_, err = parts[0].Install(nil, 0)
+	c.Assert(err, IsNil)
+
+	// the same update in a mirror and a newer one on a usb stick
+	mirrorDir := s.makeOfflineRepo(c, "name: foo\nversion: 2.0\nvendor: Foo <foo@example.com>\n")
+	usbDir := s.makeOfflineRepo(c, "name: foo\nversion: 3.0\nvendor: Foo <foo@example.com>\n")
+	m := &MetaRepository{all: []Repository{
+		NewOfflineSnapRepository(mirrorDir),
+		NewOfflineSnapRepository(usbDir),
+		NewOfflineSnapRepository(mirrorDir),
+	}}
+
+	updates, err := m.Updates()
+	c.Assert(err, IsNil)
+	c.Assert(updates, HasLen, 1)
+	c.Check(updates[0].Version(), Equals, "3.0")
+}
+
+func (s *SnapTestSuite) TestOfflineRepositoryInvalidIndex(c *C) {
+	_, err := parseOfflineIndex([]byte("snaps:\n - name: foo\n   version: 1.0\n   file: foo.snap\n"))
+	c.Assert(err, Equals, ErrInvalidOfflineIndex)
+
+	// apps need a namespace, frameworks do not
+	_, err = parseOfflineIndex([]byte("snaps:\n - name: foo\n   version: 1.0\n   file: foo.snap\n   sha512: abc\n"))
+	c.Assert(err, Equals, ErrInvalidOfflineIndex)
+	_, err = parseOfflineIndex([]byte("snaps:\n - name: foo\n   type: framework\n   version: 1.0\n   file: foo.snap\n   sha512: abc\n"))
+	c.Assert(err, IsNil)
+}
+
+func (s *SnapTestSuite) TestOfflineRepositoryInstallViaSources(c *C) {
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	s.writeSourcesFile(c, "10-usb.yaml", "sources:\n - name: usb\n   type: offline\n   uri: "+repoDir+"\n")
+
+	name, err := Install("foo", 0, nil)
+	c.Assert(err, IsNil)
+	c.Check(name, Equals, "foo")
+
+	installed := ActiveSnapByName("foo")
+	c.Assert(installed, NotNil)
+	c.Check(installed.Namespace(), Equals, "bar")
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"time"
+)
+
+// PartInfo is the structured representation of a Part that is shown by
+// the commands that support --format=json|yaml. The fields are part of
+// the documented output of snappy (see docs/output-formats.md), only
+// add new fields and never change or remove existing ones.
+type PartInfo struct {
+	Name          string    `json:"name" yaml:"name"`
+	Version       string    `json:"version" yaml:"version"`
+	Namespace     string    `json:"namespace" yaml:"namespace"`
+	Channel       string    `json:"channel" yaml:"channel"`
+	Type          SnapType  `json:"type" yaml:"type"`
+	Description   string    `json:"description" yaml:"description"`
+	InstalledSize int64     `json:"installed-size" yaml:"installed-size"`
+	DownloadSize  int64     `json:"download-size" yaml:"download-size"`
+	Installed     bool      `json:"installed" yaml:"installed"`
+	Active        bool      `json:"active" yaml:"active"`
+	NeedsReboot   bool      `json:"needs-reboot" yaml:"needs-reboot"`
+	Date          time.Time `json:"date" yaml:"date"`
+}
+
+// NewPartInfo returns the PartInfo of the given part
+func NewPartInfo(part Part) PartInfo {
+	return PartInfo{
+		Name:          part.Name(),
+		Version:       part.Version(),
+		Namespace:     part.Namespace(),
+		Channel:       part.Channel(),
+		Type:          part.Type(),
+		Description:   part.Description(),
+		InstalledSize: part.InstalledSize(),
+		DownloadSize:  part.DownloadSize(),
+		Installed:     part.IsInstalled(),
+		Active:        part.IsActive(),
+		NeedsReboot:   part.NeedsReboot(),
+		Date:          part.Date(),
+	}
+}
+
+// NewPartInfos returns the PartInfo of each of the given parts
+func NewPartInfos(parts []Part) []PartInfo {
+	infos := make([]PartInfo, 0, len(parts))
+	for _, part := range parts {
+		infos = append(infos, NewPartInfo(part))
+	}
+
+	return infos
+}
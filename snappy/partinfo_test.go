@@ -0,0 +1,50 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"encoding/json"
+
+	. "launchpad.net/gocheck"
+)
+
+func (s *SnapTestSuite) TestNewPartInfo(c *C) {
+	s.installTestVersions(c, "1.0")
+
+	info := NewPartInfo(ActiveSnapByName("foo"))
+	c.Check(info.Name, Equals, "foo")
+	c.Check(info.Version, Equals, "1.0")
+	c.Check(info.Namespace, Equals, "bar")
+	c.Check(info.Channel, Equals, defaultSnapChannel)
+	c.Check(info.Type, Equals, SnapTypeApp)
+	c.Check(info.Installed, Equals, true)
+	c.Check(info.Active, Equals, true)
+	c.Check(info.NeedsReboot, Equals, false)
+	c.Check(info.InstalledSize > 0, Equals, true)
+
+	// the json keys are part of the documented output
+	data, err := json.Marshal(info)
+	c.Assert(err, IsNil)
+	var fields map[string]interface{}
+	c.Assert(json.Unmarshal(data, &fields), IsNil)
+	for _, key := range []string{"name", "version", "namespace", "channel", "type", "description", "installed-size", "download-size", "installed", "active", "needs-reboot", "date"} {
+		_, ok := fields[key]
+		c.Check(ok, Equals, true, Commentf(key))
+	}
+	c.Check(fields, HasLen, 12)
+}
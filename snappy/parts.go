@@ -123,57 +123,22 @@ type MetaRepository struct {
 	all []Repository
 }
 
-// NewMetaStoreRepository returns a MetaRepository of stores
+// NewMetaStoreRepository returns a MetaRepository of stores (including
+// offline ones)
 func NewMetaStoreRepository() *MetaRepository {
-	m := new(MetaRepository)
-	m.all = []Repository{}
-
-	if repo := NewUbuntuStoreSnapRepository(); repo != nil {
-		m.all = append(m.all, repo)
-	}
-
-	return m
+	return newMetaRepositoryForSources(SourceTypeStore, SourceTypeOffline)
 }
 
-// NewMetaLocalRepository returns a MetaRepository of stores
+// NewMetaLocalRepository returns a MetaRepository of the local
+// repositories
 func NewMetaLocalRepository() *MetaRepository {
-	m := new(MetaRepository)
-	m.all = []Repository{}
-
-	if repo := NewSystemImageRepository(); repo != nil {
-		m.all = append(m.all, repo)
-	}
-	if repo := NewLocalSnapRepository(snapAppsDir); repo != nil {
-		m.all = append(m.all, repo)
-	}
-	if repo := NewLocalSnapRepository(snapOemDir); repo != nil {
-		m.all = append(m.all, repo)
-	}
-
-	return m
+	return newMetaRepositoryForSources(SourceTypeSystemImage, SourceTypeLocal)
 }
 
-// NewMetaRepository returns a new MetaRepository
+// NewMetaRepository returns a new MetaRepository of all the configured
+// sources (see Sources)
 func NewMetaRepository() *MetaRepository {
-	// FIXME: make this a configuration file
-
-	m := new(MetaRepository)
-	m.all = []Repository{}
-	// its ok if repos fail if e.g. no dbus is available
-	if repo := NewSystemImageRepository(); repo != nil {
-		m.all = append(m.all, repo)
-	}
-	if repo := NewUbuntuStoreSnapRepository(); repo != nil {
-		m.all = append(m.all, repo)
-	}
-	if repo := NewLocalSnapRepository(snapAppsDir); repo != nil {
-		m.all = append(m.all, repo)
-	}
-	if repo := NewLocalSnapRepository(snapOemDir); repo != nil {
-		m.all = append(m.all, repo)
-	}
-
-	return m
+	return newMetaRepositoryForSources(SourceTypeSystemImage, SourceTypeStore, SourceTypeOffline, SourceTypeLocal)
 }
 
 // Installed returns all installed parts
@@ -189,20 +154,43 @@ func (m *MetaRepository) Installed() (parts []Part, err error) {
 	return parts, err
 }
 
-// Updates returns all updatable parts
+// Updates returns all updatable parts, held parts are left out. If more
+// than one repository has an update for a part only the newest one is
+// returned.
 func (m *MetaRepository) Updates() (parts []Part, err error) {
 	for _, r := range m.all {
 		updates, err := r.Updates()
 		if err != nil {
-			return parts, err
+			return newestParts(parts), err
 		}
-		parts = append(parts, updates...)
+		parts = append(parts, withoutHeldParts(updates)...)
 	}
 
-	return parts, err
+	return newestParts(parts), err
+}
+
+// newestParts returns the newest version of each part (by name and
+// namespace) of the given parts, in the order they first appear
+func newestParts(parts []Part) []Part {
+	newest := make(map[string]int)
+	var result []Part
+	for _, part := range parts {
+		key := part.Name() + "." + part.Namespace()
+		i, ok := newest[key]
+		switch {
+		case !ok:
+			newest[key] = len(result)
+			result = append(result, part)
+		case VersionCompare(result[i].Version(), part.Version()) < 0:
+			result[i] = part
+		}
+	}
+
+	return result
 }
 
-// Details returns details for the given snap name
+// Details returns details for the given snap name, ErrPackageNotFound
+// if no repository has it
 func (m *MetaRepository) Details(snapyName string) (parts []Part, err error) {
 	for _, r := range m.all {
 		results, err := r.Details(snapyName)
@@ -219,7 +207,11 @@ func (m *MetaRepository) Details(snapyName string) (parts []Part, err error) {
 		parts = append(parts, results...)
 	}
 
-	return parts, err
+	if len(parts) == 0 {
+		return nil, ErrPackageNotFound
+	}
+
+	return parts, nil
 }
 
 // ActiveSnapsByType returns all installed snaps with the given type
@@ -317,7 +309,7 @@ func FindSnapsByNameAndVersion(needle, version string, haystack []Part) []Part {
 
 // MakeSnapActiveByNameAndVersion makes the given snap version the active
 // version
-func makeSnapActiveByNameAndVersion(pkg, ver string) error {
+func makeSnapActiveByNameAndVersion(pkg, ver string, meter progress.Meter) error {
 	m := NewMetaRepository()
 	installed, err := m.Installed()
 	if err != nil {
@@ -329,7 +321,7 @@ func makeSnapActiveByNameAndVersion(pkg, ver string) error {
 	case 0:
 		return fmt.Errorf("Can not find %s with version %s", pkg, ver)
 	case 1:
-		return parts[0].SetActive(nil)
+		return parts[0].SetActive(meter)
 	default:
 		return fmt.Errorf("More than one %s with version %s", pkg, ver)
 	}
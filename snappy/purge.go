@@ -45,9 +45,36 @@ func Purge(partSpec string, flags PurgeFlags, meter progress.Meter) error {
 
 	purgeActive := flags&DoPurgeActive != 0
 
+	active := activeDataDirParts(datadirs)
+	if len(active) > 0 && !purgeActive {
+		return ErrStillActive
+	}
+
+	deactivateParts(active, "Purge", meter)
+	defer reactivateParts(active, meter)
+
+	for _, datadir := range datadirs {
+		if err := remove(datadir.Dirname(), datadir.Version); err != nil {
+			e = err
+			meter.Notify(fmt.Sprintf("unable to purge %s version %s: %s", datadir.Dirname(), datadir.Version, err.Error()))
+		}
+	}
+
+	return e
+}
+
+// activeDataDirParts returns the active parts the given data dirs belong
+// to (each part once, even if it has home and system data)
+func activeDataDirParts(datadirs []SnapDataDir) []*SnapPart {
 	var active []*SnapPart
+	seen := make(map[string]bool)
 
 	for _, datadir := range datadirs {
+		if seen[datadir.Dirname()+"/"+datadir.Version] {
+			continue
+		}
+		seen[datadir.Dirname()+"/"+datadir.Version] = true
+
 		yamlPath := filepath.Join(snapAppsDir, datadir.Dirname(), datadir.Version, "meta", "package.yaml")
 		part, err := NewInstalledSnapPart(yamlPath, datadir.Namespace)
 		if err != nil {
@@ -55,29 +82,31 @@ func Purge(partSpec string, flags PurgeFlags, meter progress.Meter) error {
 			continue
 		}
 		if part.IsActive() {
-			if !purgeActive {
-				return ErrStillActive
-			}
 			active = append(active, part)
 		}
 	}
 
+	return active
+}
+
+// deactivateParts deactivates the given parts (which stops their
+// services) so that their data can be worked on. The ones that can not
+// be deactivated are set to nil so that reactivateParts skips them, the
+// operation continues anyway.
+func deactivateParts(active []*SnapPart, operation string, meter progress.Meter) {
 	for i, pkg := range active {
 		err := unsetActiveClick(pkg.basedir, false, meter)
 		if err != nil {
 			meter.Notify(fmt.Sprintf("Unable to deactivate %s: %s", pkg.Name(), err))
-			meter.Notify("Purge continues.")
+			meter.Notify(fmt.Sprintf("%s continues.", operation))
 			active[i] = nil // don't reactivate
 		}
 	}
+}
 
-	for _, datadir := range datadirs {
-		if err := remove(datadir.Dirname(), datadir.Version); err != nil {
-			e = err
-			meter.Notify(fmt.Sprintf("unable to purge %s version %s: %s", datadir.Dirname(), datadir.Version, err.Error()))
-		}
-	}
-
+// reactivateParts activates the parts deactivated by deactivateParts
+// again
+func reactivateParts(active []*SnapPart, meter progress.Meter) {
 	for _, pkg := range active {
 		if pkg == nil {
 			continue
@@ -86,6 +115,4 @@ func Purge(partSpec string, flags PurgeFlags, meter progress.Meter) error {
 			meter.Notify(fmt.Sprintf("Unable to activate %s: %s", pkg.Name(), err))
 		}
 	}
-
-	return e
 }
@@ -18,7 +18,10 @@
 package snappy
 
 import (
+	"time"
+
 	. "launchpad.net/gocheck"
+	"launchpad.net/snappy/coreconfig"
 	"launchpad.net/snappy/progress"
 )
 
@@ -81,3 +84,29 @@ func (s *SnapTestSuite) TestSnapRemoveGC(c *C) {
 	c.Assert(err, IsNil)
 	c.Check(installed, HasLen, 0)
 }
+
+func (s *SnapTestSuite) TestSnapRemoveLastVersionForgetsState(c *C) {
+	makeTwoTestSnaps(c, SnapTypeApp)
+	c.Assert(setSnapChannel("foo", "edge"), IsNil)
+	c.Assert(holdSnap("foo", time.Time{}), IsNil)
+	c.Assert(snapRetentionStore.write(map[string]coreconfig.GCConfig{"foo": {KeepRevisions: 3}}), IsNil)
+	c.Assert(snapLimitsStore.write(map[string]ResourceLimits{"foo": {TasksMax: 10}}), IsNil)
+	c.Assert(setServiceDisabled("foo", "svc", true), IsNil)
+
+	// another version is left, nothing is forgotten
+	c.Assert(Remove("foo=1.0", 0, &progress.NullProgress{}), IsNil)
+	c.Check(snapChannel("foo"), Equals, "edge")
+	c.Check(IsHeld("foo"), Equals, true)
+	c.Check(isServiceDisabled("foo", "svc"), Equals, true)
+
+	c.Assert(Remove("foo", 0, &progress.NullProgress{}), IsNil)
+	c.Check(snapChannel("foo"), Equals, defaultSnapChannel)
+	c.Check(IsHeld("foo"), Equals, false)
+	c.Check(isServiceDisabled("foo", "svc"), Equals, false)
+	retention, err := readSnapRetention()
+	c.Assert(err, IsNil)
+	c.Check(retention, HasLen, 0)
+	limits, err := readSnapLimits()
+	c.Assert(err, IsNil)
+	c.Check(limits, HasLen, 0)
+}
@@ -0,0 +1,337 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"launchpad.net/snappy/coreconfig"
+	"launchpad.net/snappy/helpers"
+	"launchpad.net/snappy/progress"
+)
+
+// RetentionPolicy decides which old versions of a snap garbage
+// collection keeps
+type RetentionPolicy struct {
+	// KeepRevisions is the number of versions that are kept installed,
+	// including the active one
+	KeepRevisions int
+	// KeepDays keeps versions that are younger than the given number
+	// of days (0 to not keep versions by age)
+	KeepDays int
+	// MaxDiskUsage is the number of bytes the versions of a snap and
+	// their data may use (0 for no limit)
+	MaxDiskUsage int64
+}
+
+// defaultRetentionPolicy keeps the active and the previous version
+var defaultRetentionPolicy = RetentionPolicy{KeepRevisions: 2}
+
+// getGCSettings returns the global garbage collection settings, useful
+// to override for testing
+var getGCSettings = coreconfig.GCSettings
+
+// merge overrides the policy with the given settings
+func (p *RetentionPolicy) merge(gc *coreconfig.GCConfig) error {
+	size, err := gc.MaxDiskUsageBytes()
+	if err != nil {
+		return err
+	}
+
+	if gc.KeepRevisions > 0 {
+		p.KeepRevisions = gc.KeepRevisions
+	}
+	if gc.KeepDays > 0 {
+		p.KeepDays = gc.KeepDays
+	}
+	if size > 0 {
+		p.MaxDiskUsage = size
+	}
+
+	return nil
+}
+
+// snapRetentionStore has the retention settings of the snaps
+var snapRetentionStore = newSnapStore(&snapRetentionFile, func() interface{} { return &map[string]coreconfig.GCConfig{} })
+
+// readSnapRetention returns the retention settings by snap name
+func readSnapRetention() (map[string]coreconfig.GCConfig, error) {
+	retention := make(map[string]coreconfig.GCConfig)
+	if err := snapRetentionStore.read(&retention); err != nil {
+		return nil, err
+	}
+
+	return retention, nil
+}
+
+// SnapRetentionPolicy returns the retention policy of the given snap,
+// that is the default policy overridden by the settings of the
+// ubuntu-core config and then by the settings of the snap
+func SnapRetentionPolicy(name string) (RetentionPolicy, error) {
+	name, _ = splitNamespace(name)
+	policy := defaultRetentionPolicy
+
+	global, err := getGCSettings()
+	if err != nil {
+		return policy, err
+	}
+	if err := policy.merge(global); err != nil {
+		return policy, err
+	}
+
+	retention, err := readSnapRetention()
+	if err != nil {
+		return policy, err
+	}
+	if gc, ok := retention[name]; ok {
+		if err := policy.merge(&gc); err != nil {
+			return policy, err
+		}
+	}
+
+	return policy, nil
+}
+
+// setSnapRetention changes the retention settings of the given snap
+// with the given function
+func setSnapRetention(pkgname string, change func(gc *coreconfig.GCConfig) error) error {
+	name, _ := splitNamespace(pkgname)
+	if ActiveSnapByName(name) == nil {
+		return ErrNotInstalled
+	}
+
+	retention, err := readSnapRetention()
+	if err != nil {
+		return err
+	}
+
+	gc := retention[name]
+	if err := change(&gc); err != nil {
+		return err
+	}
+	if err := gc.Validate(); err != nil {
+		return err
+	}
+
+	if gc == (coreconfig.GCConfig{}) {
+		delete(retention, name)
+	} else {
+		retention[name] = gc
+	}
+
+	return snapRetentionStore.write(retention)
+}
+
+// setSnapKeepRevisionsProperty is the "keep-revisions" property of
+// SetProperty
+func setSnapKeepRevisionsProperty(pkgname, value string) error {
+	return setSnapRetention(pkgname, func(gc *coreconfig.GCConfig) (err error) {
+		gc.KeepRevisions, err = parseCountProperty(value)
+		return err
+	})
+}
+
+// setSnapKeepDaysProperty is the "keep-days" property of SetProperty
+func setSnapKeepDaysProperty(pkgname, value string) error {
+	return setSnapRetention(pkgname, func(gc *coreconfig.GCConfig) (err error) {
+		gc.KeepDays, err = parseCountProperty(value)
+		return err
+	})
+}
+
+// setSnapMaxDiskUsageProperty is the "max-disk-usage" property of
+// SetProperty
+func setSnapMaxDiskUsageProperty(pkgname, value string) error {
+	return setSnapRetention(pkgname, func(gc *coreconfig.GCConfig) error {
+		gc.MaxDiskUsage = value
+		return nil
+	})
+}
+
+// GCPlan is what garbage collection removes for a snap
+type GCPlan struct {
+	// Parts are the installed versions that are removed
+	Parts []Part
+	// DataDirs are the data directories of versions that were removed
+	// before, they are purged
+	DataDirs []string
+	// Size is the number of bytes that are reclaimed
+	Size int64
+
+	purge map[string][]string
+}
+
+// PlanGarbageCollection returns what garbage collection removes for the
+// snap with the given name according to its retention policy.
+//
+// The active version and newer versions are always kept, as are all
+// versions if one of them needs a reboot. Older versions are kept if
+// they are one of the KeepRevisions newest ones or younger than
+// KeepDays, and then the oldest ones are removed until the snap fits in
+// MaxDiskUsage. The data of removed versions is kept until the next
+// garbage collection.
+func PlanGarbageCollection(name string) (*GCPlan, error) {
+	plan := &GCPlan{purge: make(map[string][]string)}
+
+	m := NewMetaRepository()
+	installed, err := m.Installed()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := BySnapVersion(FindSnapsByName(name, installed))
+	sort.Sort(parts)
+	active := -1 // active is the index of the active part in parts (-1 if no active part)
+
+	for i, part := range parts {
+		if part.IsActive() {
+			if active > -1 {
+				return nil, ErrGarbageCollectImpossible("more than one active (should not happen).")
+			}
+			active = i
+		}
+		if part.NeedsReboot() {
+			return plan, nil // don't do gc on parts that need reboot.
+		}
+	}
+
+	if active < 0 {
+		return plan, nil
+	}
+
+	policy, err := SnapRetentionPolicy(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// the versions that are kept, the active one first and then from
+	// the newest to the oldest one
+	kept := []Part{parts[active]}
+	for i := active - 1; i >= 0; i-- {
+		part := parts[i]
+		young := policy.KeepDays > 0 && time.Since(part.Date()) < time.Duration(policy.KeepDays)*24*time.Hour
+		if len(kept) < policy.KeepRevisions || young {
+			kept = append(kept, part)
+		} else {
+			plan.Parts = append(plan.Parts, part)
+		}
+	}
+
+	if policy.MaxDiskUsage > 0 {
+		usage := int64(0)
+		for _, part := range parts[active+1:] {
+			usage += partDiskUsage(part)
+		}
+		for _, part := range kept {
+			usage += partDiskUsage(part)
+		}
+		for len(kept) > 1 && usage > policy.MaxDiskUsage {
+			oldest := kept[len(kept)-1]
+			kept = kept[:len(kept)-1]
+			usage -= partDiskUsage(oldest)
+			plan.Parts = append(plan.Parts, oldest)
+		}
+	}
+
+	for _, part := range plan.Parts {
+		if size := part.InstalledSize(); size > 0 {
+			plan.Size += size
+		}
+	}
+
+	// purge the data of versions that are no longer installed
+	fullName := Dirname(parts[active])
+	for _, dd := range DataDirs(fullName) {
+		if _, ok := plan.purge[dd.Version]; ok {
+			continue
+		}
+		if len(FindSnapsByNameAndVersion(fullName, dd.Version, installed)) > 0 {
+			continue
+		}
+
+		dirs, err := snapDataDirs(fullName, dd.Version)
+		if err != nil {
+			return nil, err
+		}
+		for _, dir := range dirs {
+			if !helpers.FileExists(dir) {
+				continue
+			}
+			plan.DataDirs = append(plan.DataDirs, dir)
+			plan.Size += pathSize(dir)
+		}
+		plan.purge[dd.Version] = dirs
+	}
+
+	return plan, nil
+}
+
+// Run removes the versions and purges the data of the plan
+func (plan *GCPlan) Run(meter progress.Meter) error {
+	for _, part := range plan.Parts {
+		if err := part.Uninstall(meter); err != nil {
+			return ErrGarbageCollectImpossible(err.Error())
+		}
+	}
+
+	for _, dirs := range plan.purge {
+		for _, dir := range dirs {
+			if err := os.RemoveAll(dir); err != nil {
+				return ErrGarbageCollectImpossible(err.Error())
+			}
+			os.Remove(filepath.Dir(dir))
+		}
+	}
+
+	return nil
+}
+
+// partDiskUsage returns the bytes used by the given version of a snap
+// and its data
+func partDiskUsage(part Part) int64 {
+	usage := int64(0)
+	if size := part.InstalledSize(); size > 0 {
+		usage += size
+	}
+
+	dirs, err := snapDataDirs(Dirname(part), part.Version())
+	if err != nil {
+		return usage
+	}
+	for _, dir := range dirs {
+		usage += pathSize(dir)
+	}
+
+	return usage
+}
+
+// pathSize returns the size of the files in the given directory
+func pathSize(path string) int64 {
+	size := int64(0)
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size
+}
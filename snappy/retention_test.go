@@ -0,0 +1,127 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"os"
+	"path/filepath"
+
+	"launchpad.net/snappy/coreconfig"
+	"launchpad.net/snappy/helpers"
+
+	. "launchpad.net/gocheck"
+)
+
+// planVersions returns the versions the plan removes
+func planVersions(plan *GCPlan) []string {
+	var versions []string
+	for _, part := range plan.Parts {
+		versions = append(versions, part.Version())
+	}
+
+	return versions
+}
+
+func (s *SnapTestSuite) TestGarbageCollectDefaultPolicy(c *C) {
+	s.installTestVersions(c, "1.0", "2.0", "3.0")
+
+	plan, err := PlanGarbageCollection("foo")
+	c.Assert(err, IsNil)
+	c.Check(planVersions(plan), DeepEquals, []string{"1.0"})
+	c.Check(plan.DataDirs, HasLen, 0)
+	c.Check(plan.Size > 0, Equals, true)
+
+	c.Assert(GarbageCollect("foo", DoInstallGC), IsNil)
+	c.Check(helpers.FileExists(filepath.Join(snapAppsDir, "foo.bar", "1.0")), Equals, false)
+	c.Check(helpers.FileExists(filepath.Join(snapAppsDir, "foo.bar", "2.0")), Equals, true)
+
+	// the data of the removed version is purged the next time
+	dataDir := filepath.Join(snapDataDir, "foo.bar", "1.0")
+	c.Assert(os.MkdirAll(dataDir, 0755), IsNil)
+	plan, err = PlanGarbageCollection("foo")
+	c.Assert(err, IsNil)
+	c.Check(plan.Parts, HasLen, 0)
+	c.Check(plan.DataDirs, DeepEquals, []string{dataDir})
+
+	c.Assert(plan.Run(&MockProgressMeter{}), IsNil)
+	c.Check(helpers.FileExists(dataDir), Equals, false)
+}
+
+func (s *SnapTestSuite) TestGarbageCollectNoGC(c *C) {
+	s.installTestVersions(c, "1.0", "2.0", "3.0")
+
+	c.Assert(GarbageCollect("foo", 0), IsNil)
+	c.Check(helpers.FileExists(filepath.Join(snapAppsDir, "foo.bar", "1.0")), Equals, true)
+}
+
+func (s *SnapTestSuite) TestGarbageCollectGlobalPolicy(c *C) {
+	getGCSettings = func() (*coreconfig.GCConfig, error) {
+		return &coreconfig.GCConfig{KeepRevisions: 3}, nil
+	}
+	s.installTestVersions(c, "1.0", "2.0", "3.0", "4.0")
+
+	plan, err := PlanGarbageCollection("foo")
+	c.Assert(err, IsNil)
+	c.Check(planVersions(plan), DeepEquals, []string{"1.0"})
+
+	// the snap settings override the global ones
+	c.Assert(setSnapKeepRevisionsProperty("foo.bar", "1"), IsNil)
+	policy, err := SnapRetentionPolicy("foo")
+	c.Assert(err, IsNil)
+	c.Check(policy, Equals, RetentionPolicy{KeepRevisions: 1})
+
+	plan, err = PlanGarbageCollection("foo")
+	c.Assert(err, IsNil)
+	c.Check(planVersions(plan), DeepEquals, []string{"3.0", "2.0", "1.0"})
+
+	// and an empty value resets them
+	c.Assert(setSnapKeepRevisionsProperty("foo", ""), IsNil)
+	policy, err = SnapRetentionPolicy("foo")
+	c.Assert(err, IsNil)
+	c.Check(policy, Equals, RetentionPolicy{KeepRevisions: 3})
+}
+
+func (s *SnapTestSuite) TestGarbageCollectKeepDays(c *C) {
+	s.installTestVersions(c, "1.0", "2.0", "3.0")
+	c.Assert(setSnapKeepDaysProperty("foo", "7"), IsNil)
+
+	plan, err := PlanGarbageCollection("foo")
+	c.Assert(err, IsNil)
+	c.Check(plan.Parts, HasLen, 0)
+}
+
+func (s *SnapTestSuite) TestGarbageCollectMaxDiskUsage(c *C) {
+	s.installTestVersions(c, "1.0", "2.0", "3.0")
+	c.Assert(setSnapKeepDaysProperty("foo", "7"), IsNil)
+	c.Assert(setSnapMaxDiskUsageProperty("foo", "1K"), IsNil)
+
+	// the disk usage cap wins over the age, but the active version
+	// is always kept
+	plan, err := PlanGarbageCollection("foo")
+	c.Assert(err, IsNil)
+	c.Check(planVersions(plan), DeepEquals, []string{"1.0", "2.0"})
+}
+
+func (s *SnapTestSuite) TestSetRetentionPropertyInvalid(c *C) {
+	s.installTestVersions(c, "1.0")
+
+	c.Check(setSnapKeepRevisionsProperty("foo", "many"), NotNil)
+	c.Check(setSnapKeepDaysProperty("foo", "-1"), NotNil)
+	c.Check(setSnapMaxDiskUsageProperty("foo", "lots"), NotNil)
+	c.Check(setSnapKeepDaysProperty("no-such-snap", "1"), Equals, ErrNotInstalled)
+}
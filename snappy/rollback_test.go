@@ -26,7 +26,7 @@ func (s *SnapTestSuite) TestRollbackWithVersion(c *C) {
 	c.Assert(ActiveSnapByName("foo").Version(), Equals, "2.0")
 
 	// rollback with version
-	version, err := Rollback("foo", "1.0")
+	version, err := Rollback("foo", "1.0", nil)
 	c.Assert(err, IsNil)
 	c.Assert(version, Equals, "1.0")
 
@@ -38,7 +38,7 @@ func (s *SnapTestSuite) TestRollbackFindVersion(c *C) {
 	c.Assert(ActiveSnapByName("foo").Version(), Equals, "2.0")
 
 	// rollback without version
-	version, err := Rollback("foo", "")
+	version, err := Rollback("foo", "", nil)
 	c.Assert(err, IsNil)
 	c.Assert(version, Equals, "1.0")
 
@@ -17,11 +17,49 @@
 
 package snappy
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
-// Search searches all repositories with the given keywords in the args slice
+// searcher is a Repository that can be searched
+type searcher interface {
+	Search(searchTerm string) (SharedNames, error)
+}
+
+// Search searches all repositories with the given keywords in the args
+// slice. If some repositories can not be searched the results of the
+// others are returned along with an ErrSearchFailed.
 func Search(args []string) (SharedNames, error) {
-	m := NewUbuntuStoreSnapRepository()
+	results := make(SharedNames)
+	var errs []string
+
+	for _, r := range NewMetaStoreRepository().all {
+		s, ok := r.(searcher)
+		if !ok {
+			continue
+		}
+
+		found, err := s.Search(strings.Join(args, ","))
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", r.Description(), err))
+			continue
+		}
+
+		for name, sharedName := range found {
+			if _, ok := results[name]; !ok {
+				results[name] = new(SharedName)
+			}
+			results[name].Parts = append(results[name].Parts, sharedName.Parts...)
+			if results[name].Alias == nil {
+				results[name].Alias = sharedName.Alias
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return results, &ErrSearchFailed{errs: errs}
+	}
 
-	return m.Search(strings.Join(args, ","))
+	return results, nil
 }
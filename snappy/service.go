@@ -0,0 +1,310 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/systemd"
+)
+
+// ServiceStatus is the state of a service of an active snap
+type ServiceStatus struct {
+	Package     string    `json:"package" yaml:"package"`
+	Service     string    `json:"service" yaml:"service"`
+	Unit        string    `json:"unit" yaml:"unit"`
+	Enabled     bool      `json:"enabled" yaml:"enabled"`
+	ActiveState string    `json:"active-state" yaml:"active-state"`
+	SubState    string    `json:"sub-state" yaml:"sub-state"`
+	PID         int       `json:"pid,omitempty" yaml:"pid,omitempty"`
+	Since       time.Time `json:"since,omitempty" yaml:"since,omitempty"`
+}
+
+// snapService is a service of an active snap
+type snapService struct {
+	part    *SnapPart
+	service Service
+}
+
+// unit returns the name of the systemd unit of the service
+func (s *snapService) unit() string {
+	return filepath.Base(generateServiceFileName(s.part.m, s.service))
+}
+
+// activationUnit returns the name of the systemd unit that starts the
+// service, its socket if it is socket activated
+func (s *snapService) activationUnit() string {
+	return activationUnitName(s.part.m, s.service)
+}
+
+// snapServices returns the services of the active snaps for the given
+// "pkg[/service]" spec, all services of all active snaps if it is empty
+func snapServices(spec string) ([]*snapService, error) {
+	name, serviceName := spec, ""
+	if idx := strings.IndexRune(spec, '/'); idx >= 0 {
+		name, serviceName = spec[:idx], spec[idx+1:]
+	}
+
+	var parts []Part
+	if name == "" {
+		var err error
+		parts, err = ActiveSnapsByType(SnapTypeApp, SnapTypeFramework)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		part := ActiveSnapByName(name)
+		if part == nil {
+			return nil, ErrNotInstalled
+		}
+		parts = []Part{part}
+	}
+
+	var services []*snapService
+	for _, part := range parts {
+		snapPart, ok := part.(*SnapPart)
+		if !ok {
+			continue
+		}
+		for _, service := range snapPart.Services() {
+			if serviceName != "" && service.Name != serviceName {
+				continue
+			}
+			services = append(services, &snapService{part: snapPart, service: service})
+		}
+	}
+
+	if len(services) == 0 && name != "" {
+		return nil, &ErrServiceNotFound{pkg: name, service: serviceName}
+	}
+
+	return services, nil
+}
+
+// ServicesStatus returns the state of the services of the active snaps
+// for the given "pkg[/service]" spec, of all services if it is empty
+func ServicesStatus(spec string) ([]*ServiceStatus, error) {
+	services, err := snapServices(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	sysd := systemd.New(globalRootDir, &progress.NullProgress{})
+	statuses := make([]*ServiceStatus, 0, len(services))
+	for _, svc := range services {
+		st, err := sysd.Status(svc.unit())
+		if err != nil {
+			return nil, err
+		}
+		// socket activated services are enabled by their socket
+		if unit := svc.activationUnit(); unit != svc.unit() {
+			activation, err := sysd.Status(unit)
+			if err != nil {
+				return nil, err
+			}
+			st.Enabled = activation.Enabled
+		}
+		statuses = append(statuses, &ServiceStatus{
+			Package:     svc.part.Name(),
+			Service:     svc.service.Name,
+			Unit:        st.ServiceName,
+			Enabled:     st.Enabled,
+			ActiveState: st.ActiveState,
+			SubState:    st.SubState,
+			PID:         st.MainPID,
+			Since:       st.ActiveSince,
+		})
+	}
+
+	return statuses, nil
+}
+
+// StartServices starts the services for the given "pkg[/service]" spec,
+// socket activated services are started when their socket is connected
+// to
+func StartServices(spec string, meter progress.Meter) error {
+	return forEachService(spec, meter, func(sysd systemd.Systemd, svc *snapService) error {
+		return sysd.Start(svc.activationUnit())
+	})
+}
+
+// StopServices stops the services for the given "pkg[/service]" spec
+// and waits for them to stop, and the sockets of the socket activated
+// ones
+func StopServices(spec string, meter progress.Meter) error {
+	return forEachService(spec, meter, func(sysd systemd.Systemd, svc *snapService) error {
+		timeout := time.Duration(svc.service.StopTimeout)
+		if unit := svc.activationUnit(); unit != svc.unit() {
+			if err := sysd.Stop(unit, timeout); err != nil {
+				return err
+			}
+		}
+		return sysd.Stop(svc.unit(), timeout)
+	})
+}
+
+// RestartServices restarts the services for the given "pkg[/service]"
+// spec
+func RestartServices(spec string, meter progress.Meter) error {
+	return forEachService(spec, meter, func(sysd systemd.Systemd, svc *snapService) error {
+		return sysd.Restart(svc.unit(), time.Duration(svc.service.StopTimeout))
+	})
+}
+
+// EnableServices makes the services for the given "pkg[/service]" spec
+// start on boot, also after the package was updated
+func EnableServices(spec string, meter progress.Meter) error {
+	return forEachService(spec, meter, func(sysd systemd.Systemd, svc *snapService) error {
+		if err := setServiceDisabled(svc.part.Name(), svc.service.Name, false); err != nil {
+			return err
+		}
+		return sysd.Enable(svc.activationUnit())
+	})
+}
+
+// DisableServices makes the services for the given "pkg[/service]" spec
+// not start on boot, nor when the package is updated
+func DisableServices(spec string, meter progress.Meter) error {
+	return forEachService(spec, meter, func(sysd systemd.Systemd, svc *snapService) error {
+		if err := setServiceDisabled(svc.part.Name(), svc.service.Name, true); err != nil {
+			return err
+		}
+		return sysd.Disable(svc.activationUnit())
+	})
+}
+
+// forEachService calls f for each of the services for the given
+// "pkg[/service]" spec
+func forEachService(spec string, meter progress.Meter, f func(sysd systemd.Systemd, svc *snapService) error) error {
+	services, err := snapServices(spec)
+	if err != nil {
+		return err
+	}
+
+	sysd := systemd.New(globalRootDir, meter)
+	for _, svc := range services {
+		if err := f(sysd, svc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ServiceLog is a message of a service of an active snap
+type ServiceLog struct {
+	Time time.Time
+	// Service is "pkg/service"
+	Service string
+	Message string
+}
+
+// ServiceLogs calls f with each message in the journal of the services
+// for the given "pkg[/service]" spec, in the order they were logged
+func ServiceLogs(spec string, opts *systemd.LogOptions, f func(log *ServiceLog)) error {
+	services, err := snapServices(spec)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]string, len(services))
+	units := make([]string, 0, len(services))
+	for _, svc := range services {
+		unit := svc.unit()
+		names[unit] = svc.part.Name() + "/" + svc.service.Name
+		units = append(units, unit)
+	}
+
+	return systemd.Logs(units, opts, func(log *systemd.Log) {
+		f(&ServiceLog{
+			Time:    log.Time,
+			Service: names[log.ServiceName],
+			Message: log.Message,
+		})
+	})
+}
+
+// snapServicesState is what is remembered about the services of a snap
+// across updates
+type snapServicesState struct {
+	Disabled []string `yaml:"disabled,omitempty"`
+}
+
+// snapServicesStore has the state of the services of the snaps
+var snapServicesStore = newSnapStore(&snapServicesFile, func() interface{} { return &map[string]snapServicesState{} })
+
+// readSnapServices returns the state of the services by snap name
+func readSnapServices() (map[string]snapServicesState, error) {
+	states := make(map[string]snapServicesState)
+	if err := snapServicesStore.read(&states); err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
+
+// isServiceDisabled returns true if the given service of the given snap
+// was disabled
+func isServiceDisabled(pkgname, serviceName string) bool {
+	states, err := readSnapServices()
+	if err != nil {
+		return false
+	}
+
+	for _, disabled := range states[pkgname].Disabled {
+		if disabled == serviceName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setServiceDisabled remembers if the given service of the given snap
+// is disabled
+func setServiceDisabled(pkgname, serviceName string, disabled bool) error {
+	states, err := readSnapServices()
+	if err != nil {
+		return err
+	}
+
+	state := states[pkgname]
+	var names []string
+	for _, name := range state.Disabled {
+		if name != serviceName {
+			names = append(names, name)
+		}
+	}
+	if disabled {
+		names = append(names, serviceName)
+		sort.Strings(names)
+	}
+	state.Disabled = names
+
+	if len(state.Disabled) == 0 {
+		delete(states, pkgname)
+	} else {
+		states[pkgname] = state
+	}
+
+	return snapServicesStore.write(states)
+}
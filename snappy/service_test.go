@@ -0,0 +1,217 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"launchpad.net/snappy/progress"
+	"launchpad.net/snappy/systemd"
+
+	. "launchpad.net/gocheck"
+)
+
+// the journalctl of the systemd package
+var journalctlCmd = systemd.JournalctlCmd
+
+const servicesPackageYaml = `name: foo
+icon: foo.svg
+vendor: Foo Bar <foo@example.com>
+services:
+ - name: svc1
+   start: bin/hello
+ - name: svc2
+   start: bin/bye
+version: `
+
+// installServicesSnap installs the given version of a snap with two
+// services and returns the systemctl calls of the install
+func (s *SnapTestSuite) installServicesSnap(c *C, version string) [][]string {
+	var calls [][]string
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		calls = append(calls, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	}
+
+	snapFile := makeTestSnapPackage(c, servicesPackageYaml+version)
+	_, err := installClick(snapFile, AllowUnauthenticated, &progress.NullProgress{}, testNamespace)
+	c.Assert(err, IsNil)
+
+	return calls
+}
+
+// isEnabled returns true if the given unit would be started on boot
+func isEnabled(unit string) bool {
+	_, err := os.Lstat(filepath.Join(snapServicesDir, "multi-user.target.wants", unit))
+	return err == nil
+}
+
+// hasCall returns true if the given systemctl call is one of the calls
+func hasCall(calls [][]string, call ...string) bool {
+	for _, c := range calls {
+		if strings.Join(c, " ") == strings.Join(call, " ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *SnapTestSuite) TestServicesStatus(c *C) {
+	s.installServicesSnap(c, "1.0")
+
+	var calls [][]string
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		calls = append(calls, cmd)
+		return []byte("ActiveState=active\nSubState=running\nMainPID=42\n"), nil
+	}
+
+	statuses, err := ServicesStatus("foo/svc2")
+	c.Assert(err, IsNil)
+	c.Assert(statuses, HasLen, 1)
+	c.Check(*statuses[0], DeepEquals, ServiceStatus{
+		Package:     "foo",
+		Service:     "svc2",
+		Unit:        "foo_svc2_1.0.service",
+		Enabled:     true,
+		ActiveState: "active",
+		SubState:    "running",
+		PID:         42,
+	})
+	c.Check(calls[0][len(calls[0])-1], Equals, "foo_svc2_1.0.service")
+
+	statuses, err = ServicesStatus("foo")
+	c.Assert(err, IsNil)
+	c.Check(statuses, HasLen, 2)
+
+	statuses, err = ServicesStatus("")
+	c.Assert(err, IsNil)
+	c.Check(statuses, HasLen, 2)
+}
+
+func (s *SnapTestSuite) TestServicesStatusSocketActivation(c *C) {
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		return []byte("ActiveState=inactive\n"), nil
+	}
+
+	yamlFile, err := makeInstalledMockSnap(s.tempdir, `name: foo
+version: 1.0
+vendor: Foo Bar <foo@example.com>
+services:
+ - name: web
+   start: bin/web
+   socket-activation: true
+   ports:
+     external:
+       ui:
+         port: 8080/tcp
+`)
+	c.Assert(err, IsNil)
+	c.Assert(makeSnapActive(yamlFile), IsNil)
+	c.Assert(addPackageServices(filepath.Dir(filepath.Dir(yamlFile)), false, &progress.NullProgress{}), IsNil)
+
+	// the socket is enabled, not the service
+	statuses, err := ServicesStatus("foo/web")
+	c.Assert(err, IsNil)
+	c.Assert(statuses, HasLen, 1)
+	c.Check(statuses[0].Unit, Equals, "foo_web_1.0.service")
+	c.Check(statuses[0].Enabled, Equals, true)
+
+	c.Assert(os.Remove(filepath.Join(snapServicesDir, "sockets.target.wants", "foo_web_1.0.socket")), IsNil)
+	statuses, err = ServicesStatus("foo/web")
+	c.Assert(err, IsNil)
+	c.Check(statuses[0].Enabled, Equals, false)
+}
+
+func (s *SnapTestSuite) TestServicesNotFound(c *C) {
+	s.installServicesSnap(c, "1.0")
+
+	_, err := ServicesStatus("foo/svc3")
+	c.Check(err, ErrorMatches, `package "foo" has no service "svc3"`)
+
+	err = StartServices("bar", &progress.NullProgress{})
+	c.Check(err, Equals, ErrNotInstalled)
+}
+
+func (s *SnapTestSuite) TestStartStopServices(c *C) {
+	s.installServicesSnap(c, "1.0")
+
+	var calls [][]string
+	systemd.SystemctlCmd = func(cmd ...string) ([]byte, error) {
+		calls = append(calls, cmd)
+		return []byte("ActiveState=inactive\n"), nil
+	}
+
+	c.Assert(StartServices("foo", &progress.NullProgress{}), IsNil)
+	c.Check(calls, DeepEquals, [][]string{
+		{"start", "foo_svc1_1.0.service"},
+		{"start", "foo_svc2_1.0.service"},
+	})
+
+	calls = nil
+	c.Assert(StopServices("foo/svc1", &progress.NullProgress{}), IsNil)
+	c.Check(calls, DeepEquals, [][]string{
+		{"stop", "foo_svc1_1.0.service"},
+		{"show", "--property=ActiveState", "foo_svc1_1.0.service"},
+	})
+}
+
+func (s *SnapTestSuite) TestDisabledServicesStayDisabled(c *C) {
+	s.installServicesSnap(c, "1.0")
+	c.Assert(isEnabled("foo_svc1_1.0.service"), Equals, true)
+
+	c.Assert(DisableServices("foo/svc1", &progress.NullProgress{}), IsNil)
+	// systemctl is mocked, so remove the symlink by hand
+	c.Assert(os.Remove(filepath.Join(snapServicesDir, "multi-user.target.wants", "foo_svc1_1.0.service")), IsNil)
+	c.Check(isServiceDisabled("foo", "svc1"), Equals, true)
+
+	calls := s.installServicesSnap(c, "2.0")
+	c.Check(isEnabled("foo_svc1_2.0.service"), Equals, false)
+	c.Check(isEnabled("foo_svc2_2.0.service"), Equals, true)
+	c.Check(hasCall(calls, "start", "foo_svc1_2.0.service"), Equals, false)
+	c.Check(hasCall(calls, "start", "foo_svc2_2.0.service"), Equals, true)
+
+	c.Assert(EnableServices("foo/svc1", &progress.NullProgress{}), IsNil)
+	c.Check(isServiceDisabled("foo", "svc1"), Equals, false)
+	c.Check(isEnabled("foo_svc1_2.0.service"), Equals, true)
+}
+
+func (s *SnapTestSuite) TestServiceLogs(c *C) {
+	s.installServicesSnap(c, "1.0")
+
+	var args []string
+	systemd.JournalctlCmd = func(a ...string) (io.ReadCloser, error) {
+		args = a
+		return ioutil.NopCloser(strings.NewReader(`{"__REALTIME_TIMESTAMP": "1433160000000000", "_SYSTEMD_UNIT": "foo_svc2_1.0.service", "MESSAGE": "hello"}`)), nil
+	}
+	defer func() { systemd.JournalctlCmd = journalctlCmd }()
+
+	var logs []ServiceLog
+	err := ServiceLogs("foo", &systemd.LogOptions{}, func(log *ServiceLog) {
+		logs = append(logs, *log)
+	})
+	c.Assert(err, IsNil)
+	c.Check(args[len(args)-4:], DeepEquals, []string{"-u", "foo_svc1_1.0.service", "-u", "foo_svc2_1.0.service"})
+	c.Assert(logs, HasLen, 1)
+	c.Check(logs[0].Service, Equals, "foo/svc2")
+	c.Check(logs[0].Message, Equals, "hello")
+}
@@ -19,14 +19,40 @@ package snappy
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"launchpad.net/snappy/logger"
+	"launchpad.net/snappy/progress"
 )
 
 // map from
 var setFuncs = map[string]func(k, v string) error{
-	"active": makeSnapActiveByNameAndVersion,
+	"active":         setActiveProperty,
+	"channel":        setSnapChannelProperty,
+	"hold":           setSnapHoldProperty,
+	"keep-revisions": setSnapKeepRevisionsProperty,
+	"keep-days":      setSnapKeepDaysProperty,
+	"max-disk-usage": setSnapMaxDiskUsageProperty,
+	"memory-limit":   setSnapMemoryLimitProperty,
+	"cpu-quota":      setSnapCPUQuotaProperty,
+	"tasks-max":      setSnapTasksMaxProperty,
+	"io-weight":      setSnapIOWeightProperty,
+}
+
+// parseCountProperty parses the value of a property that is a number,
+// an empty value resets it to 0
+func parseCountProperty(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+// setActiveProperty is the "active" property of SetProperty
+func setActiveProperty(pkgname, ver string) error {
+	return makeSnapActiveByNameAndVersion(pkgname, ver, progress.MakeProgressBar(pkgname))
 }
 
 // SetProperty sets a property for the given pkgname from the args list
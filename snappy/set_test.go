@@ -85,7 +85,7 @@ func (s *SnapTestSuite) TestSetActive(c *C) {
 		os.Stdout = oldStdout
 	}()
 
-	err = makeSnapActiveByNameAndVersion("foo", "1.0")
+	err = makeSnapActiveByNameAndVersion("foo", "1.0", nil)
 	c.Assert(err, IsNil)
 	path, err = filepath.EvalSymlinks(filepath.Join(snapAppsDir, fooComposedName, "current"))
 	c.Assert(strings.HasSuffix(path, "/"+fooComposedName+"/1.0"), Equals, true)
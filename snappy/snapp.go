@@ -22,7 +22,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
@@ -145,9 +144,24 @@ type Service struct {
 	StopTimeout Timeout `yaml:"stop-timeout,omitempty" json:"stop-timeout,omitempty"`
 	BusName     string  `yaml:"bus-name,omitempty" json:"bus-name,omitempty"`
 
+	// RestartCondition is when the service is restarted after it
+	// exited: always, on-failure or never (the default)
+	RestartCondition string         `yaml:"restart-condition,omitempty" json:"restart-condition,omitempty"`
+	RestartDelay     SecondsTimeout `yaml:"restart-delay,omitempty" json:"restart-delay,omitempty"`
+	// Type is how systemd knows the service started: simple (the
+	// default), forking, oneshot or notify
+	Type        string            `yaml:"type,omitempty" json:"type,omitempty"`
+	Environment map[string]string `yaml:"environment,omitempty" json:"environment,omitempty"`
+
 	// must be a pointer so that it can be "nil" and omitempty works
 	Ports *Ports `yaml:"ports,omitempty" json:"ports,omitempty"`
+	// SocketActivation starts the service when one of its external
+	// ports is connected to, instead of on boot
+	SocketActivation bool `yaml:"socket-activation,omitempty" json:"socket-activation,omitempty"`
+
+	HealthCheck *HealthCheck `yaml:"health-check,omitempty" json:"health-check,omitempty"`
 
+	ResourceLimits      `yaml:",inline"`
 	SecurityDefinitions `yaml:",inline"`
 }
 
@@ -156,6 +170,7 @@ type Binary struct {
 	Name string `yaml:"name"`
 	Exec string `yaml:"exec"`
 
+	ResourceLimits      `yaml:",inline"`
 	SecurityDefinitions `yaml:",inline"`
 }
 
@@ -221,6 +236,8 @@ type remoteSnap struct {
 	Title           string             `json:"title"`
 	Type            string             `json:"content,omitempty"`
 	Version         string             `json:"version"`
+	Deltas          []remoteDelta      `json:"deltas,omitempty"`
+	Channel         string             `json:"channel,omitempty"`
 }
 
 type searchResults struct {
@@ -518,8 +535,7 @@ func (s *SnapPart) Hash() string {
 
 // Channel returns the channel used
 func (s *SnapPart) Channel() string {
-	// FIXME: real channel support
-	return "edge"
+	return snapChannel(s.Name())
 }
 
 // Icon returns the path to the icon
@@ -614,7 +630,20 @@ func (s *SnapPart) Uninstall(pb progress.Meter) (err error) {
 		return err
 	}
 
-	return RemoveAllHWAccess(Dirname(s))
+	if err := RemoveAllHWAccess(Dirname(s)); err != nil {
+		return err
+	}
+
+	// what was set for the snap goes with its last version
+	installed, err := NewMetaLocalRepository().Installed()
+	if err != nil {
+		return err
+	}
+	if len(FindSnapsByName(s.Name(), installed)) > 0 {
+		return nil
+	}
+
+	return forgetSnapState(s.Name())
 }
 
 // Config is used to to configure the snap
@@ -875,8 +904,11 @@ func (s *RemoteSnapPart) Hash() string {
 
 // Channel returns the channel used
 func (s *RemoteSnapPart) Channel() string {
-	// FIXME: real channel support, this requires server work
-	return "edge"
+	if s.pkg.Channel == "" {
+		return defaultSnapChannel
+	}
+
+	return s.pkg.Channel
 }
 
 // Icon returns the icon
@@ -924,64 +956,99 @@ func (s *RemoteSnapPart) Date() time.Time {
 }
 
 // Download downloads the snap and returns the filename
+//
+// Partial downloads are kept in the download cache and resumed on the
+// next call, so a dropped connection does not start over from scratch.
 func (s *RemoteSnapPart) Download(pbar progress.Meter) (string, error) {
+	return s.downloadTo(snapDownloadCacheDir, pbar)
+}
 
-	w, err := ioutil.TempFile("", s.pkg.Name)
-	if err != nil {
-		return "", err
-	}
-	defer func() {
-		if err != nil {
-			os.Remove(w.Name())
-		}
-	}()
-
+// downloadTo is Download with the partial download kept in the given
+// directory instead of the download cache
+func (s *RemoteSnapPart) downloadTo(dir string, pbar progress.Meter) (string, error) {
 	// try anonymous download first and fallback to authenticated
 	url := s.pkg.AnonDownloadURL
 	if url == "" {
 		url = s.pkg.DownloadURL
 	}
-	req, err := http.NewRequest("GET", url, nil)
+
+	name := fmt.Sprintf("%s.%s_%s.snap", s.pkg.Name, s.pkg.Namespace, s.pkg.Version)
+	d := newSnapDownload(dir, name, url, pbar)
+	fn, size, hexdigest, err := d.run()
 	if err != nil {
 		return "", err
 	}
-	setUbuntuStoreHeaders(req)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
+	// a truncated or tampered download must never reach installClick
+	if err := s.verifyDownload(size, hexdigest); err != nil {
+		d.remove()
 		return "", err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("Unexpected status code %v", resp.StatusCode)
-	}
 
-	if pbar != nil {
-		pbar.Start(float64(resp.ContentLength))
-		mw := io.MultiWriter(w, pbar)
-		_, err = io.Copy(mw, resp.Body)
-		pbar.Finished()
-	} else {
-		_, err = io.Copy(w, resp.Body)
+	return fn, nil
+}
+
+// verifyDownload checks the size and sha512 of a downloaded snap against
+// the values the store advertised for it
+func (s *RemoteSnapPart) verifyDownload(size int64, hexdigest string) error {
+	if s.pkg.DownloadSize > 0 && size != s.pkg.DownloadSize {
+		return &ErrDownloadSizeMismatch{
+			snap:     s.pkg.Name,
+			expected: s.pkg.DownloadSize,
+			got:      size,
+		}
 	}
 
-	if err != nil {
-		return "", err
+	if s.pkg.DownloadSha512 != "" && hexdigest != s.pkg.DownloadSha512 {
+		return &ErrDownloadHashMismatch{
+			snap:     s.pkg.Name,
+			expected: s.pkg.DownloadSha512,
+			got:      hexdigest,
+		}
 	}
 
-	return w.Name(), w.Sync()
+	return nil
 }
 
 // Install installs the snap
 func (s *RemoteSnapPart) Install(pbar progress.Meter, flags InstallFlags) (string, error) {
-	downloadedSnap, err := s.Download(pbar)
+	downloadedSnap, err := s.fetch(pbar)
 	if err != nil {
 		return "", err
 	}
 	defer os.Remove(downloadedSnap)
 
-	return installClick(downloadedSnap, flags, pbar, s.Namespace())
+	return s.installFetched(downloadedSnap, pbar, flags)
+}
+
+// fetch downloads and verifies the snap, if the store has a delta from
+// the installed version it is used instead of downloading the full snap
+// (see downloadDelta)
+func (s *RemoteSnapPart) fetch(pbar progress.Meter) (string, error) {
+	downloadedSnap, err := s.downloadDelta(pbar)
+	if err == nil {
+		return downloadedSnap, nil
+	}
+	if err != errNoDelta {
+		log.Printf("WARNING: can not update %s with a delta, downloading the full snap: %s", s.Name(), err)
+	}
+
+	return s.Download(pbar)
+}
+
+// installFetched installs the snap downloaded by fetch
+func (s *RemoteSnapPart) installFetched(downloadedSnap string, pbar progress.Meter, flags InstallFlags) (string, error) {
+	name, err := installClick(downloadedSnap, flags, pbar, s.Namespace())
+	if err != nil {
+		return "", err
+	}
+
+	// keep it around as the base for the next delta
+	if err := cacheSnap(downloadedSnap, s.pkg.Name, s.pkg.Namespace, s.pkg.Version); err != nil {
+		log.Printf("WARNING: can not cache %s: %s", downloadedSnap, err)
+	}
+
+	return name, nil
 }
 
 // SetActive sets the snap active
@@ -1046,32 +1113,46 @@ func getStructFields(s interface{}) []string {
 	return fields
 }
 
-func init() {
-	storeBaseURI, err := url.Parse("https://search.apps.ubuntu.com/api/v1/")
+// the base URI of the ubuntu store
+const ubuntuStoreBaseURI = "https://search.apps.ubuntu.com/api/v1/"
+
+// storeURIs returns the search, details and bulk URIs of the store with the
+// given base URI
+func storeURIs(base string) (search, details, bulk *url.URL, err error) {
+	storeBaseURI, err := url.Parse(base)
 	if err != nil {
-		panic(err)
+		return nil, nil, nil, err
 	}
 
-	storeSearchURI, err = storeBaseURI.Parse("search")
+	search, err = storeBaseURI.Parse("search")
 	if err != nil {
-		panic(err)
+		return nil, nil, nil, err
 	}
 
 	v := url.Values{}
 	v.Set("fields", strings.Join(getStructFields(remoteSnap{}), ","))
-	storeSearchURI.RawQuery = v.Encode()
+	search.RawQuery = v.Encode()
 
-	storeDetailsURI, err = storeBaseURI.Parse("package/")
+	details, err = storeBaseURI.Parse("package/")
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
+	bulk, err = storeBaseURI.Parse("click-metadata")
 	if err != nil {
-		panic(err)
+		return nil, nil, nil, err
 	}
+	bulk.RawQuery = v.Encode()
+
+	return search, details, bulk, nil
+}
 
-	storeBulkURI, err = storeBaseURI.Parse("click-metadata")
+func init() {
+	var err error
+	storeSearchURI, storeDetailsURI, storeBulkURI, err = storeURIs(ubuntuStoreBaseURI)
 	if err != nil {
 		panic(err)
 	}
-	storeBulkURI.RawQuery = v.Encode()
 }
 
 // NewUbuntuStoreSnapRepository creates a new SnapUbuntuStoreRepository
@@ -1087,6 +1168,21 @@ func NewUbuntuStoreSnapRepository() *SnapUbuntuStoreRepository {
 	}
 }
 
+// newUbuntuStoreSnapRepositoryForURI creates a new SnapUbuntuStoreRepository
+// for the store (or store mirror) at the given base URI
+func newUbuntuStoreSnapRepositoryForURI(base string) (*SnapUbuntuStoreRepository, error) {
+	searchURI, detailsURI, bulkURI, err := storeURIs(base)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SnapUbuntuStoreRepository{
+		searchURI:  searchURI,
+		detailsURI: detailsURI,
+		bulkURI:    bulkURI.String(),
+	}, nil
+}
+
 // small helper that sets the correct http headers for the ubuntu store
 func setUbuntuStoreHeaders(req *http.Request) {
 	req.Header.Set("Accept", "application/hal+json")
@@ -1101,6 +1197,10 @@ func setUbuntuStoreHeaders(req *http.Request) {
 		req.Header.Set("X-Ubuntu-Store", storeID)
 	}
 
+	if formats := supportedDeltaFormats(); len(formats) > 0 {
+		req.Header.Set("X-Ubuntu-Delta-Formats", strings.Join(formats, ","))
+	}
+
 	// sso
 	ssoToken, err := ReadStoreToken()
 	if err == nil {
@@ -1127,28 +1227,30 @@ func (s *SnapUbuntuStoreRepository) Details(snapName string) (parts []Part, err
 
 	// set headers
 	setUbuntuStoreHeaders(req)
+	channel := snapChannel(snapName)
+	req.Header.Set("X-Ubuntu-Device-Channel", channel)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	statusCode, body, err := cachedStoreRequest(req, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	// check statusCode
 	switch {
-	case resp.StatusCode == 404:
+	case statusCode == 404:
 		return nil, ErrPackageNotFound
-	case resp.StatusCode != 200:
-		return parts, fmt.Errorf("SnapUbuntuStoreRepository: unexpected http statusCode %v for %s", resp.StatusCode, snapName)
+	case statusCode != 200:
+		return parts, fmt.Errorf("SnapUbuntuStoreRepository: unexpected http statusCode %v for %s", statusCode, snapName)
 	}
 
 	// and decode json
 	var detailsData remoteSnap
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&detailsData); err != nil {
+	if err := json.Unmarshal(body, &detailsData); err != nil {
 		return nil, err
 	}
+	if detailsData.Channel == "" {
+		detailsData.Channel = channel
+	}
 
 	snap := NewRemoteSnapPart(detailsData)
 	parts = append(parts, snap)
@@ -1169,8 +1271,7 @@ func (s *SnapUbuntuStoreRepository) Search(searchTerm string) (SharedNames, erro
 	// set headers
 	setUbuntuStoreHeaders(req)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := httpDo(req)
 	if err != nil {
 		return nil, err
 	}
@@ -1209,7 +1310,44 @@ func (s *SnapUbuntuStoreRepository) Updates() (parts []Part, err error) {
 	if err != nil || len(installed) == 0 {
 		return nil, err
 	}
-	jsonData, err := json.Marshal(map[string][]string{"name": installed})
+
+	// every snap is asked for in the channel it tracks, held snaps are
+	// not asked for at all
+	byChannel := make(map[string][]string)
+	for _, name := range installed {
+		if IsHeld(name) {
+			continue
+		}
+		channel := snapChannel(name)
+		byChannel[channel] = append(byChannel[channel], name)
+	}
+
+	for _, channel := range snapChannels {
+		names, ok := byChannel[channel]
+		if !ok {
+			continue
+		}
+
+		updateData, err := s.bulkDetails(names, channel)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pkg := range updateData {
+			current := ActiveSnapByName(pkg.Name)
+			if current == nil || current.Version() != pkg.Version {
+				snap := NewRemoteSnapPart(pkg)
+				parts = append(parts, snap)
+			}
+		}
+	}
+
+	return parts, nil
+}
+
+// bulkDetails returns the details of the given snaps in the given channel
+func (s *SnapUbuntuStoreRepository) bulkDetails(names []string, channel string) ([]remoteSnap, error) {
+	jsonData, err := json.Marshal(map[string][]string{"name": names})
 	if err != nil {
 		return nil, err
 	}
@@ -1220,32 +1358,30 @@ func (s *SnapUbuntuStoreRepository) Updates() (parts []Part, err error) {
 	}
 	// set headers
 	setUbuntuStoreHeaders(req)
+	req.Header.Set("X-Ubuntu-Device-Channel", channel)
 	// the updates call is a special snowflake right now
 	// (see LP: #1427155)
 	req.Header.Set("Accept", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	statusCode, body, err := cachedStoreRequest(req, jsonData)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	if statusCode != 200 {
+		return nil, fmt.Errorf("SnapUbuntuStoreRepository: unexpected http statusCode %v for updates", statusCode)
+	}
 
 	var updateData []remoteSnap
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&updateData); err != nil {
+	if err := json.Unmarshal(body, &updateData); err != nil {
 		return nil, err
 	}
-
-	for _, pkg := range updateData {
-		current := ActiveSnapByName(pkg.Name)
-		if current == nil || current.Version() != pkg.Version {
-			snap := NewRemoteSnapPart(pkg)
-			parts = append(parts, snap)
+	for i := range updateData {
+		if updateData[i].Channel == "" {
+			updateData[i].Channel = channel
 		}
 	}
 
-	return parts, nil
+	return updateData, nil
 }
 
 // Installed returns the installed snaps from this repository
@@ -27,6 +27,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"launchpad.net/snappy/coreconfig"
 	"launchpad.net/snappy/helpers"
 	"launchpad.net/snappy/partition"
 	"launchpad.net/snappy/policy"
@@ -88,6 +89,14 @@ func (s *SnapTestSuite) SetUpTest(c *C) {
 	storeDetailsURI, _ = url.Parse("")
 	storeBulkURI, _ = url.Parse("")
 
+	// no network settings of the system either
+	getNetworkSettings = func() (*coreconfig.NetworkConfig, error) {
+		return &coreconfig.NetworkConfig{}, nil
+	}
+	getGCSettings = func() (*coreconfig.GCConfig, error) {
+		return &coreconfig.GCConfig{}, nil
+	}
+
 	aaExec = filepath.Join(s.tempdir, "aa-exec")
 	err := ioutil.WriteFile(aaExec, []byte(mockAaExecScript), 0755)
 	c.Assert(err, IsNil)
@@ -108,6 +117,8 @@ func (s *SnapTestSuite) TearDownTest(c *C) {
 	stripGlobalRootDir = stripGlobalRootDirImpl
 	runScFilterGen = runScFilterGenImpl
 	runUdevAdm = runUdevAdmImpl
+	getNetworkSettings = coreconfig.NetworkSettings
+	getGCSettings = coreconfig.GCSettings
 }
 
 func (s *SnapTestSuite) makeInstalledMockSnap(yamls ...string) (yamlFile string, err error) {
@@ -698,6 +709,74 @@ services:
 	c.Check(p.notified[0], Matches, "Waiting for .* stop.")
 }
 
+func (s *SnapTestSuite) TestUbuntuStoreRepositoryDownloadVerifiesHash(c *C) {
+	snapPackage := makeTestSnapPackage(c, "")
+	snapR, err := os.Open(snapPackage)
+	c.Assert(err, IsNil)
+	st, err := snapR.Stat()
+	c.Assert(err, IsNil)
+	sha512, err := helpers.Sha512sum(snapPackage)
+	c.Assert(err, IsNil)
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, snapR)
+	}))
+
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	snap := RemoteSnapPart{}
+	snap.pkg.AnonDownloadURL = mockServer.URL + "/snap"
+	snap.pkg.DownloadSha512 = sha512
+	snap.pkg.DownloadSize = st.Size()
+
+	name, err := snap.Install(nil, 0)
+	c.Assert(err, IsNil)
+	c.Check(name, Equals, "foo")
+}
+
+func (s *SnapTestSuite) TestUbuntuStoreRepositoryDownloadHashMismatch(c *C) {
+	snapPackage := makeTestSnapPackage(c, "")
+	snapR, err := os.Open(snapPackage)
+	c.Assert(err, IsNil)
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, snapR)
+	}))
+
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	snap := RemoteSnapPart{}
+	snap.pkg.Name = "foo"
+	snap.pkg.AnonDownloadURL = mockServer.URL + "/snap"
+	snap.pkg.DownloadSha512 = "invalid-sha512"
+
+	_, err = snap.Install(nil, 0)
+	c.Assert(err, FitsTypeOf, &ErrDownloadHashMismatch{})
+
+	// nothing got installed
+	c.Check(ActiveSnapByName("foo"), IsNil)
+}
+
+func (s *SnapTestSuite) TestUbuntuStoreRepositoryDownloadTruncated(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "short")
+	}))
+
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	snap := RemoteSnapPart{}
+	snap.pkg.Name = "foo"
+	snap.pkg.AnonDownloadURL = mockServer.URL + "/snap"
+	snap.pkg.DownloadSize = 65375
+
+	fn, err := snap.Download(nil)
+	c.Assert(err, FitsTypeOf, &ErrDownloadSizeMismatch{})
+	c.Check(fn, Equals, "")
+}
+
 func (s *SnapTestSuite) TestRemoteSnapErrors(c *C) {
 	snap := RemoteSnapPart{}
 
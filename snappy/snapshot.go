@@ -0,0 +1,421 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"launchpad.net/snappy/helpers"
+	"launchpad.net/snappy/progress"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	snapshotMetaName = "meta.yaml"
+	snapshotDataName = "data.tar.gz"
+)
+
+// Snapshot is an archive of the data of one version of a snap, the
+// system data and the data in the homes of the users
+type Snapshot struct {
+	ID        int       `yaml:"id"`
+	Name      string    `yaml:"name"`
+	Namespace string    `yaml:"namespace,omitempty"`
+	Version   string    `yaml:"version"`
+	Created   time.Time `yaml:"created"`
+	Size      int64     `yaml:"size"`
+	// Dirs are the archived data dirs, relative to the root dir
+	Dirs []string `yaml:"dirs"`
+}
+
+// Dirname returns the name.namespace of the snap of the snapshot
+func (s *Snapshot) Dirname() string {
+	return SnapDataDir{Name: s.Name, Namespace: s.Namespace}.Dirname()
+}
+
+func (s *Snapshot) dir() string {
+	return filepath.Join(snapSnapshotsDir, s.Dirname(), strconv.Itoa(s.ID))
+}
+
+// snapshotDirs returns the dirs of the snapshots of the given snap
+func snapshotDirs(name string) ([]string, error) {
+	if _, ns := splitNamespace(name); ns != "" {
+		return filepath.Glob(filepath.Join(snapSnapshotsDir, name, "*"))
+	}
+
+	dirs, err := filepath.Glob(filepath.Join(snapSnapshotsDir, name, "*"))
+	if err != nil {
+		return nil, err
+	}
+	nsDirs, err := filepath.Glob(filepath.Join(snapSnapshotsDir, name+".*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	return append(dirs, nsDirs...), nil
+}
+
+// Snapshots returns the snapshots of the given snap, oldest first
+func Snapshots(name string) ([]*Snapshot, error) {
+	dirs, err := snapshotDirs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []*Snapshot
+	for _, dir := range dirs {
+		yamlData, err := ioutil.ReadFile(filepath.Join(dir, snapshotMetaName))
+		if err != nil {
+			// not finished (or being removed)
+			continue
+		}
+
+		var snapshot Snapshot
+		if err := yaml.Unmarshal(yamlData, &snapshot); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, &snapshot)
+	}
+	sort.Sort(byID(snapshots))
+
+	return snapshots, nil
+}
+
+type byID []*Snapshot
+
+func (a byID) Len() int           { return len(a) }
+func (a byID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byID) Less(i, j int) bool { return a[i].ID < a[j].ID }
+
+// findSnapshot returns the snapshot of the given snap with the given id
+func findSnapshot(name, id string) (*Snapshot, error) {
+	snapshots, err := Snapshots(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, snapshot := range snapshots {
+		if strconv.Itoa(snapshot.ID) == id {
+			return snapshot, nil
+		}
+	}
+
+	return nil, &ErrSnapshotNotFound{name: name, id: id}
+}
+
+// snapshotDataDirs returns the data dirs of the given part spec
+// (name[.namespace][=version]), for the active version if there is no
+// version in the spec
+func snapshotDataDirs(partSpec string) ([]SnapDataDir, error) {
+	if !strings.Contains(partSpec, "=") {
+		name, _ := splitNamespace(partSpec)
+		part := ActiveSnapByName(name)
+		if part == nil {
+			return nil, ErrNotInstalled
+		}
+		partSpec += "=" + part.Version()
+	}
+
+	datadirs := DataDirs(partSpec)
+	if len(datadirs) == 0 {
+		return nil, ErrPackageNotFound
+	}
+	for _, datadir := range datadirs[1:] {
+		if datadir.Dirname() != datadirs[0].Dirname() {
+			return nil, fmt.Errorf("%s matches more than one snap", partSpec)
+		}
+	}
+
+	return datadirs, nil
+}
+
+// relativeToRoot returns the given path relative to "/" for tar
+func relativeToRoot(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+// NewSnapshot archives the data of the given part spec
+// (name[.namespace][=version], the active version by default). The
+// snap is deactivated while its data is archived.
+func NewSnapshot(partSpec string, meter progress.Meter) (*Snapshot, error) {
+	datadirs, err := snapshotDataDirs(partSpec)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		Name:      datadirs[0].Name,
+		Namespace: datadirs[0].Namespace,
+		Version:   datadirs[0].Version,
+		Created:   time.Now(),
+	}
+	dirs, err := snapDataDirs(snapshot.Dirname(), snapshot.Version)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if helpers.FileExists(dir) {
+			snapshot.Dirs = append(snapshot.Dirs, relativeToRoot(dir))
+		}
+	}
+
+	existing, err := Snapshots(snapshot.Dirname())
+	if err != nil {
+		return nil, err
+	}
+	snapshot.ID = 1
+	if len(existing) > 0 {
+		snapshot.ID = existing[len(existing)-1].ID + 1
+	}
+
+	if err := helpers.EnsureDir(snapshot.dir(), 0700); err != nil {
+		return nil, err
+	}
+
+	active := activeDataDirParts(datadirs)
+	deactivateParts(active, "Snapshot", meter)
+	defer reactivateParts(active, meter)
+
+	archive := filepath.Join(snapshot.dir(), snapshotDataName)
+	cmd := exec.Command("tar", append([]string{"-C", "/", "-czpf", archive}, snapshot.Dirs...)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(snapshot.dir())
+		return nil, fmt.Errorf("can not archive the data of %s: %s (%q)", snapshot.Dirname(), err, output)
+	}
+
+	st, err := os.Stat(archive)
+	if err != nil {
+		os.RemoveAll(snapshot.dir())
+		return nil, err
+	}
+	snapshot.Size = st.Size()
+
+	// the metadata is written last, it marks the snapshot as complete
+	yamlData, err := yaml.Marshal(snapshot)
+	if err != nil {
+		os.RemoveAll(snapshot.dir())
+		return nil, err
+	}
+	if err := helpers.AtomicWriteFile(filepath.Join(snapshot.dir(), snapshotMetaName), yamlData, 0600); err != nil {
+		os.RemoveAll(snapshot.dir())
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// RestoreSnapshot replaces the data of the version of the snap the
+// given snapshot was taken of with the data of the snapshot. The snap
+// is deactivated while its data is restored.
+//
+// The data is extracted next to the current data first and only
+// swapped in once that worked, so a failure leaves the current data
+// alone.
+func RestoreSnapshot(name, id string, meter progress.Meter) (*Snapshot, error) {
+	snapshot, err := findSnapshot(name, id)
+	if err != nil {
+		return nil, err
+	}
+
+	datadirs := DataDirs(snapshot.Dirname() + "=" + snapshot.Version)
+	active := activeDataDirParts(datadirs)
+	deactivateParts(active, "Restore", meter)
+	defer reactivateParts(active, meter)
+
+	restores, err := stageSnapshotData(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("can not restore the data of %s: %s", snapshot.Dirname(), err)
+	}
+	// this removes the old data after the swap, or the restored data
+	// if the swap failed
+	defer func() {
+		for _, r := range restores {
+			os.RemoveAll(r.stage)
+		}
+	}()
+
+	if err := swapInData(restores); err != nil {
+		return nil, fmt.Errorf("can not restore the data of %s: %s", snapshot.Dirname(), err)
+	}
+
+	return snapshot, nil
+}
+
+// dataRestore is the restore of a single data dir
+type dataRestore struct {
+	// path is the data dir
+	path string
+	// stage is a dir next to the data dir that gets the restored
+	// data and then the old data
+	stage string
+	// staged is the restored data in stage, empty if the data dir
+	// is not part of the snapshot (and so only removed)
+	staged string
+}
+
+func newDataRestore(path string) (*dataRestore, error) {
+	if err := helpers.EnsureDir(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	stage, err := ioutil.TempDir(filepath.Dir(path), ".restore-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &dataRestore{path: path, stage: stage}, nil
+}
+
+func (r *dataRestore) old() string {
+	return filepath.Join(r.stage, ".old")
+}
+
+// swap moves the data dir to the stage and the restored data in its
+// place
+func (r *dataRestore) swap() error {
+	if helpers.FileExists(r.path) {
+		if err := os.Rename(r.path, r.old()); err != nil {
+			return err
+		}
+	}
+	if r.staged == "" {
+		return nil
+	}
+	if err := os.Rename(r.staged, r.path); err != nil {
+		r.undo()
+		return err
+	}
+
+	return nil
+}
+
+// undo reverts a swap
+func (r *dataRestore) undo() {
+	if r.staged != "" && !helpers.FileExists(r.staged) {
+		os.Rename(r.path, r.staged)
+	}
+	if helpers.FileExists(r.old()) {
+		os.Rename(r.old(), r.path)
+	}
+}
+
+// stageSnapshotData extracts the data dirs of the snapshot next to the
+// current ones, without touching those
+func stageSnapshotData(snapshot *Snapshot) (restores []*dataRestore, err error) {
+	defer func() {
+		if err != nil {
+			for _, r := range restores {
+				os.RemoveAll(r.stage)
+			}
+		}
+	}()
+
+	archive := filepath.Join(snapshot.dir(), snapshotDataName)
+	restoring := make(map[string]bool)
+	for _, dir := range snapshot.Dirs {
+		dir = filepath.Clean(dir)
+		r, err := newDataRestore("/" + dir)
+		if err != nil {
+			return restores, err
+		}
+		restores = append(restores, r)
+		restoring[r.path] = true
+
+		// only the last element of the path is kept, so the data
+		// ends up in stage/<version>
+		strip := strconv.Itoa(strings.Count(dir, "/"))
+		cmd := exec.Command("tar", "-C", r.stage, "--strip-components", strip, "-xzpf", archive, dir)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return restores, fmt.Errorf("%s (%q)", err, output)
+		}
+		r.staged = filepath.Join(r.stage, filepath.Base(r.path))
+	}
+
+	// data dirs that were created after the snapshot was taken are
+	// removed
+	current, err := snapDataDirs(snapshot.Dirname(), snapshot.Version)
+	if err != nil {
+		return restores, err
+	}
+	for _, path := range current {
+		if restoring[path] || !helpers.FileExists(path) {
+			continue
+		}
+		r, err := newDataRestore(path)
+		if err != nil {
+			return restores, err
+		}
+		restores = append(restores, r)
+	}
+
+	return restores, nil
+}
+
+// swapInData swaps in the restored data of all data dirs, if that fails
+// for one of them the ones swapped already are reverted
+func swapInData(restores []*dataRestore) error {
+	for i, r := range restores {
+		if err := r.swap(); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				restores[j].undo()
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ForgetSnapshot removes the given snapshot
+func ForgetSnapshot(name, id string) error {
+	snapshot, err := findSnapshot(name, id)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(snapshot.dir())
+}
+
+// PruneSnapshots removes all but the newest "keep" snapshots of the
+// given snap and returns the removed ones
+func PruneSnapshots(name string, keep int) ([]*Snapshot, error) {
+	snapshots, err := Snapshots(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) <= keep {
+		return nil, nil
+	}
+
+	pruned := snapshots[:len(snapshots)-keep]
+	for _, snapshot := range pruned {
+		if err := os.RemoveAll(snapshot.dir()); err != nil {
+			return nil, err
+		}
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"launchpad.net/snappy/helpers"
+
+	. "launchpad.net/gocheck"
+)
+
+func (s *SnapTestSuite) TestSnapshotRestore(c *C) {
+	s.installTestVersions(c, "1.0")
+	systemData := filepath.Join(snapDataDir, "foo.bar", "1.0", "state")
+	homeData := filepath.Join(s.tempdir, "home", "user1", "apps", "foo.bar", "1.0", "prefs")
+	c.Assert(os.MkdirAll(filepath.Dir(homeData), 0755), IsNil)
+	c.Assert(ioutil.WriteFile(systemData, []byte("good"), 0644), IsNil)
+	c.Assert(ioutil.WriteFile(homeData, []byte("good"), 0644), IsNil)
+
+	snapshot, err := NewSnapshot("foo", &MockProgressMeter{})
+	c.Assert(err, IsNil)
+	c.Check(snapshot.ID, Equals, 1)
+	c.Check(snapshot.Dirname(), Equals, "foo.bar")
+	c.Check(snapshot.Version, Equals, "1.0")
+	c.Check(snapshot.Dirs, HasLen, 2)
+	c.Check(snapshot.Size > 0, Equals, true)
+	// the snap is active again
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "1.0")
+
+	// a bad migration
+	c.Assert(ioutil.WriteFile(systemData, []byte("bad"), 0644), IsNil)
+	c.Assert(os.Remove(homeData), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(snapDataDir, "foo.bar", "1.0", "junk"), []byte("bad"), 0644), IsNil)
+
+	_, err = RestoreSnapshot("foo", "1", &MockProgressMeter{})
+	c.Assert(err, IsNil)
+	content, err := ioutil.ReadFile(systemData)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "good")
+	content, err = ioutil.ReadFile(homeData)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "good")
+	c.Check(helpers.FileExists(filepath.Join(snapDataDir, "foo.bar", "1.0", "junk")), Equals, false)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "1.0")
+
+	// nothing is left behind
+	staged, err := filepath.Glob(filepath.Join(snapDataDir, "foo.bar", ".restore-*"))
+	c.Assert(err, IsNil)
+	c.Check(staged, HasLen, 0)
+}
+
+func (s *SnapTestSuite) TestSnapshotRestoreFailureKeepsData(c *C) {
+	s.installTestVersions(c, "1.0")
+	systemData := filepath.Join(snapDataDir, "foo.bar", "1.0", "state")
+	c.Assert(ioutil.WriteFile(systemData, []byte("good"), 0644), IsNil)
+
+	snapshot, err := NewSnapshot("foo", &MockProgressMeter{})
+	c.Assert(err, IsNil)
+	c.Assert(ioutil.WriteFile(systemData, []byte("current"), 0644), IsNil)
+
+	// a broken archive
+	c.Assert(ioutil.WriteFile(filepath.Join(snapshot.dir(), snapshotDataName), []byte("junk"), 0600), IsNil)
+	_, err = RestoreSnapshot("foo", "1", &MockProgressMeter{})
+	c.Assert(err, ErrorMatches, "can not restore the data of foo.bar: .*")
+
+	content, err := ioutil.ReadFile(systemData)
+	c.Assert(err, IsNil)
+	c.Check(string(content), Equals, "current")
+	staged, err := filepath.Glob(filepath.Join(snapDataDir, "foo.bar", ".restore-*"))
+	c.Assert(err, IsNil)
+	c.Check(staged, HasLen, 0)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "1.0")
+}
+
+func (s *SnapTestSuite) TestSnapshotNotInstalled(c *C) {
+	_, err := NewSnapshot("foo", &MockProgressMeter{})
+	c.Check(err, Equals, ErrNotInstalled)
+}
+
+func (s *SnapTestSuite) TestSnapshotsListForgetPrune(c *C) {
+	s.installTestVersions(c, "1.0")
+	for i := 0; i < 3; i++ {
+		_, err := NewSnapshot("foo.bar", &MockProgressMeter{})
+		c.Assert(err, IsNil)
+	}
+
+	snapshots, err := Snapshots("foo")
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 3)
+	c.Check(snapshots[2].ID, Equals, 3)
+
+	c.Assert(ForgetSnapshot("foo", "2"), IsNil)
+	c.Check(ForgetSnapshot("foo", "2"), FitsTypeOf, &ErrSnapshotNotFound{})
+
+	pruned, err := PruneSnapshots("foo", 1)
+	c.Assert(err, IsNil)
+	c.Assert(pruned, HasLen, 1)
+	c.Check(pruned[0].ID, Equals, 1)
+
+	snapshots, err = Snapshots("foo.bar")
+	c.Assert(err, IsNil)
+	c.Assert(snapshots, HasLen, 1)
+	c.Check(snapshots[0].ID, Equals, 3)
+}
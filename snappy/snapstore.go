@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"launchpad.net/snappy/helpers"
+
+	"gopkg.in/yaml.v2"
+)
+
+// snapStore is a yaml file with what was set for the snaps (e.g. the
+// channels they track), a map by snap name that is kept across updates
+// until the last version of a snap is removed
+type snapStore struct {
+	// file is a pointer as the paths change with SetRootDir
+	file *string
+	// newMap returns a pointer to an empty map of the state
+	newMap func() interface{}
+}
+
+// snapStores are all the snapStores, forgetSnapState forgets a snap in
+// all of them
+var snapStores []*snapStore
+
+// newSnapStore returns the snapStore for the given file, newMap returns
+// a pointer to an empty map by snap name of the type of the state
+func newSnapStore(file *string, newMap func() interface{}) *snapStore {
+	store := &snapStore{file: file, newMap: newMap}
+	snapStores = append(snapStores, store)
+
+	return store
+}
+
+// read reads the state into the given pointer to a map, which is left
+// alone if there is no state yet
+func (s *snapStore) read(m interface{}) error {
+	yamlData, err := ioutil.ReadFile(*s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(yamlData, m)
+}
+
+// write replaces the state with the given map
+func (s *snapStore) write(m interface{}) error {
+	yamlData, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if err := helpers.EnsureDir(filepath.Dir(*s.file), 0755); err != nil {
+		return err
+	}
+
+	return helpers.AtomicWriteFile(*s.file, yamlData, 0644)
+}
+
+// forget removes the snap with the given name from the state
+func (s *snapStore) forget(name string) error {
+	m := s.newMap()
+	if err := s.read(m); err != nil {
+		return err
+	}
+
+	states := reflect.ValueOf(m).Elem()
+	key := reflect.ValueOf(name)
+	if !states.MapIndex(key).IsValid() {
+		return nil
+	}
+	states.SetMapIndex(key, reflect.Value{})
+
+	return s.write(m)
+}
+
+// forgetSnapState forgets what was set for the snap with the given name
+// (its channel, hold, retention settings, limits and disabled services)
+func forgetSnapState(name string) error {
+	for _, store := range snapStores {
+		if err := store.forget(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
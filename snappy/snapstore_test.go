@@ -0,0 +1,37 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"launchpad.net/snappy/helpers"
+
+	. "launchpad.net/gocheck"
+)
+
+func (s *SnapTestSuite) TestSnapStoreForget(c *C) {
+	// nothing to forget without a file
+	c.Assert(snapChannelsStore.forget("foo"), IsNil)
+	c.Check(helpers.FileExists(snapChannelsFile), Equals, false)
+
+	c.Assert(snapChannelsStore.write(map[string]string{"foo": "stable", "bar": "beta"}), IsNil)
+	c.Assert(snapChannelsStore.forget("foo"), IsNil)
+
+	channels, err := readSnapChannels()
+	c.Assert(err, IsNil)
+	c.Check(channels, DeepEquals, map[string]string{"bar": "beta"})
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// SourceType is the type of a repository source
+type SourceType string
+
+// The repository source types we support
+const (
+	SourceTypeSystemImage SourceType = "system-image"
+	SourceTypeStore       SourceType = "store"
+	SourceTypeLocal       SourceType = "local"
+	SourceTypeOffline     SourceType = "offline"
+)
+
+// Source describes a single repository in the sources configuration
+type Source struct {
+	// Name identifies the source, a source with the same name in a
+	// later file replaces the earlier one
+	Name string     `yaml:"name"`
+	Type SourceType `yaml:"type"`
+	// URI is the base URI of a store or the directory of a local or
+	// offline repository
+	URI string `yaml:"uri,omitempty"`
+	// Priority orders the sources, higher priorities come first
+	Priority int `yaml:"priority,omitempty"`
+	// Enabled defaults to true when not given
+	Enabled *bool `yaml:"enabled,omitempty"`
+}
+
+type sourcesYaml struct {
+	Sources []Source `yaml:"sources"`
+}
+
+// IsEnabled returns true if the source is enabled
+func (src *Source) IsEnabled() bool {
+	return src.Enabled == nil || *src.Enabled
+}
+
+// defaultSources returns the sources used if nothing is configured
+func defaultSources() []Source {
+	return []Source{
+		{Name: "system-image", Type: SourceTypeSystemImage},
+		{Name: "ubuntu-store", Type: SourceTypeStore},
+		{Name: "apps", Type: SourceTypeLocal, URI: snapAppsDir},
+		{Name: "oem", Type: SourceTypeLocal, URI: snapOemDir},
+	}
+}
+
+// parseSourcesYaml parses the given sources.d yaml data
+func parseSourcesYaml(yamlData []byte) ([]Source, error) {
+	var sy sourcesYaml
+	if err := yaml.Unmarshal(yamlData, &sy); err != nil {
+		return nil, err
+	}
+
+	for _, src := range sy.Sources {
+		if src.Name == "" {
+			return nil, &ErrInvalidSource{source: src, msg: "missing name"}
+		}
+		switch src.Type {
+		case SourceTypeSystemImage, SourceTypeStore:
+		case SourceTypeLocal, SourceTypeOffline:
+			if src.URI == "" {
+				return nil, &ErrInvalidSource{source: src, msg: "missing uri"}
+			}
+		default:
+			return nil, &ErrInvalidSource{source: src, msg: fmt.Sprintf("unknown type %q", src.Type)}
+		}
+	}
+
+	return sy.Sources, nil
+}
+
+// Sources returns the enabled repository sources, ordered by priority.
+//
+// The defaults can be changed or extended by yaml files in
+// /etc/snappy/sources.d, which are read in lexical order. A file that
+// can not be read or parsed is skipped, the others still apply (so e.g.
+// a store that was disabled stays disabled).
+func Sources() ([]Source, error) {
+	sources := defaultSources()
+
+	matches, err := filepath.Glob(filepath.Join(snapSourcesDir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+
+	for _, fn := range matches {
+		yamlData, err := ioutil.ReadFile(fn)
+		if err != nil {
+			log.Printf("WARNING: skipping %s: %s", fn, err)
+			continue
+		}
+		configured, err := parseSourcesYaml(yamlData)
+		if err != nil {
+			log.Printf("WARNING: skipping %s: can not parse it: %s", fn, err)
+			continue
+		}
+		sources = mergeSources(sources, configured)
+	}
+
+	enabled := make([]Source, 0, len(sources))
+	for _, src := range sources {
+		if src.IsEnabled() {
+			enabled = append(enabled, src)
+		}
+	}
+	sort.Stable(byPriority(enabled))
+
+	return enabled, nil
+}
+
+// mergeSources replaces the sources in "sources" with the ones from
+// "configured" of the same name and appends the new ones
+func mergeSources(sources, configured []Source) []Source {
+	for _, src := range configured {
+		replaced := false
+		for i := range sources {
+			if sources[i].Name == src.Name {
+				sources[i] = src
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			sources = append(sources, src)
+		}
+	}
+
+	return sources
+}
+
+type byPriority []Source
+
+func (bp byPriority) Len() int           { return len(bp) }
+func (bp byPriority) Swap(a, b int)      { bp[a], bp[b] = bp[b], bp[a] }
+func (bp byPriority) Less(a, b int) bool { return bp[a].Priority > bp[b].Priority }
+
+// Repository returns the Repository for the source, or nil if it is not
+// available (e.g. a local repository that does not exist)
+func (src *Source) Repository() (Repository, error) {
+	switch src.Type {
+	case SourceTypeSystemImage:
+		if repo := NewSystemImageRepository(); repo != nil {
+			return repo, nil
+		}
+	case SourceTypeStore:
+		if src.URI == "" {
+			if repo := NewUbuntuStoreSnapRepository(); repo != nil {
+				return repo, nil
+			}
+			return nil, nil
+		}
+		return newUbuntuStoreSnapRepositoryForURI(src.URI)
+	case SourceTypeLocal:
+		if repo := NewLocalSnapRepository(src.URI); repo != nil {
+			return repo, nil
+		}
+	case SourceTypeOffline:
+		if repo := NewOfflineSnapRepository(src.URI); repo != nil {
+			return repo, nil
+		}
+	default:
+		return nil, &ErrInvalidSource{source: *src, msg: fmt.Sprintf("unknown type %q", src.Type)}
+	}
+
+	return nil, nil
+}
+
+// newMetaRepositoryForSources returns a MetaRepository with the
+// repositories of the configured sources of the given types
+func newMetaRepositoryForSources(types ...SourceType) *MetaRepository {
+	m := new(MetaRepository)
+	m.all = []Repository{}
+
+	// no fallback to the defaults here, they may enable a store
+	// that was deliberately disabled
+	sources, err := Sources()
+	if err != nil {
+		log.Printf("WARNING: can not read sources: %s", err)
+		return m
+	}
+
+	for _, src := range sources {
+		if !sourceTypeIn(src.Type, types) {
+			continue
+		}
+
+		// its ok if repos fail if e.g. no dbus is available
+		repo, err := src.Repository()
+		if err != nil {
+			log.Printf("WARNING: skipping source %s: %s", src.Name, err)
+			continue
+		}
+		if repo != nil {
+			m.all = append(m.all, repo)
+		}
+	}
+
+	return m
+}
+
+func sourceTypeIn(t SourceType, types []SourceType) bool {
+	for _, t2 := range types {
+		if t == t2 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "launchpad.net/gocheck"
+)
+
+func (s *SnapTestSuite) writeSourcesFile(c *C, name, content string) {
+	c.Assert(os.MkdirAll(snapSourcesDir, 0755), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(snapSourcesDir, name), []byte(content), 0644), IsNil)
+}
+
+func sourceNames(sources []Source) []string {
+	names := make([]string, len(sources))
+	for i, src := range sources {
+		names[i] = src.Name
+	}
+
+	return names
+}
+
+func (s *SnapTestSuite) TestSourcesDefault(c *C) {
+	sources, err := Sources()
+	c.Assert(err, IsNil)
+	c.Check(sourceNames(sources), DeepEquals, []string{"system-image", "ubuntu-store", "apps", "oem"})
+	c.Check(sources[2].URI, Equals, snapAppsDir)
+}
+
+func (s *SnapTestSuite) TestSourcesConfigured(c *C) {
+	s.writeSourcesFile(c, "10-mirror.yaml", `sources:
+ - name: mirror
+   type: store
+   uri: http://mirror.example.com/api/v1/
+   priority: 10
+ - name: ubuntu-store
+   type: store
+   enabled: false
+`)
+	s.writeSourcesFile(c, "20-usb.yaml", `sources:
+ - name: usb
+   type: local
+   uri: /media/usb/apps
+`)
+
+	sources, err := Sources()
+	c.Assert(err, IsNil)
+	c.Check(sourceNames(sources), DeepEquals, []string{"mirror", "system-image", "apps", "oem", "usb"})
+	c.Check(sources[0].URI, Equals, "http://mirror.example.com/api/v1/")
+}
+
+func (s *SnapTestSuite) TestSourcesLaterFileOverrides(c *C) {
+	s.writeSourcesFile(c, "10-a.yaml", `sources:
+ - name: mirror
+   type: store
+   uri: http://a.example.com/
+`)
+	s.writeSourcesFile(c, "20-b.yaml", `sources:
+ - name: mirror
+   type: store
+   uri: http://b.example.com/
+`)
+
+	sources, err := Sources()
+	c.Assert(err, IsNil)
+	c.Assert(sources, HasLen, 5)
+	c.Check(sources[4].URI, Equals, "http://b.example.com/")
+}
+
+func (s *SnapTestSuite) TestSourcesInvalid(c *C) {
+	_, err := parseSourcesYaml([]byte(`sources:
+ - name: foo
+   type: ftp
+`))
+	c.Check(err, ErrorMatches, `invalid source "foo": unknown type "ftp"`)
+
+	_, err = parseSourcesYaml([]byte(`sources:
+ - type: store
+`))
+	c.Check(err, ErrorMatches, `invalid source "": missing name`)
+
+	_, err = parseSourcesYaml([]byte(`sources:
+ - name: foo
+   type: local
+`))
+	c.Check(err, ErrorMatches, `invalid source "foo": missing uri`)
+}
+
+func (s *SnapTestSuite) TestSourcesBrokenConfigIsSkipped(c *C) {
+	s.writeSourcesFile(c, "10-no-store.yaml", `sources:
+ - name: ubuntu-store
+   type: store
+   enabled: false
+`)
+	s.writeSourcesFile(c, "20-broken.yaml", "sources: [")
+
+	sources, err := Sources()
+	c.Assert(err, IsNil)
+	for _, src := range sources {
+		c.Check(src.Type, Not(Equals), SourceTypeStore)
+	}
+
+	// system-image and apps (there is no oem dir), the disabled store
+	// stays disabled
+	c.Assert(os.MkdirAll(snapAppsDir, 0755), IsNil)
+	m := NewMetaRepository()
+	c.Check(m.all, HasLen, 2)
+}
+
+func (s *SnapTestSuite) TestMetaRepositoryConfiguredLocalSource(c *C) {
+	otherRoot := c.MkDir()
+	_, err := makeInstalledMockSnap(otherRoot, "")
+	c.Assert(err, IsNil)
+
+	s.writeSourcesFile(c, "10-other.yaml", `sources:
+ - name: other
+   type: local
+   uri: `+filepath.Join(otherRoot, "apps")+`
+`)
+
+	parts, err := NewMetaLocalRepository().Details("hello-app")
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 1)
+	c.Check(parts[0].Name(), Equals, "hello-app")
+}
+
+func (s *SnapTestSuite) TestMetaStoreRepositoryConfiguredStore(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, Equals, "/api/v1/package/"+funkyAppName+"."+funkyAppOrigin)
+		io.WriteString(w, MockDetailsJSON)
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	s.writeSourcesFile(c, "10-mirror.yaml", `sources:
+ - name: mirror
+   type: store
+   uri: `+mockServer.URL+`/api/v1/
+ - name: ubuntu-store
+   type: store
+   enabled: false
+`)
+
+	m := NewMetaStoreRepository()
+	c.Assert(m.all, HasLen, 1)
+
+	parts, err := m.Details(funkyAppName + "." + funkyAppOrigin)
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 1)
+	c.Check(parts[0].Name(), Equals, funkyAppName)
+}
+
+func (s *SnapTestSuite) TestSearchCollectsSourceErrors(c *C) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", 500)
+	}))
+	c.Assert(mockServer, NotNil)
+	defer mockServer.Close()
+
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	s.writeSourcesFile(c, "10-broken-store.yaml", `sources:
+ - name: ubuntu-store
+   type: store
+   uri: `+mockServer.URL+`/api/v1/
+ - name: usb
+   type: offline
+   uri: `+repoDir+`
+`)
+
+	results, err := Search([]string{"fo"})
+	c.Assert(err, FitsTypeOf, &ErrSearchFailed{})
+	c.Assert(results, HasLen, 1)
+	c.Check(results["foo"].Parts[0].Version(), Equals, "1.0")
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"launchpad.net/snappy/helpers"
+)
+
+var (
+	// storeMetadataMaxAge is how long cached store metadata is used
+	// without asking the store again
+	storeMetadataMaxAge = 5 * time.Minute
+
+	// storeMetadataMaxStale is how long cached store metadata is used
+	// (with a warning) when the store can not be reached
+	storeMetadataMaxStale = 24 * time.Hour
+
+	// refreshStoreMetadata bypasses the cache
+	refreshStoreMetadata bool
+)
+
+// SetMetadataRefresh makes snappy ask the store for fresh metadata
+// instead of using its cache (the cache is still updated)
+func SetMetadataRefresh(refresh bool) {
+	refreshStoreMetadata = refresh
+}
+
+// cachedStoreResponse is a store response in the metadata cache
+type cachedStoreResponse struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last-modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Body         []byte    `json:"body"`
+}
+
+// storeCacheFile returns the cache file for the given request, the
+// store headers are part of the key as the answer depends on them
+func storeCacheFile(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.String() + "\n"))
+
+	var headers []string
+	for k, v := range req.Header {
+		if k == "Accept" || strings.HasPrefix(k, "X-Ubuntu-") {
+			headers = append(headers, k+": "+strings.Join(v, ","))
+		}
+	}
+	if req.Header.Get("Authorization") != "" {
+		headers = append(headers, "Authorization")
+	}
+	sort.Strings(headers)
+	h.Write([]byte(strings.Join(headers, "\n") + "\n\n"))
+	h.Write(body)
+
+	return filepath.Join(snapMetadataCacheDir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+func readCachedStoreResponse(fn string) *cachedStoreResponse {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil
+	}
+
+	var cached cachedStoreResponse
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil
+	}
+
+	return &cached
+}
+
+// writeCachedStoreResponse stores the response, failing to do so is not
+// an error (e.g. the cache is not writable for normal users). Responses
+// may be for authenticated requests, so only root can read them.
+func writeCachedStoreResponse(fn string, cached *cachedStoreResponse) {
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+
+	if err := helpers.EnsureDir(snapMetadataCacheDir, 0755); err != nil {
+		return
+	}
+	helpers.AtomicWriteFile(fn, data, 0600)
+
+	pruneStoreCache()
+}
+
+// pruneStoreCache removes the cached responses that are too old to be
+// used even when the store can not be reached
+func pruneStoreCache() {
+	matches, err := filepath.Glob(filepath.Join(snapMetadataCacheDir, "*.json"))
+	if err != nil {
+		return
+	}
+
+	for _, fn := range matches {
+		st, err := os.Stat(fn)
+		if err == nil && time.Since(st.ModTime()) > storeMetadataMaxStale {
+			os.Remove(fn)
+		}
+	}
+}
+
+// cachedStoreRequest does the given store request (with the given
+// request body), using the metadata cache if possible. It returns the
+// status code and the body of the response.
+//
+// Cached data is used as is for storeMetadataMaxAge, after that it is
+// revalidated with its ETag/Last-Modified date. If the store can not be
+// reached cached data up to storeMetadataMaxStale old is used.
+func cachedStoreRequest(req *http.Request, body []byte) (int, []byte, error) {
+	fn := storeCacheFile(req, body)
+
+	var cached *cachedStoreResponse
+	if !refreshStoreMetadata {
+		cached = readCachedStoreResponse(fn)
+	}
+	if cached != nil {
+		if time.Since(cached.Fetched) < storeMetadataMaxAge {
+			return 200, cached.Body, nil
+		}
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	useStale := func(err error) bool {
+		if cached == nil || time.Since(cached.Fetched) > storeMetadataMaxStale {
+			return false
+		}
+		log.Printf("WARNING: can not reach the store (%s), using data from %s", err, cached.Fetched.Format(time.RFC1123))
+		return true
+	}
+
+	resp, err := httpDo(req)
+	if err != nil {
+		if isNetworkError(err) && useStale(err) {
+			return 200, cached.Body, nil
+		}
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 304 && cached != nil {
+		cached.Fetched = time.Now()
+		writeCachedStoreResponse(fn, cached)
+		return 200, cached.Body, nil
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		if useStale(err) {
+			return 200, cached.Body, nil
+		}
+		return 0, nil, err
+	}
+
+	switch {
+	case resp.StatusCode == 200:
+		writeCachedStoreResponse(fn, &cachedStoreResponse{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			Fetched:      time.Now(),
+			Body:         respBody,
+		})
+	case resp.StatusCode >= 500:
+		if useStale(fmt.Errorf("unexpected http statusCode %v", resp.StatusCode)) {
+			return 200, cached.Body, nil
+		}
+	}
+
+	return resp.StatusCode, respBody, nil
+}
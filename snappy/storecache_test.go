@@ -0,0 +1,154 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"launchpad.net/snappy/helpers"
+
+	. "launchpad.net/gocheck"
+)
+
+// mockCachingStore serves MockDetailsJSON with an ETag and counts the
+// requests and the ones that were answered with a 304
+type mockCachingStore struct {
+	server      *httptest.Server
+	requests    int
+	notModified int
+}
+
+func (s *SnapTestSuite) newMockCachingStore(c *C) *mockCachingStore {
+	store := &mockCachingStore{}
+	store.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store.requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			store.notModified++
+			w.WriteHeader(304)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, MockDetailsJSON)
+	}))
+
+	var err error
+	storeDetailsURI, err = url.Parse(store.server.URL + "/details/")
+	c.Assert(err, IsNil)
+
+	return store
+}
+
+func (s *SnapTestSuite) TestStoreCacheServesFreshData(c *C) {
+	store := s.newMockCachingStore(c)
+	defer store.server.Close()
+
+	repo := NewUbuntuStoreSnapRepository()
+	for i := 0; i < 2; i++ {
+		parts, err := repo.Details(funkyAppName)
+		c.Assert(err, IsNil)
+		c.Assert(parts, HasLen, 1)
+		c.Check(parts[0].Version(), Equals, "42")
+	}
+	c.Check(store.requests, Equals, 1)
+}
+
+func (s *SnapTestSuite) TestStoreCacheRevalidates(c *C) {
+	defer func(d time.Duration) { storeMetadataMaxAge = d }(storeMetadataMaxAge)
+	storeMetadataMaxAge = 0
+
+	store := s.newMockCachingStore(c)
+	defer store.server.Close()
+
+	repo := NewUbuntuStoreSnapRepository()
+	for i := 0; i < 2; i++ {
+		parts, err := repo.Details(funkyAppName)
+		c.Assert(err, IsNil)
+		c.Assert(parts, HasLen, 1)
+		c.Check(parts[0].Version(), Equals, "42")
+	}
+	c.Check(store.requests, Equals, 2)
+	c.Check(store.notModified, Equals, 1)
+}
+
+func (s *SnapTestSuite) TestStoreCacheOffline(c *C) {
+	defer func(d time.Duration) { storeMetadataMaxAge = d }(storeMetadataMaxAge)
+	storeMetadataMaxAge = 0
+
+	store := s.newMockCachingStore(c)
+	repo := NewUbuntuStoreSnapRepository()
+	_, err := repo.Details(funkyAppName)
+	c.Assert(err, IsNil)
+
+	// the cached data is used when the store is gone
+	store.server.Close()
+	parts, err := repo.Details(funkyAppName)
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 1)
+	c.Check(parts[0].Version(), Equals, "42")
+
+	// but not forever
+	defer func(d time.Duration) { storeMetadataMaxStale = d }(storeMetadataMaxStale)
+	storeMetadataMaxStale = 0
+	_, err = repo.Details(funkyAppName)
+	c.Assert(err, NotNil)
+}
+
+func (s *SnapTestSuite) TestStoreCacheRefresh(c *C) {
+	defer SetMetadataRefresh(false)
+
+	store := s.newMockCachingStore(c)
+	defer store.server.Close()
+
+	repo := NewUbuntuStoreSnapRepository()
+	_, err := repo.Details(funkyAppName)
+	c.Assert(err, IsNil)
+
+	SetMetadataRefresh(true)
+	_, err = repo.Details(funkyAppName)
+	c.Assert(err, IsNil)
+	c.Check(store.requests, Equals, 2)
+	c.Check(store.notModified, Equals, 0)
+}
+
+func (s *SnapTestSuite) TestStoreCachePrunesOldEntries(c *C) {
+	c.Assert(os.MkdirAll(snapMetadataCacheDir, 0755), IsNil)
+	old := filepath.Join(snapMetadataCacheDir, "old.json")
+	c.Assert(ioutil.WriteFile(old, []byte("{}"), 0600), IsNil)
+	longAgo := time.Now().Add(-storeMetadataMaxStale - time.Hour)
+	c.Assert(os.Chtimes(old, longAgo, longAgo), IsNil)
+
+	store := s.newMockCachingStore(c)
+	defer store.server.Close()
+	_, err := NewUbuntuStoreSnapRepository().Details(funkyAppName)
+	c.Assert(err, IsNil)
+
+	c.Check(helpers.FileExists(old), Equals, false)
+	matches, err := filepath.Glob(filepath.Join(snapMetadataCacheDir, "*.json"))
+	c.Assert(err, IsNil)
+	c.Assert(matches, HasLen, 1)
+	st, err := os.Stat(matches[0])
+	c.Assert(err, IsNil)
+	c.Check(st.Mode().Perm(), Equals, os.FileMode(0600))
+}
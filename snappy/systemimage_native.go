@@ -23,7 +23,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"os/exec"
 	"path"
@@ -76,7 +75,7 @@ func systemImageClientCheckForUpdates(configFile string) (us updateStatus, err e
 
 	indexURL := systemImageServer + "/" + path.Join(channel, device, "index.json")
 
-	resp, err := http.Get(indexURL)
+	resp, err := httpGet(indexURL)
 	if err != nil {
 		return us, err
 	}
@@ -59,3 +59,45 @@ func (t Timeout) String() string {
 func (t Timeout) Seconds() float64 {
 	return time.Duration(t).Seconds()
 }
+
+// SecondsTimeout is a Timeout that is a plain number of seconds, or a
+// duration like "500ms", in yaml
+type SecondsTimeout Timeout
+
+// MarshalJSON is from the json.Marshaler interface
+func (t SecondsTimeout) MarshalJSON() ([]byte, error) {
+	return Timeout(t).MarshalJSON()
+}
+
+// UnmarshalJSON is from the json.Unmarshaler interface
+func (t *SecondsTimeout) UnmarshalJSON(buf []byte) error {
+	return (*Timeout)(t).UnmarshalJSON(buf)
+}
+
+// UnmarshalYAML is from the yaml.Unmarshaler interface
+func (t *SecondsTimeout) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var secs int64
+	if err := unmarshal(&secs); err == nil {
+		*t = SecondsTimeout(time.Duration(secs) * time.Second)
+		return nil
+	}
+
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+
+	dur, err := time.ParseDuration(str)
+	if err != nil {
+		return err
+	}
+
+	*t = SecondsTimeout(dur)
+
+	return nil
+}
+
+// String returns a string representing the duration
+func (t SecondsTimeout) String() string {
+	return time.Duration(t).String()
+}
@@ -21,6 +21,8 @@ import (
 	"encoding/json"
 	"time"
 
+	"gopkg.in/yaml.v2"
+
 	. "launchpad.net/gocheck"
 )
 
@@ -45,3 +47,18 @@ func (s *SnapTestSuite) TestTimeoutUnmarshal(c *C) {
 	c.Assert(json.Unmarshal([]byte(`{"T": "17ms"}`), &t), IsNil)
 	c.Check(t, DeepEquals, testT{T: Timeout(17 * time.Millisecond)})
 }
+
+func (s *SnapTestSuite) TestSecondsTimeoutUnmarshalYAML(c *C) {
+	for yamlValue, timeout := range map[string]time.Duration{
+		"25":    25 * time.Second,
+		"25s":   25 * time.Second,
+		"500ms": 500 * time.Millisecond,
+	} {
+		var t struct{ T SecondsTimeout }
+		c.Assert(yaml.Unmarshal([]byte("t: "+yamlValue), &t), IsNil)
+		c.Check(time.Duration(t.T), Equals, timeout, Commentf(yamlValue))
+	}
+
+	var t struct{ T SecondsTimeout }
+	c.Check(yaml.Unmarshal([]byte("t: forever"), &t), NotNil)
+}
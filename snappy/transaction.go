@@ -0,0 +1,258 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"launchpad.net/snappy/helpers"
+	"launchpad.net/snappy/progress"
+
+	"gopkg.in/yaml.v2"
+)
+
+// the states of an update transaction
+const (
+	transactionRunning    = "running"
+	transactionCommitted  = "committed"
+	transactionRolledBack = "rolled-back"
+)
+
+// transactionEntry is a part that is updated in a transaction
+type transactionEntry struct {
+	Name       string `yaml:"name"`
+	Namespace  string `yaml:"namespace,omitempty"`
+	OldVersion string `yaml:"old-version,omitempty"`
+	NewVersion string `yaml:"new-version"`
+	// Started is set before the install begins, Activated once the
+	// new version is active
+	Started   bool `yaml:"started"`
+	Activated bool `yaml:"activated"`
+}
+
+// fullName returns the name.namespace of the entry
+func (e *transactionEntry) fullName() string {
+	if e.Namespace == "" {
+		return e.Name
+	}
+
+	return e.Name + "." + e.Namespace
+}
+
+// transactionJournal is the on-disk record of an update transaction
+type transactionJournal struct {
+	State   string             `yaml:"state"`
+	Entries []transactionEntry `yaml:"entries"`
+}
+
+func readTransactionJournal() (*transactionJournal, error) {
+	yamlData, err := ioutil.ReadFile(snapTransactionJournalFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var journal transactionJournal
+	if err := yaml.Unmarshal(yamlData, &journal); err != nil {
+		return nil, err
+	}
+
+	return &journal, nil
+}
+
+func (j *transactionJournal) write() error {
+	yamlData, err := yaml.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	if err := helpers.EnsureDir(filepath.Dir(snapTransactionJournalFile), 0755); err != nil {
+		return err
+	}
+
+	return helpers.AtomicWriteFile(snapTransactionJournalFile, yamlData, 0644)
+}
+
+// UpdateTransaction installs a set of parts all-or-nothing: if one of
+// them fails the ones that were already installed are reverted to their
+// previous version. Every step is recorded in a journal so that an
+// interrupted transaction is undone by RecoverUpdateTransaction.
+type UpdateTransaction struct {
+	journal transactionJournal
+}
+
+// NewUpdateTransaction starts a transaction that updates the given
+// parts. An interrupted earlier transaction is recovered first.
+func NewUpdateTransaction(parts []Part, pbar progress.Meter) (*UpdateTransaction, error) {
+	if err := RecoverUpdateTransaction(pbar); err != nil {
+		return nil, err
+	}
+
+	t := &UpdateTransaction{journal: transactionJournal{State: transactionRunning}}
+	for _, part := range parts {
+		entry := transactionEntry{
+			Name:       part.Name(),
+			Namespace:  part.Namespace(),
+			NewVersion: part.Version(),
+		}
+		if current := ActiveSnapByName(part.Name()); current != nil {
+			entry.OldVersion = current.Version()
+		}
+		t.journal.Entries = append(t.journal.Entries, entry)
+	}
+
+	if err := t.journal.write(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Install installs the given part, which must be one of the parts of
+// the transaction
+func (t *UpdateTransaction) Install(part Part, pbar progress.Meter, flags InstallFlags) error {
+	var entry *transactionEntry
+	for i := range t.journal.Entries {
+		if t.journal.Entries[i].Name == part.Name() && t.journal.Entries[i].Namespace == part.Namespace() {
+			entry = &t.journal.Entries[i]
+			break
+		}
+	}
+	if entry == nil {
+		return fmt.Errorf("%s is not part of the update transaction", part.Name())
+	}
+
+	entry.Started = true
+	if err := t.journal.write(); err != nil {
+		return err
+	}
+
+	if _, err := part.Install(pbar, flags); err != nil {
+		return err
+	}
+
+	if current := ActiveSnapByName(part.Name()); current != nil {
+		entry.NewVersion = current.Version()
+	}
+	entry.Activated = true
+
+	return t.journal.write()
+}
+
+// Commit ends the transaction, its parts stay installed
+func (t *UpdateTransaction) Commit() error {
+	t.journal.State = transactionCommitted
+
+	return t.journal.write()
+}
+
+// Rollback reverts all parts of the transaction that were installed
+// to their previous version
+func (t *UpdateTransaction) Rollback(pbar progress.Meter) error {
+	if err := t.journal.rollback(pbar); err != nil {
+		return err
+	}
+	t.journal.State = transactionRolledBack
+
+	return t.journal.write()
+}
+
+// rollback reverts the started entries in the reverse order of their
+// installation
+func (j *transactionJournal) rollback(pbar progress.Meter) error {
+	var errs []string
+	for i := len(j.Entries) - 1; i >= 0; i-- {
+		entry := &j.Entries[i]
+		if !entry.Started {
+			continue
+		}
+		if err := revertTransactionEntry(entry, pbar); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", entry.Name, err))
+			continue
+		}
+		entry.Activated = false
+	}
+
+	if len(errs) > 0 {
+		return &ErrRollbackFailed{errs: errs}
+	}
+
+	return nil
+}
+
+// revertTransactionEntry makes the old version of the entry active
+// again, or deactivates the new version if there was no old one
+func revertTransactionEntry(entry *transactionEntry, pbar progress.Meter) error {
+	current := ActiveSnapByName(entry.Name)
+	if current == nil || current.Version() == entry.OldVersion {
+		return nil
+	}
+
+	if entry.OldVersion != "" {
+		_, err := Rollback(entry.fullName(), entry.OldVersion, pbar)
+		return err
+	}
+
+	snap, ok := current.(*SnapPart)
+	if !ok {
+		return ErrInstalledNonSnapPart
+	}
+
+	return unsetActiveClick(snap.basedir, false, pbar)
+}
+
+// RecoverUpdateTransaction finishes an update transaction that was
+// interrupted (e.g. by a crash or a power loss): if all of its parts were
+// installed it is committed, otherwise it is rolled back.
+func RecoverUpdateTransaction(pbar progress.Meter) error {
+	journal, err := readTransactionJournal()
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if journal.State != transactionRunning {
+		return nil
+	}
+
+	done := true
+	for _, entry := range journal.Entries {
+		if !entry.Activated {
+			done = false
+			break
+		}
+	}
+
+	if done {
+		log.Printf("WARNING: finishing interrupted update transaction")
+		journal.State = transactionCommitted
+		return journal.write()
+	}
+
+	log.Printf("WARNING: rolling back interrupted update transaction")
+	if err := journal.rollback(pbar); err != nil {
+		return err
+	}
+	journal.State = transactionRolledBack
+
+	return journal.write()
+}
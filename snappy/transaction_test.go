@@ -0,0 +1,147 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"io/ioutil"
+
+	"launchpad.net/snappy/helpers"
+
+	. "launchpad.net/gocheck"
+)
+
+// setupTransaction installs version 1.0 of foo and baz and returns
+// parts for their version 2.0
+func (s *SnapTestSuite) setupTransaction(c *C) []Part {
+	for _, name := range []string{"foo", "baz"} {
+		snapFile := makeTestSnapPackage(c, "name: "+name+"\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+		_, err := installClick(snapFile, 0, nil, "bar")
+		c.Assert(err, IsNil)
+	}
+
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 2.0\nvendor: Foo <foo@example.com>\n", "name: baz\nversion: 2.0\nvendor: Foo <foo@example.com>\n")
+	repo := NewOfflineSnapRepository(repoDir)
+	c.Assert(repo, NotNil)
+
+	var parts []Part
+	for _, name := range []string{"foo", "baz"} {
+		found, err := repo.Details(name)
+		c.Assert(err, IsNil)
+		parts = append(parts, found[0])
+	}
+
+	return parts
+}
+
+func (s *SnapTestSuite) TestUpdateTransactionCommit(c *C) {
+	parts := s.setupTransaction(c)
+
+	t, err := NewUpdateTransaction(parts, nil)
+	c.Assert(err, IsNil)
+	for _, part := range parts {
+		c.Assert(t.Install(part, nil, 0), IsNil)
+	}
+	c.Assert(t.Commit(), IsNil)
+
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "2.0")
+	c.Check(ActiveSnapByName("baz").Version(), Equals, "2.0")
+
+	journal, err := readTransactionJournal()
+	c.Assert(err, IsNil)
+	c.Check(journal.State, Equals, transactionCommitted)
+	c.Check(journal.Entries[0].OldVersion, Equals, "1.0")
+	c.Check(journal.Entries[0].Activated, Equals, true)
+}
+
+func (s *SnapTestSuite) TestUpdateTransactionRollback(c *C) {
+	parts := s.setupTransaction(c)
+	// break the snap of baz
+	c.Assert(ioutil.WriteFile(parts[1].(*OfflineSnapPart).snapFile(), []byte("garbage"), 0644), IsNil)
+
+	t, err := NewUpdateTransaction(parts, nil)
+	c.Assert(err, IsNil)
+	c.Assert(t.Install(parts[0], nil, 0), IsNil)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "2.0")
+	c.Assert(t.Install(parts[1], nil, 0), NotNil)
+
+	c.Assert(t.Rollback(nil), IsNil)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "1.0")
+	c.Check(ActiveSnapByName("baz").Version(), Equals, "1.0")
+
+	journal, err := readTransactionJournal()
+	c.Assert(err, IsNil)
+	c.Check(journal.State, Equals, transactionRolledBack)
+}
+
+func (s *SnapTestSuite) TestUpdateParts(c *C) {
+	parts := s.setupTransaction(c)
+
+	meter := &MockProgressMeter{}
+	c.Assert(UpdateParts(parts, 2, 0, meter), IsNil)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "2.0")
+	c.Check(ActiveSnapByName("baz").Version(), Equals, "2.0")
+	c.Check(meter.notified, DeepEquals, []string{"Installing foo (2.0)", "Installing baz (2.0)"})
+}
+
+func (s *SnapTestSuite) TestUpdatePartsAllOrNothing(c *C) {
+	parts := s.setupTransaction(c)
+	c.Assert(ioutil.WriteFile(parts[1].(*OfflineSnapPart).snapFile(), []byte("garbage"), 0644), IsNil)
+
+	c.Assert(UpdateParts(parts, 2, 0, &MockProgressMeter{}), NotNil)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "1.0")
+	c.Check(ActiveSnapByName("baz").Version(), Equals, "1.0")
+}
+
+func (s *SnapTestSuite) TestRecoverUpdateTransactionUndo(c *C) {
+	parts := s.setupTransaction(c)
+
+	t, err := NewUpdateTransaction(parts, nil)
+	c.Assert(err, IsNil)
+	c.Assert(t.Install(parts[0], nil, 0), IsNil)
+
+	// the process is gone before baz is installed
+	c.Assert(RecoverUpdateTransaction(nil), IsNil)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "1.0")
+
+	journal, err := readTransactionJournal()
+	c.Assert(err, IsNil)
+	c.Check(journal.State, Equals, transactionRolledBack)
+}
+
+func (s *SnapTestSuite) TestRecoverUpdateTransactionFinish(c *C) {
+	parts := s.setupTransaction(c)
+
+	t, err := NewUpdateTransaction(parts, nil)
+	c.Assert(err, IsNil)
+	for _, part := range parts {
+		c.Assert(t.Install(part, nil, 0), IsNil)
+	}
+
+	// the process is gone before the commit
+	c.Assert(RecoverUpdateTransaction(nil), IsNil)
+	c.Check(ActiveSnapByName("foo").Version(), Equals, "2.0")
+
+	journal, err := readTransactionJournal()
+	c.Assert(err, IsNil)
+	c.Check(journal.State, Equals, transactionCommitted)
+}
+
+func (s *SnapTestSuite) TestRecoverUpdateTransactionNoJournal(c *C) {
+	c.Assert(RecoverUpdateTransaction(nil), IsNil)
+	c.Check(helpers.FileExists(snapTransactionJournalFile), Equals, false)
+}
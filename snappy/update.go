@@ -0,0 +1,158 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"launchpad.net/snappy/progress"
+)
+
+// fetcher is a Part whose snap can be downloaded (and verified) ahead of
+// installing it
+type fetcher interface {
+	Part
+	fetch(pbar progress.Meter) (string, error)
+	installFetched(snapFile string, pbar progress.Meter, flags InstallFlags) (string, error)
+}
+
+// DownloadedPart is a Part that is ready to be installed, its snap was
+// downloaded and verified by DownloadParts
+type DownloadedPart struct {
+	Part
+	snapFile string
+}
+
+// Install installs the downloaded snap. Parts that can not be
+// downloaded ahead (e.g. system image updates) are installed as usual.
+func (p *DownloadedPart) Install(pbar progress.Meter, flags InstallFlags) (string, error) {
+	f, ok := p.Part.(fetcher)
+	if !ok || p.snapFile == "" {
+		return p.Part.Install(pbar, flags)
+	}
+	defer p.Discard()
+
+	return f.installFetched(p.snapFile, pbar, flags)
+}
+
+// Discard removes the downloaded snap if it was not installed
+func (p *DownloadedPart) Discard() {
+	if p.snapFile != "" {
+		os.Remove(p.snapFile)
+		p.snapFile = ""
+	}
+}
+
+// DownloadParts downloads the given parts with up to "workers"
+// concurrent downloads and shows their progress as one on the given
+// Meter. Nothing should be installed before all downloads passed the
+// verification, so if any download fails the others are discarded and
+// the error is returned.
+func DownloadParts(parts []Part, workers int, pbar progress.Meter) ([]*DownloadedPart, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	downloaded := make([]*DownloadedPart, len(parts))
+	errs := make([]error, len(parts))
+
+	multi := progress.NewMultiProgress(pbar)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				downloaded[i] = &DownloadedPart{Part: parts[i]}
+				f, ok := parts[i].(fetcher)
+				if !ok {
+					continue
+				}
+				snapFile, err := f.fetch(multi.Child())
+				if err != nil {
+					errs[i] = &ErrDownloadFailed{snap: parts[i].Name(), origErr: err}
+					continue
+				}
+				downloaded[i].snapFile = snapFile
+			}
+		}()
+	}
+
+	for i := range parts {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	multi.Finished()
+
+	for _, err := range errs {
+		if err != nil {
+			for _, p := range downloaded {
+				p.Discard()
+			}
+			return nil, err
+		}
+	}
+
+	return downloaded, nil
+}
+
+// UpdateParts updates the given parts: they are all downloaded (and
+// verified) first, then installed in one UpdateTransaction so that
+// either all of them are updated or none, and then their old versions
+// are garbage collected
+func UpdateParts(parts []Part, workers int, flags InstallFlags, meter progress.Meter) error {
+	downloaded, err := DownloadParts(parts, workers, meter)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, part := range downloaded {
+			part.Discard()
+		}
+	}()
+
+	t, err := NewUpdateTransaction(parts, meter)
+	if err != nil {
+		return err
+	}
+	for _, part := range downloaded {
+		meter.Notify(fmt.Sprintf("Installing %s (%s)", part.Name(), part.Version()))
+		if err := t.Install(part, meter, flags); err != nil {
+			meter.Notify(fmt.Sprintf("Installing %s failed, reverting the updates", part.Name()))
+			if rerr := t.Rollback(meter); rerr != nil {
+				return fmt.Errorf("%s (and %s)", err, rerr)
+			}
+			return err
+		}
+	}
+	if err := t.Commit(); err != nil {
+		return err
+	}
+
+	for _, part := range downloaded {
+		if err := GarbageCollect(part.Name(), flags); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
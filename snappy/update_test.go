@@ -0,0 +1,112 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package snappy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"launchpad.net/snappy/helpers"
+
+	. "launchpad.net/gocheck"
+)
+
+// makeRemoteParts returns RemoteSnapParts for the given snap names that
+// are served by the returned server
+func (s *SnapTestSuite) makeRemoteParts(c *C, names ...string) ([]Part, *httptest.Server) {
+	snaps := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, snaps[strings.TrimPrefix(r.URL.Path, "/")])
+	}))
+
+	var parts []Part
+	for _, name := range names {
+		snapFile := makeTestSnapPackage(c, fmt.Sprintf("name: %s\nversion: 1.0\nvendor: Foo <foo@example.com>\n", name))
+		snaps[name] = snapFile
+		sha512, err := helpers.Sha512sum(snapFile)
+		c.Assert(err, IsNil)
+
+		parts = append(parts, NewRemoteSnapPart(remoteSnap{
+			Name:            name,
+			Namespace:       "bar",
+			Version:         "1.0",
+			AnonDownloadURL: server.URL + "/" + name,
+			DownloadSha512:  sha512,
+		}))
+	}
+
+	return parts, server
+}
+
+func (s *SnapTestSuite) TestDownloadParts(c *C) {
+	parts, server := s.makeRemoteParts(c, "foo", "bar", "baz")
+	defer server.Close()
+
+	p := &MockProgressMeter{}
+	downloaded, err := DownloadParts(parts, 2, p)
+	c.Assert(err, IsNil)
+	c.Assert(downloaded, HasLen, 3)
+	c.Check(p.finished, Equals, true)
+
+	for i, part := range downloaded {
+		c.Check(part.Name(), Equals, parts[i].Name())
+		c.Check(helpers.FileExists(part.snapFile), Equals, true)
+	}
+
+	for _, part := range downloaded {
+		name, err := part.Install(&MockProgressMeter{}, 0)
+		c.Assert(err, IsNil)
+		c.Check(name, Equals, part.Name())
+		c.Check(ActiveSnapByName(part.Name()), NotNil)
+	}
+}
+
+func (s *SnapTestSuite) TestDownloadPartsVerifiesAll(c *C) {
+	parts, server := s.makeRemoteParts(c, "foo", "bar", "baz")
+	defer server.Close()
+	parts[1].(*RemoteSnapPart).pkg.DownloadSha512 = "bad"
+
+	downloaded, err := DownloadParts(parts, 3, &MockProgressMeter{})
+	c.Assert(err, FitsTypeOf, &ErrDownloadFailed{})
+	c.Check(err.Error(), Matches, "bar failed to download: sha512 mismatch .*")
+	c.Check(downloaded, IsNil)
+
+	// nothing is left behind
+	files, err := ioutil.ReadDir(snapDownloadCacheDir)
+	c.Assert(err, IsNil)
+	c.Check(files, HasLen, 0)
+}
+
+func (s *SnapTestSuite) TestDownloadPartsNotFetchable(c *C) {
+	repoDir := s.makeOfflineRepo(c, "name: foo\nversion: 1.0\nvendor: Foo <foo@example.com>\n")
+	parts, err := NewOfflineSnapRepository(repoDir).Details("foo")
+	c.Assert(err, IsNil)
+
+	// offline parts are not downloaded, just installed
+	downloaded, err := DownloadParts(parts, 1, &MockProgressMeter{})
+	c.Assert(err, IsNil)
+	c.Assert(downloaded, HasLen, 1)
+	c.Check(downloaded[0].snapFile, Equals, "")
+
+	name, err := downloaded[0].Install(&MockProgressMeter{}, 0)
+	c.Assert(err, IsNil)
+	c.Check(name, Equals, "foo")
+}
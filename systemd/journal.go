@@ -0,0 +1,200 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"launchpad.net/snappy/helpers"
+)
+
+// LogOptions are the options of Logs
+type LogOptions struct {
+	// Lines is the number of the most recent messages to show, all
+	// messages if it is 0
+	Lines int
+	// Follow keeps showing new messages as they are logged
+	Follow bool
+	// Since only shows messages from then on, in any format journalctl
+	// understands (e.g. "2015-06-01 12:00", "yesterday")
+	Since string
+}
+
+// Log is a message of a service in the journal
+type Log struct {
+	Time        time.Time
+	ServiceName string
+	Message     string
+}
+
+// journal is the output of a running journalctl
+type journal struct {
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	cmd    *exec.Cmd
+	args   []string
+	eof    bool
+}
+
+func (j *journal) Read(p []byte) (int, error) {
+	n, err := j.stdout.Read(p)
+	if err == io.EOF {
+		j.eof = true
+	}
+
+	return n, err
+}
+
+// Close stops journalctl if not all of its output was read, and returns
+// its error if it failed
+func (j *journal) Close() error {
+	if !j.eof {
+		j.cmd.Process.Kill()
+		j.cmd.Wait()
+		return nil
+	}
+
+	if err := j.cmd.Wait(); err != nil {
+		exitCode, _ := helpers.ExitCode(err)
+		return &Error{cmd: j.args, exitCode: exitCode, msg: j.stderr.Bytes()}
+	}
+
+	return nil
+}
+
+// runJournalctl starts journalctl with the given args, its output is
+// read as it is written
+func runJournalctl(args ...string) (io.ReadCloser, error) {
+	j := &journal{args: args}
+	j.cmd = exec.Command("journalctl", args...)
+	j.cmd.Stderr = &j.stderr
+
+	stdout, err := j.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	j.stdout = stdout
+	if err := j.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// JournalctlCmd is called from Logs to actually call out to journalctl.
+// It's exported so it can be overridden by testing.
+var JournalctlCmd = runJournalctl
+
+// journalEntry is what Logs needs of a message of "journalctl -o json"
+type journalEntry struct {
+	RealtimeTimestamp string          `json:"__REALTIME_TIMESTAMP"`
+	Unit              string          `json:"_SYSTEMD_UNIT"`
+	Message           json.RawMessage `json:"MESSAGE"`
+	// AboutUnit is set for the messages of systemd itself about a
+	// unit (e.g. that it was started)
+	AboutUnit string `json:"UNIT"`
+}
+
+// message returns the message of the entry, journalctl writes messages
+// that are not valid utf-8 as a list of bytes
+func (e *journalEntry) message() string {
+	var msg string
+	if err := json.Unmarshal(e.Message, &msg); err == nil {
+		return msg
+	}
+
+	var bs []int
+	if err := json.Unmarshal(e.Message, &bs); err == nil {
+		b := make([]byte, len(bs))
+		for i := range bs {
+			b[i] = byte(bs[i])
+		}
+		return string(b)
+	}
+
+	return ""
+}
+
+// Logs calls f with each message of the given services in the journal,
+// in the order they were logged. With opts.Follow it does not return
+// until journalctl is stopped.
+func Logs(serviceNames []string, opts *LogOptions, f func(log *Log)) error {
+	args := []string{"-o", "json", "--no-pager"}
+	if opts.Lines > 0 {
+		args = append(args, "-n", strconv.Itoa(opts.Lines))
+	}
+	if opts.Follow {
+		args = append(args, "-f")
+	}
+	if opts.Since != "" {
+		args = append(args, "--since", opts.Since)
+	}
+	wanted := make(map[string]bool, len(serviceNames))
+	for _, name := range serviceNames {
+		args = append(args, "-u", name)
+		wanted[name] = true
+	}
+
+	out, err := JournalctlCmd(args...)
+	if err != nil {
+		return err
+	}
+
+	// messages may be longer than a bufio.Scanner takes
+	reader := bufio.NewReader(out)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(bytes.TrimSpace(line)) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			out.Close()
+			return err
+		}
+
+		// e.g. "-- No entries --"
+		if bytes.HasPrefix(line, []byte("-- ")) {
+			continue
+		}
+
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			out.Close()
+			return err
+		}
+
+		serviceName := entry.Unit
+		if !wanted[serviceName] && entry.AboutUnit != "" {
+			serviceName = entry.AboutUnit
+		}
+		usec, _ := strconv.ParseInt(entry.RealtimeTimestamp, 10, 64)
+		f(&Log{
+			Time:        time.Unix(0, usec*int64(time.Microsecond)),
+			ServiceName: serviceName,
+			Message:     entry.message(),
+		})
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (C) 2014-2015 Canonical Ltd
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License version 3 as
+ * published by the Free Software Foundation.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package systemd
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	. "launchpad.net/gocheck"
+)
+
+func (s *SystemdTestSuite) TestLogs(c *C) {
+	var args []string
+	JournalctlCmd = func(a ...string) (io.ReadCloser, error) {
+		args = a
+		return ioutil.NopCloser(strings.NewReader(`{"__REALTIME_TIMESTAMP": "1433160000000000", "_SYSTEMD_UNIT": "foo.service", "MESSAGE": "hello"}
+{"__REALTIME_TIMESTAMP": "1433160001000000", "_SYSTEMD_UNIT": "init.scope", "UNIT": "bar.service", "MESSAGE": "Started bar."}
+{"__REALTIME_TIMESTAMP": "1433160002000000", "_SYSTEMD_UNIT": "bar.service", "MESSAGE": [104, 105, 255]}`)), nil
+	}
+	defer func() { JournalctlCmd = runJournalctl }()
+
+	var logs []Log
+	err := Logs([]string{"foo.service", "bar.service"}, &LogOptions{Lines: 10, Follow: true, Since: "yesterday"}, func(log *Log) {
+		logs = append(logs, *log)
+	})
+	c.Assert(err, IsNil)
+	c.Check(args, DeepEquals, []string{"-o", "json", "--no-pager", "-n", "10", "-f", "--since", "yesterday", "-u", "foo.service", "-u", "bar.service"})
+	c.Assert(logs, HasLen, 3)
+	c.Check(logs[0].Time.Equal(time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)), Equals, true)
+	c.Check(logs[0].ServiceName, Equals, "foo.service")
+	c.Check(logs[0].Message, Equals, "hello")
+	c.Check(logs[1].ServiceName, Equals, "bar.service")
+	c.Check(logs[1].Message, Equals, "Started bar.")
+	c.Check(logs[2].Message, Equals, "hi\xff")
+}
+
+func (s *SystemdTestSuite) TestLogsAll(c *C) {
+	var args []string
+	JournalctlCmd = func(a ...string) (io.ReadCloser, error) {
+		args = a
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	defer func() { JournalctlCmd = runJournalctl }()
+
+	err := Logs([]string{"foo.service"}, &LogOptions{}, func(log *Log) {
+		c.Fatal("unexpected log")
+	})
+	c.Assert(err, IsNil)
+	c.Check(args, DeepEquals, []string{"-o", "json", "--no-pager", "-u", "foo.service"})
+}
+
+func (s *SystemdTestSuite) TestLogsInvalidOutput(c *C) {
+	JournalctlCmd = func(a ...string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("-- No entries --\nnot json\n")), nil
+	}
+	defer func() { JournalctlCmd = runJournalctl }()
+
+	err := Logs([]string{"foo.service"}, &LogOptions{}, func(log *Log) {})
+	c.Check(err, NotNil)
+}
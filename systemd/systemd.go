@@ -24,6 +24,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
@@ -64,7 +67,23 @@ type Systemd interface {
 	Stop(service string, timeout time.Duration) error
 	Kill(service, signal string) error
 	Restart(service string, timeout time.Duration) error
+	Status(service string) (*ServiceStatus, error)
+	SetLimits(service string, limits ResourceLimits) error
 	GenServiceFile(desc *ServiceDescription) string
+	GenSocketFile(desc *ServiceDescription) string
+}
+
+// ServiceStatus is the state of a service as systemd sees it
+type ServiceStatus struct {
+	ServiceName string
+	Enabled     bool
+	ActiveState string
+	SubState    string
+	// MainPID is 0 if the service is not running
+	MainPID int
+	// ActiveSince is when the service became active, it is zero if
+	// it is not
+	ActiveSince time.Time
 }
 
 // ServiceDescription describes a snappy systemd service
@@ -82,12 +101,73 @@ type ServiceDescription struct {
 	IsFramework bool
 	BusName     string
 	UdevAppName string
+	// Restart is the Restart= setting of the service, and
+	// RestartDelay its RestartSec=
+	Restart      string
+	RestartDelay time.Duration
+	// Type is the Type= setting, it is "dbus" for services with a
+	// BusName
+	Type        string
+	Environment map[string]string
+	Limits      ResourceLimits
+	// ListenStreams and ListenDatagrams are the addresses (e.g. "80")
+	// the socket of a socket activated service listens on
+	ListenStreams   []string
+	ListenDatagrams []string
+}
+
+// ResourceLimits are the cgroup limits of a unit, the zero values mean
+// no limit. They use the settings systemd 219 knows (MemoryLimit=
+// rather than MemoryMax= and so on), but for TasksMax= which needs
+// systemd 227: older ones ignore it in unit files but refuse it at
+// runtime, see RuntimeProperties.
+type ResourceLimits struct {
+	// MemoryLimit is in bytes
+	MemoryLimit int64
+	// CPUQuota is the percentage of the time of one CPU
+	CPUQuota int
+	TasksMax int
+	// BlockIOWeight is 10 to 1000, systemd uses 500 if it is not set
+	BlockIOWeight int
+}
+
+// Properties returns the limits as unit settings (e.g. "TasksMax=10")
+// for the unit file
+func (l *ResourceLimits) Properties() []string {
+	var props []string
+	if l.MemoryLimit > 0 {
+		props = append(props, fmt.Sprintf("MemoryLimit=%d", l.MemoryLimit))
+	}
+	if l.CPUQuota > 0 {
+		props = append(props, fmt.Sprintf("CPUQuota=%d%%", l.CPUQuota))
+	}
+	if l.TasksMax > 0 {
+		props = append(props, fmt.Sprintf("TasksMax=%d", l.TasksMax))
+	}
+	if l.BlockIOWeight > 0 {
+		props = append(props, fmt.Sprintf("BlockIOWeight=%d", l.BlockIOWeight))
+	}
+
+	return props
+}
+
+// RuntimeProperties returns the Properties that can be set at runtime,
+// with "systemd-run -p" or "systemctl set-property", which is all of
+// them but TasksMax= as systemd 219 fails on it there
+func (l *ResourceLimits) RuntimeProperties() []string {
+	withoutTasksMax := *l
+	withoutTasksMax.TasksMax = 0
+
+	return withoutTasksMax.Properties()
 }
 
 const (
 	// the default target for systemd units that we generate
 	servicesSystemdTarget = "multi-user.target"
 
+	// the target for the sockets of socket activated services
+	socketsSystemdTarget = "sockets.target"
+
 	// the location to put system services
 	snapServicesDir = "/etc/systemd/system"
 )
@@ -112,15 +192,28 @@ func (*systemd) DaemonReload() error {
 	return err
 }
 
-// Enable the given service
+// unitTarget returns the target that wants the given unit when it is
+// enabled
+func unitTarget(unitName string) string {
+	if strings.HasSuffix(unitName, ".socket") {
+		return socketsSystemdTarget
+	}
+
+	return servicesSystemdTarget
+}
+
+// Enable the given service (or socket)
 func (s *systemd) Enable(serviceName string) error {
-	enableSymlink := filepath.Join(s.rootDir, snapServicesDir, servicesSystemdTarget+".wants", serviceName)
+	enableSymlink := filepath.Join(s.rootDir, snapServicesDir, unitTarget(serviceName)+".wants", serviceName)
 
 	serviceFilename := filepath.Join(s.rootDir, snapServicesDir, serviceName)
 	// already enabled
 	if _, err := os.Lstat(enableSymlink); err == nil {
 		return nil
 	}
+	if err := os.MkdirAll(filepath.Dir(enableSymlink), 0755); err != nil {
+		return err
+	}
 
 	return os.Symlink(serviceFilename[len(s.rootDir):], enableSymlink)
 }
@@ -180,12 +273,17 @@ X-Snappy=yes
 ExecStart=/usr/bin/ubuntu-core-launcher {{.UdevAppName}} {{.AaProfile}} {{.FullPathStart}}
 WorkingDirectory={{.AppPath}}
 Environment="SNAPP_APP_PATH={{.AppPath}}" "SNAPP_APP_DATA_PATH=/var/lib{{.AppPath}}" "SNAPP_APP_USER_DATA_PATH=%h{{.AppPath}}" "SNAP_APP_PATH={{.AppPath}}" "SNAP_APP_DATA_PATH=/var/lib{{.AppPath}}" "SNAP_APP_USER_DATA_PATH=%h{{.AppPath}}" "SNAP_APP={{.AppTriple}}" "TMPDIR=/tmp/snaps/{{.UdevAppName}}/{{.Version}}/tmp" "SNAP_APP_TMPDIR=/tmp/snaps/{{.UdevAppName}}/{{.Version}}/tmp" "SNAP_NAME={{.AppName}}" "SNAP_ORIGIN={{.Namespace}}" "SNAP_FULLNAME={{.UdevAppName}}"
-{{if .Stop}}ExecStop=/usr/bin/ubuntu-core-launcher {{.UdevAppName}} {{.AaProfile}} {{.FullPathStop}}{{end}}
+{{if .ExtraEnvironment}}Environment={{.ExtraEnvironment}}
+{{end}}{{if .Stop}}ExecStop=/usr/bin/ubuntu-core-launcher {{.UdevAppName}} {{.AaProfile}} {{.FullPathStop}}{{end}}
 {{if .PostStop}}ExecStopPost=/usr/bin/ubuntu-core-launcher {{.UdevAppName}} {{.AaProfile}} {{.FullPathPostStop}}{{end}}
 {{if .StopTimeout}}TimeoutStopSec={{.StopTimeout.Seconds}}{{end}}
 {{if .BusName}}BusName={{.BusName}}{{end}}
 {{if .BusName}}Type=dbus{{end}}
-
+{{if .Type}}Type={{.Type}}
+{{end}}{{if .Restart}}Restart={{.Restart}}
+{{end}}{{if .RestartDelay}}RestartSec={{.RestartDelay.Seconds}}
+{{end}}{{range .LimitProperties}}{{.}}
+{{end}}
 [Install]
 WantedBy={{.ServiceSystemdTarget}}
 `
@@ -205,6 +303,8 @@ WantedBy={{.ServiceSystemdTarget}}
 		AppTriple            string
 		ServiceSystemdTarget string
 		Namespace            string
+		ExtraEnvironment     string
+		LimitProperties      []string
 	}{
 		*desc,
 		filepath.Join(desc.AppPath, desc.Start),
@@ -213,6 +313,8 @@ WantedBy={{.ServiceSystemdTarget}}
 		fmt.Sprintf("%s_%s_%s", desc.AppName, desc.ServiceName, desc.Version),
 		servicesSystemdTarget,
 		namespace,
+		quotedEnvironment(desc.Environment),
+		desc.Limits.Properties(),
 	}
 	if err := t.Execute(&templateOut, wrapperData); err != nil {
 		// this can never happen, except we forget a variable
@@ -222,6 +324,57 @@ WantedBy={{.ServiceSystemdTarget}}
 	return templateOut.String()
 }
 
+// GenSocketFile returns the socket unit that activates the given service
+// when one of its ListenStreams or ListenDatagrams is connected to
+func (s *systemd) GenSocketFile(desc *ServiceDescription) string {
+	socketTemplate := `[Unit]
+Description=Socket for {{.Description}}
+X-Snappy=yes
+
+[Socket]
+{{range .ListenStreams}}ListenStream={{.}}
+{{end}}{{range .ListenDatagrams}}ListenDatagram={{.}}
+{{end}}Service={{.ServiceFileName}}
+
+[Install]
+WantedBy={{.SocketSystemdTarget}}
+`
+	var templateOut bytes.Buffer
+	t := template.Must(template.New("socket").Parse(socketTemplate))
+	socketData := struct {
+		ServiceDescription
+		ServiceFileName     string
+		SocketSystemdTarget string
+	}{
+		*desc,
+		fmt.Sprintf("%s_%s_%s.service", desc.AppName, desc.ServiceName, desc.Version),
+		socketsSystemdTarget,
+	}
+	if err := t.Execute(&templateOut, socketData); err != nil {
+		// this can never happen, except we forget a variable
+		logger.LogAndPanic(err)
+	}
+
+	return templateOut.String()
+}
+
+// quotedEnvironment returns the given environment as the value of an
+// Environment= setting, sorted by name
+func quotedEnvironment(env map[string]string) string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vars := make([]string, len(names))
+	for i, name := range names {
+		vars[i] = fmt.Sprintf("%q", name+"="+env[name])
+	}
+
+	return strings.Join(vars, " ")
+}
+
 // Kill all processes of the unit with the given signal
 func (s *systemd) Kill(serviceName, signal string) error {
 	_, err := SystemctlCmd("kill", serviceName, "-s", signal)
@@ -236,6 +389,63 @@ func (s *systemd) Restart(serviceName string, timeout time.Duration) error {
 	return s.Start(serviceName)
 }
 
+// the properties of "show" that Status needs
+const statusProperties = "--property=ActiveState,SubState,MainPID,ActiveEnterTimestamp"
+
+// the format of the timestamps of "show", in the local time zone
+const showTimestampFormat = "Mon 2006-01-02 15:04:05 MST"
+
+// SetLimits applies the given limits to the cgroup of the given loaded
+// service until it is stopped, its unit needs to have them for later;
+// limits that are not set are left alone, as is TasksMax (see
+// RuntimeProperties)
+func (s *systemd) SetLimits(serviceName string, limits ResourceLimits) error {
+	props := limits.RuntimeProperties()
+	if len(props) == 0 {
+		return nil
+	}
+
+	_, err := SystemctlCmd(append([]string{"set-property", "--runtime", serviceName}, props...)...)
+	return err
+}
+
+// Status returns the state of the given service
+func (s *systemd) Status(serviceName string) (*ServiceStatus, error) {
+	bs, err := SystemctlCmd("show", statusProperties, serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ServiceStatus{ServiceName: serviceName}
+	for _, line := range strings.Split(string(bs), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "ActiveState":
+			status.ActiveState = kv[1]
+		case "SubState":
+			status.SubState = kv[1]
+		case "MainPID":
+			status.MainPID, _ = strconv.Atoi(kv[1])
+		case "ActiveEnterTimestamp":
+			// empty (or "n/a") if it was never active
+			status.ActiveSince, _ = time.ParseInLocation(showTimestampFormat, kv[1], time.Local)
+		}
+	}
+	if status.ActiveState != "active" {
+		status.ActiveSince = time.Time{}
+	}
+
+	enableSymlink := filepath.Join(s.rootDir, snapServicesDir, unitTarget(serviceName)+".wants", serviceName)
+	if _, err := os.Lstat(enableSymlink); err == nil {
+		status.Enabled = true
+	}
+
+	return status, nil
+}
+
 // Error is returned if the systemd action failed
 type Error struct {
 	cmd      []string
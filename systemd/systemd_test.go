@@ -144,6 +144,17 @@ func (s *SystemdTestSuite) TestEnable(c *C) {
 	c.Assert(target, Equals, "/etc/systemd/system/foo")
 }
 
+func (s *SystemdTestSuite) TestEnableSocket(c *C) {
+	sysd := New(c.MkDir(), s.rep)
+
+	c.Assert(sysd.Enable("foo.socket"), IsNil)
+
+	enableLink := filepath.Join(sysd.(*systemd).rootDir, "/etc/systemd/system/sockets.target.wants/foo.socket")
+	target, err := os.Readlink(enableLink)
+	c.Assert(err, IsNil)
+	c.Check(target, Equals, "/etc/systemd/system/foo.socket")
+}
+
 const expectedServiceFmt = `[Unit]
 Description=descr
 %s
@@ -252,3 +263,122 @@ func (s *SystemdTestSuite) TestIsTimeout(c *C) {
 	c.Check(IsTimeout(os.ErrInvalid), Equals, false)
 	c.Check(IsTimeout(&Timeout{}), Equals, true)
 }
+
+func (s *SystemdTestSuite) TestStatus(c *C) {
+	s.outs = [][]byte{[]byte("ActiveState=active\nSubState=running\nMainPID=42\nActiveEnterTimestamp=Mon 2015-06-01 12:00:00 UTC\n")}
+
+	sysd := New(c.MkDir(), s.rep)
+	wantsDir := filepath.Join(sysd.(*systemd).rootDir, "/etc/systemd/system/multi-user.target.wants")
+	c.Assert(os.MkdirAll(wantsDir, 0755), IsNil)
+	c.Assert(sysd.Enable("foo"), IsNil)
+
+	status, err := sysd.Status("foo")
+	c.Assert(err, IsNil)
+	c.Check(s.argses, DeepEquals, [][]string{{"show", "--property=ActiveState,SubState,MainPID,ActiveEnterTimestamp", "foo"}})
+	c.Check(status.ServiceName, Equals, "foo")
+	c.Check(status.Enabled, Equals, true)
+	c.Check(status.ActiveState, Equals, "active")
+	c.Check(status.SubState, Equals, "running")
+	c.Check(status.MainPID, Equals, 42)
+	c.Check(status.ActiveSince.Equal(time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)), Equals, true)
+}
+
+func (s *SystemdTestSuite) TestStatusInactive(c *C) {
+	s.outs = [][]byte{[]byte("ActiveState=inactive\nSubState=dead\nMainPID=0\nActiveEnterTimestamp=Mon 2015-06-01 12:00:00 UTC\n")}
+
+	status, err := New(c.MkDir(), s.rep).Status("foo")
+	c.Assert(err, IsNil)
+	c.Check(status.Enabled, Equals, false)
+	c.Check(status.ActiveState, Equals, "inactive")
+	c.Check(status.MainPID, Equals, 0)
+	c.Check(status.ActiveSince.IsZero(), Equals, true)
+}
+
+func (s *SystemdTestSuite) TestGenServiceFileWithRestartTypeAndEnvironment(c *C) {
+	desc := &ServiceDescription{
+		AppName:      "app",
+		ServiceName:  "service",
+		Version:      "1.0",
+		Description:  "descr",
+		AppPath:      "/apps/app.mvo/1.0/",
+		Start:        "bin/start",
+		StopTimeout:  time.Duration(10 * time.Second),
+		AaProfile:    "aa-profile",
+		UdevAppName:  "app.mvo",
+		Restart:      "on-failure",
+		RestartDelay: 1500 * time.Millisecond,
+		Type:         "notify",
+		Environment:  map[string]string{"PORT": "8080", "MODE": "fast"},
+	}
+
+	generated := New("", nil).GenServiceFile(desc)
+	c.Check(generated, Matches, `(?s).*\nEnvironment="MODE=fast" "PORT=8080"\n.*`)
+	c.Check(generated, Matches, `(?s).*\nType=notify\nRestart=on-failure\nRestartSec=1.5\n\n\[Install\].*`)
+}
+
+func (s *SystemdTestSuite) TestGenServiceFileWithLimits(c *C) {
+	desc := &ServiceDescription{
+		AppName:     "app",
+		ServiceName: "service",
+		Version:     "1.0",
+		Description: "descr",
+		AppPath:     "/apps/app.mvo/1.0/",
+		Start:       "bin/start",
+		StopTimeout: time.Duration(10 * time.Second),
+		AaProfile:   "aa-profile",
+		UdevAppName: "app.mvo",
+		Restart:     "always",
+		Limits:      ResourceLimits{MemoryLimit: 64 << 20, CPUQuota: 50, TasksMax: 32, BlockIOWeight: 200},
+	}
+
+	generated := New("", nil).GenServiceFile(desc)
+	c.Check(generated, Matches, `(?s).*\nRestart=always\nMemoryLimit=67108864\nCPUQuota=50%\nTasksMax=32\nBlockIOWeight=200\n\n\[Install\].*`)
+}
+
+const expectedSocket = `[Unit]
+Description=Socket for descr
+X-Snappy=yes
+
+[Socket]
+ListenStream=80
+ListenStream=8080
+ListenDatagram=5353
+Service=app_service_1.0.service
+
+[Install]
+WantedBy=sockets.target
+`
+
+func (s *SystemdTestSuite) TestGenSocketFile(c *C) {
+	desc := &ServiceDescription{
+		AppName:         "app",
+		ServiceName:     "service",
+		Version:         "1.0",
+		Description:     "descr",
+		AppPath:         "/apps/app.mvo/1.0/",
+		Start:           "bin/start",
+		UdevAppName:     "app.mvo",
+		ListenStreams:   []string{"80", "8080"},
+		ListenDatagrams: []string{"5353"},
+	}
+
+	c.Check(New("", nil).GenSocketFile(desc), Equals, expectedSocket)
+}
+
+func (s *SystemdTestSuite) TestResourceLimitsProperties(c *C) {
+	c.Check((&ResourceLimits{}).Properties(), HasLen, 0)
+	c.Check((&ResourceLimits{TasksMax: 10}).Properties(), DeepEquals, []string{"TasksMax=10"})
+
+	// systemd 219 refuses TasksMax= at runtime
+	c.Check((&ResourceLimits{TasksMax: 10}).RuntimeProperties(), HasLen, 0)
+	c.Check((&ResourceLimits{CPUQuota: 50, TasksMax: 10}).RuntimeProperties(), DeepEquals, []string{"CPUQuota=50%"})
+}
+
+func (s *SystemdTestSuite) TestSetLimits(c *C) {
+	c.Assert(New("", s.rep).SetLimits("foo", ResourceLimits{}), IsNil)
+	c.Assert(New("", s.rep).SetLimits("foo", ResourceLimits{TasksMax: 10}), IsNil)
+	c.Check(s.argses, HasLen, 0)
+
+	c.Assert(New("", s.rep).SetLimits("foo", ResourceLimits{MemoryLimit: 1024, BlockIOWeight: 100}), IsNil)
+	c.Check(s.argses, DeepEquals, [][]string{{"set-property", "--runtime", "foo", "MemoryLimit=1024", "BlockIOWeight=100"}})
+}